@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/backtest"
+	"stock-backend/benchmark"
+	"stock-backend/calendar"
+	"stock-backend/chart"
+	"stock-backend/kline"
+	"stock-backend/montecarlo"
+	"stock-backend/report"
+	"stock-backend/scoring"
+	"stock-backend/screener"
+	"stock-backend/stocknames"
+	"stock-backend/strategy"
+	"stock-backend/universe"
+)
+
+// argList collects repeated -arg name=value flags.
+type argList screener.Args
+
+func (a argList) String() string {
+	return fmt.Sprint(map[string]any(a))
+}
+
+func (a argList) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	a[name] = value
+	return nil
+}
+
+// condList collects repeated -filter field<op>value flags.
+type condList []universe.Condition
+
+func (c *condList) String() string {
+	return fmt.Sprint(*c)
+}
+
+func (c *condList) Set(s string) error {
+	cond, err := universe.ParseCondition(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, cond)
+	return nil
+}
+
+func parseDay(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		log.Fatalf("Bad date %q: %v", s, err)
+	}
+	return t
+}
+
+// readSymbols reads one symbol per line, skipping blanks.
+func readSymbols(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var symbols []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if s := strings.TrimSpace(scanner.Text()); s != "" {
+			symbols = append(symbols, s)
+		}
+	}
+	return symbols, scanner.Err()
+}
+
+func main() {
+	name := flag.String("strategy", "", "registered strategy to test: "+strings.Join(strategy.Names(), ", "))
+	market := flag.String("market", "cn", "cn or us")
+	period := flag.String("period", string(kline.Day), "bar period: day, week or 15m (15m needs the kline-15m feed imported)")
+	from := flag.String("from", time.Now().AddDate(0, -3, 0).Format("2006-01-02"), "first day to trade, YYYY-MM-DD")
+	to := flag.String("to", "", "stop before this day, YYYY-MM-DD, empty for the latest bar")
+	screens := flag.String("screens", screener.DefaultDir, "directory holding the screen SQL files")
+	screen := flag.String("universe", "latest-symbols", "screen that returns the symbols to test, run as of -from unless -arg as_of is given")
+	symbolsFile := flag.String("symbols", "", "file with one symbol per line to test instead of the -universe screen")
+	args := argList{}
+	flag.Var(args, "arg", "universe screen parameter as name=value, repeatable; market is set from -market")
+	pit := flag.Bool("pit", false, "use each day's universe from -filter instead of the -universe screen's list")
+	var filters condList
+	flag.Var(&filters, "filter", "point-in-time universe condition on the daily row, e.g. market_capital>=1e10, repeatable")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	cash := flag.Float64("cash", backtest.DefaultCash, "starting cash")
+	size := flag.String("size", "", "sizing rule: fixed:<cash>, pct:<fraction>, vol:<target>[:<lookback>] or atr:<risk>[:<multiple>[:<period>]]; empty for a tenth of -cash")
+	maxPositions := flag.Int("max-positions", 0, "most positions open at once, 0 for no cap")
+	maxPerSymbol := flag.Float64("max-per-symbol", 0, "largest position as a fraction of equity, 0 for no cap")
+	priority := flag.String("priority", "", "scoring weights YAML to rank simultaneous buys, \"default\" for the built-in weights, empty for symbol order")
+	hold := flag.Int("hold", 1, "sell at the open this many bars after entry, 0 to hold until a sell signal or exit rule")
+	exitRules := flag.String("exit", "", "exit rules: stop:<pct>, target:<pct>, trail:<multiple>[:<period>], ma:<n>, gap[:<key>], time:<bars>, comma-separated, first hit wins; empty for none")
+	nextOpen := flag.Bool("next-open", false, "fill signals at the next bar's open instead of the signal price")
+	costs := flag.Bool("costs", true, "charge the market's fees and apply its lot, T+1 and price limit rules")
+	slippage := flag.String("slippage", "", "slippage model: fixed:<per share>, pct:<fraction> or volume:<impact>, empty for none")
+	bench := flag.String("benchmark", "", "index to compare against: csi300, sse, spx or ndx; empty for the market's default, none to skip")
+	equityFile := flag.String("equity", "", "write the equity curve, with the benchmark on the same cash, to this CSV file")
+	chartFile := flag.String("chart", "", "render the equity and drawdown curves to this .png or .svg file")
+	mcRuns := flag.Int("montecarlo", 0, "resample the trades this many times per Monte Carlo method, 0 to skip")
+	mcSkip := flag.Float64("mc-skip", 0.1, "chance of skipping each trade in the Monte Carlo skip method")
+	ruin := flag.Float64("ruin", 0.5, "loss of starting equity counted as ruin in the Monte Carlo report")
+	reportDir := flag.String("report", "", "file the run with an HTML report under this directory, empty for none")
+	runID := flag.String("run-id", "", "ID to file the run under, empty for <strategy>-<time>")
+	compareID := flag.String("compare", "", "run ID to compare the report with; empty for the latest earlier run of the strategy, none to skip")
+	showTrades := flag.Bool("trades", true, "print every trade")
+	topSymbols := flag.Int("top", 10, "show this many best and worst symbols, 0 for all")
+	flag.Parse()
+
+	s, err := strategy.Get(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := kline.Period(*period)
+	if _, err := p.Table(*market); err != nil {
+		log.Fatal(err)
+	}
+	var cal *calendar.Market
+	if p.Duration() < 24*time.Hour {
+		// 日内K线按交易日归属，美股的交易时段跨了本地午夜
+		if cal, err = calendar.Get(*market); err != nil {
+			log.Fatal(err)
+		}
+	}
+	slip, err := backtest.ParseSlippage(*slippage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var exit strategy.Exit
+	if *exitRules != "" {
+		exit, err = strategy.ParseExit(*exitRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var rules *backtest.Market
+	if *costs {
+		rules, err = backtest.MarketFor(*market)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var sizer backtest.Sizer
+	if *size != "" {
+		sizer, err = backtest.ParseSizer(*size)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var rank *scoring.Config
+	switch *priority {
+	case "":
+	case "default":
+		rank = &scoring.Default
+	default:
+		cfg, err := scoring.Load(*priority)
+		if err != nil {
+			log.Fatalf("Failed to load weights: %v", err)
+		}
+		rank = &cfg
+	}
+	start := parseDay(*from)
+	var end int64
+	if *to != "" {
+		end = parseDay(*to).UnixMilli()
+	}
+
+	reg, err := screener.Open(*screens)
+	if err != nil {
+		log.Fatalf("Failed to load screens: %v", err)
+	}
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	var (
+		symbols []string
+		pool    backtest.Universe
+	)
+	if *pit {
+		h, err := universe.Load(ctx, conn, *market, filters, start.UnixMilli(), end)
+		if err != nil {
+			log.Fatalf("Failed to load universe: %v", err)
+		}
+		symbols, pool = h.Symbols(), h
+	} else if *symbolsFile != "" {
+		symbols, err = readSymbols(*symbolsFile)
+		if err != nil {
+			log.Fatalf("Failed to read symbols: %v", err)
+		}
+	} else {
+		args["market"] = *market
+		if _, ok := args["as_of"]; !ok {
+			// 股票池按开始那天之前的数据筛，不用后来才知道的名单
+			args["as_of"] = start.UnixMilli()
+		}
+		symbols, err = reg.Symbols(ctx, conn, *screen, screener.Args(args))
+		if err != nil {
+			log.Fatalf("Failed to load universe: %v", err)
+		}
+	}
+	// 留出策略回看需要的历史
+	lookback := s.Lookback()
+	if exit != nil {
+		lookback = max(lookback, exit.Lookback())
+	}
+	warmup := p.Warmup(*market, lookback)
+	began := time.Now()
+	data, err := backtest.Load(ctx, kline.NewClickHouseSource(conn, *market), symbols, p, start.Add(-warmup).UnixMilli(), end)
+	if err != nil && p == kline.Min15 {
+		log.Fatalf("Failed to load bars: %v (15m bars are fed by xueqiu-feed/kline-15m and loaded with csv-gen/import_15m.sh)", err)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load bars: %v", err)
+	}
+	// ST 股的涨跌停窄，按每天导入的股票名称认出来；没导入名称就都按普通股票算
+	var st backtest.ST
+	if rules != nil && rules.PriceLimits {
+		st, err = stocknames.LoadST(ctx, conn, *market, start.UnixMilli(), end)
+		if err != nil {
+			fmt.Println("读取股票名称失败，ST 股按普通涨跌停算:", err)
+		}
+	}
+	var benchBars *backtest.Benchmark
+	if *bench != "none" {
+		idx, err := benchmark.Default(*market)
+		if *bench != "" {
+			idx, err = benchmark.Get(*bench)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		// 多取十天，好拿到开始前最后一个收盘价做基准；指数没导入就不算相对指标
+		benchBars, err = benchmark.Load(ctx, conn, idx, start.AddDate(0, 0, -10).UnixMilli(), end)
+		if err != nil {
+			fmt.Println("读取基准失败，不算相对指标（指数日线用 csv-gen/import_index.sh 导入）:", err)
+		}
+	}
+	fill := backtest.FillSignal
+	if *nextOpen {
+		fill = backtest.FillNextOpen
+	}
+	res, err := backtest.Run(data, backtest.Config{
+		Strategy:     s,
+		Start:        start.UnixMilli(),
+		End:          end,
+		Cash:         *cash,
+		Sizer:        sizer,
+		MaxPositions: *maxPositions,
+		MaxPerSymbol: *maxPerSymbol,
+		Priority:     rank,
+		Fill:         fill,
+		HoldBars:     *hold,
+		Exit:         exit,
+		Market:       rules,
+		ST:           st,
+		Slippage:     slip,
+		Universe:     pool,
+		Benchmark:    benchBars,
+		Calendar:     cal,
+	})
+	if err != nil {
+		log.Fatalf("Failed to run backtest: %v", err)
+	}
+
+	if *showTrades {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "symbol\tentry\tprice\texit\tprice\tbars\treturn\tpnl\tfees\treason")
+		for _, t := range res.Trades {
+			fmt.Fprintf(w, "%s\t%s\t%.3f\t%s\t%.3f\t%d\t%.2f%%\t%.2f\t%.2f\t%s\n",
+				t.Symbol,
+				time.UnixMilli(t.EntryTime).Format("2006-01-02 15:04"), t.EntryPrice,
+				time.UnixMilli(t.ExitTime).Format("2006-01-02 15:04"), t.ExitPrice,
+				t.Bars, t.Return()*100, t.PnL(), t.Fees, t.Reason)
+		}
+		w.Flush()
+	}
+	fmt.Printf("%s: %d 个标的, 耗时：%s\n", s.Name(), len(data), time.Since(began))
+	if len(res.Rejects) > 0 {
+		reasons := make(map[string]int)
+		for _, r := range res.Rejects {
+			reasons[r.Reason]++
+		}
+		fmt.Printf("未成交 %d 笔: %v\n", len(res.Rejects), reasons)
+	}
+	if err := res.Metrics().WriteReport(os.Stdout, *topSymbols); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	if *mcRuns > 0 {
+		mc := montecarlo.Config{Runs: *mcRuns, Skip: *mcSkip, Ruin: *ruin}
+		sample := montecarlo.FromResult(res)
+		fmt.Println()
+		if err := montecarlo.WriteReport(os.Stdout, sample, montecarlo.Run(sample, mc), mc); err != nil {
+			log.Fatalf("Failed to write Monte Carlo report: %v", err)
+		}
+	}
+	if *equityFile != "" {
+		f, err := os.Create(*equityFile)
+		if err != nil {
+			log.Fatalf("Failed to create equity file: %v", err)
+		}
+		defer f.Close()
+		if err := res.WriteEquity(f); err != nil {
+			log.Fatalf("Failed to write equity: %v", err)
+		}
+	}
+	if *chartFile != "" {
+		if err := chart.Save(*chartFile, chart.Width, chart.Height, chart.Performance(res)...); err != nil {
+			log.Fatalf("Failed to save chart: %v", err)
+		}
+	}
+	if *reportDir != "" {
+		var settings []report.Setting
+		flag.VisitAll(func(f *flag.Flag) {
+			settings = append(settings, report.Setting{Name: f.Name, Value: f.Value.String()})
+		})
+		id := *runID
+		if id == "" {
+			id = report.NewID(s.Name(), began)
+		}
+		run := report.New(id, settings, res, data)
+		switch *compareID {
+		case "none":
+		case "":
+			run.Previous, err = report.Latest(*reportDir, s.Name(), run.Created)
+		default:
+			run.Previous, err = report.Load(*reportDir, *compareID)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load previous run: %v", err)
+		}
+		page, err := run.Save(*reportDir)
+		if err != nil {
+			log.Fatalf("Failed to save report: %v", err)
+		}
+		fmt.Printf("报告已保存: %s\n", page)
+	}
+}
@@ -0,0 +1,37 @@
+package backtest
+
+import (
+	"stock-backend/kline"
+	"stock-backend/strategy"
+)
+
+// ErrLookahead is returned by Run when the strategy or exit rule asked its
+// View for bars after the one it was deciding on. It is
+// strategy.ErrLookahead, so errors.Is works with either.
+var ErrLookahead = strategy.ErrLookahead
+
+// known cuts bars off after i, capacity included, so everything handed out
+// of the engine stops at the simulated time.
+func known(bars []kline.Bar, i int) []kline.Bar {
+	return bars[: i+1 : i+1]
+}
+
+// signal runs the strategy on bar i of symbol. strategy.At hands it a View
+// as of bar i, which refuses anything later with ErrLookahead.
+func (e *engine) signal(symbol string, bars []kline.Bar, i int) (strategy.Signal, bool, error) {
+	return strategy.At(e.cfg.Strategy, symbol, bars, i)
+}
+
+// exit runs Config.Exit on bar i of the symbol's open position p. A
+// lookahead leaves the position alone and is kept for Run to fail with.
+func (e *engine) exit(symbol string, p *position, bars []kline.Bar, i int) (strategy.ExitSignal, bool) {
+	pos := strategy.Position{Symbol: symbol, EntryTime: p.entryTime, EntryPrice: p.entryPrice, Values: p.signal}
+	x, ok, err := strategy.ExitAt(e.cfg.Exit, pos, bars, i)
+	if err != nil {
+		if e.err == nil {
+			e.err = err
+		}
+		return strategy.ExitSignal{}, false
+	}
+	return x, ok
+}
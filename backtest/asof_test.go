@@ -0,0 +1,141 @@
+package backtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/strategy"
+)
+
+// cnDays builds daily bars on consecutive A-share trading days from
+// 2024-03-04, one per close; open, high and low are spread around it.
+func cnDays(closes ...float64) []kline.Bar {
+	d := time.Date(2024, 3, 4, 0, 0, 0, 0, calendar.CN.Location)
+	bars := make([]kline.Bar, len(closes))
+	for i, c := range closes {
+		for !calendar.CN.IsTradingDay(d) {
+			d = d.AddDate(0, 0, 1)
+		}
+		bars[i] = kline.Bar{Timestamp: d.UnixMilli(), Open: c, High: c * 1.02, Low: c * 0.98, Close: c, Volume: 1e6}
+		d = d.AddDate(0, 0, 1)
+	}
+	return bars
+}
+
+// signalOn trades the bars listed in buys and sells at Price, or at the
+// close when Price is zero. It only looks at the current bar.
+type signalOn struct {
+	buys, sells map[int]bool
+	Price       float64
+}
+
+func (s signalOn) Name() string  { return "signal-on" }
+func (s signalOn) Lookback() int { return 0 }
+
+func (s signalOn) Check(v strategy.View) (strategy.Signal, bool) {
+	price := s.Price
+	if price == 0 {
+		price = v.Bar().Close
+	}
+	switch i := v.Index(); {
+	case s.buys[i]:
+		return strategy.Signal{Direction: strategy.Buy, Price: price}, true
+	case s.sells[i]:
+		return strategy.Signal{Direction: strategy.Sell, Price: price}, true
+	}
+	return strategy.Signal{}, false
+}
+
+func indices(ks ...int) map[int]bool {
+	res := make(map[int]bool, len(ks))
+	for _, k := range ks {
+		res[k] = true
+	}
+	return res
+}
+
+// tomorrow buys when the next bar closes higher, reading it through the
+// View the way a careless strategy would.
+type tomorrow struct{}
+
+func (tomorrow) Name() string  { return "tomorrow" }
+func (tomorrow) Lookback() int { return 0 }
+
+func (tomorrow) Check(v strategy.View) (strategy.Signal, bool) {
+	next, err := v.Bars(v.Index() + 1)
+	if err != nil {
+		return strategy.Signal{}, false
+	}
+	if next[len(next)-1].Close > v.Bar().Close {
+		return strategy.Signal{Direction: strategy.Buy, Price: v.Bar().Close}, true
+	}
+	return strategy.Signal{}, false
+}
+
+// sellBeforeDrop exits the bar before a lower close.
+type sellBeforeDrop struct{}
+
+func (sellBeforeDrop) Name() string  { return "before-drop" }
+func (sellBeforeDrop) Lookback() int { return 0 }
+
+func (sellBeforeDrop) Check(p strategy.Position, v strategy.View, entry int) (strategy.ExitSignal, bool) {
+	next, err := v.Bars(v.Index() + 1)
+	if err != nil || next[len(next)-1].Close >= v.Bar().Close {
+		return strategy.ExitSignal{}, false
+	}
+	return strategy.ExitSignal{Rule: "before-drop", Phase: strategy.AtClose, Price: v.Bar().Close}, true
+}
+
+func TestRunLookahead(t *testing.T) {
+	data := Data{
+		"SH600000": cnDays(10, 11, 12, 11, 13, 14),
+		"SZ000001": cnDays(20, 19, 21, 22, 20, 23),
+	}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"honest strategy", Config{Strategy: signalOn{buys: indices(1)}}, false},
+		{"peeking strategy", Config{Strategy: tomorrow{}}, true},
+		{"peeking strategy, one worker", Config{Strategy: tomorrow{}, Workers: 1}, true},
+		{"peeking exit", Config{Strategy: signalOn{buys: indices(0)}, Exit: sellBeforeDrop{}}, true},
+		{"honest exit", Config{Strategy: signalOn{buys: indices(0)}, Exit: strategy.StopLoss{Pct: 0.05}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Run(data, tt.cfg)
+			if !tt.wantErr {
+				if err != nil || res == nil {
+					t.Fatalf("Run = %v, %v; want a result", res, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrLookahead) || !errors.Is(err, strategy.ErrLookahead) {
+				t.Fatalf("Run error = %v, want ErrLookahead", err)
+			}
+			if res != nil {
+				t.Errorf("Run returned a result along with %v", err)
+			}
+		})
+	}
+}
+
+// TestRunLookaheadSameError checks the parallel scan reports the lookahead
+// the first symbol in order made, whatever the number of workers.
+func TestRunLookaheadSameError(t *testing.T) {
+	data := Data{}
+	for _, symbol := range []string{"SH600000", "SH600036", "SZ000001", "SZ000002"} {
+		data[symbol] = cnDays(10, 11, 12, 13)
+	}
+	_, want := Run(data, Config{Strategy: tomorrow{}, Workers: 1})
+	for _, workers := range []int{2, 4, 8} {
+		_, err := Run(data, Config{Strategy: tomorrow{}, Workers: workers})
+		if err == nil || err.Error() != want.Error() {
+			t.Errorf("%d workers: %v, want %v", workers, err, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"stock-backend/kline"
+)
+
+// Benchmark is an index a run is judged against, as daily bars.
+type Benchmark struct {
+	Name string
+	Bars []kline.Bar
+}
+
+// closeAt is the close of the last bar at or before ts.
+func (b *Benchmark) closeAt(ts int64) (float64, bool) {
+	i := sort.Search(len(b.Bars), func(i int) bool { return b.Bars[i].Timestamp > ts }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	return b.Bars[i].Close, true
+}
+
+// base is the benchmark close the run starts from: the last one before the
+// first equity point, or the first one when the bars start later.
+func (b *Benchmark) base(ts int64) (float64, bool) {
+	if c, ok := b.closeAt(ts - 1); ok {
+		return c, true
+	}
+	if len(b.Bars) == 0 {
+		return 0, false
+	}
+	return b.Bars[0].Close, true
+}
+
+// Relative compares a run with its benchmark over the run's days. Alpha,
+// tracking error and the information ratio are annualized from daily
+// returns; the risk-free rate is taken as zero.
+type Relative struct {
+	Benchmark string
+	// Return and CAGR are the benchmark's over the run, Excess the run's
+	// total return above it.
+	Return float64
+	CAGR   float64
+	Excess float64
+	Alpha  float64
+	Beta   float64
+	// Correlation is of the daily returns.
+	Correlation      float64
+	TrackingError    float64
+	InformationRatio float64
+}
+
+// BenchmarkEquity is the benchmark bought with the starting cash at the
+// start of the run, valued at each equity point; nil without a benchmark.
+func (r *Result) BenchmarkEquity() []float64 {
+	b := r.Config.Benchmark
+	if b == nil || len(r.Equity) == 0 {
+		return nil
+	}
+	base, ok := b.base(r.Equity[0].Time)
+	if !ok || base == 0 {
+		return nil
+	}
+	res := make([]float64, len(r.Equity))
+	for i, p := range r.Equity {
+		c, ok := b.closeAt(p.Time)
+		if !ok {
+			c = base
+		}
+		res[i] = r.Config.Cash * c / base
+	}
+	return res
+}
+
+func (r *Result) relative(m *Metrics) {
+	b := r.Config.Benchmark
+	if b == nil {
+		return
+	}
+	rel := &Relative{Benchmark: b.Name}
+	m.Benchmark = rel
+	bench := r.BenchmarkEquity()
+	if bench == nil {
+		return
+	}
+	rel.Return = bench[len(bench)-1]/m.StartEquity - 1
+	rel.Excess = m.TotalReturn - rel.Return
+	years := m.End.Sub(m.Start).Hours() / 24 / 365.25
+	if years > 0 && bench[len(bench)-1] > 0 {
+		rel.CAGR = math.Pow(bench[len(bench)-1]/m.StartEquity, 1/years) - 1
+	}
+
+	// 按天对齐：取每天最后一个权益点和同一时刻的指数
+	eq, bm := []float64{m.StartEquity}, []float64{m.StartEquity}
+	day := ""
+	for i, p := range r.Equity {
+		d := r.day(p.Time).Format("2006-01-02")
+		if d == day {
+			eq[len(eq)-1], bm[len(bm)-1] = p.Equity(), bench[i]
+			continue
+		}
+		day = d
+		eq, bm = append(eq, p.Equity()), append(bm, bench[i])
+	}
+	if len(eq) < 3 {
+		return
+	}
+	n := len(eq) - 1
+	rp, rb, active := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		rp[i] = eq[i+1]/eq[i] - 1
+		rb[i] = bm[i+1]/bm[i] - 1
+		active[i] = rp[i] - rb[i]
+	}
+	mp, sp := meanStd(rp)
+	mb, sb := meanStd(rb)
+	cov := 0.0
+	for i := range rp {
+		cov += (rp[i] - mp) * (rb[i] - mb)
+	}
+	cov /= float64(n - 1)
+	if sb > 0 {
+		rel.Beta = cov / (sb * sb)
+		if sp > 0 {
+			rel.Correlation = cov / (sp * sb)
+		}
+	}
+	rel.Alpha = (mp - rel.Beta*mb) * TradingDays
+	ma, sa := meanStd(active)
+	rel.TrackingError = sa * math.Sqrt(TradingDays)
+	if sa > 0 {
+		rel.InformationRatio = ma / sa * math.Sqrt(TradingDays)
+	}
+}
+
+// WriteEquity writes the equity curve as CSV: time, cash, holdings, equity
+// and, with a benchmark, the benchmark equity on the same starting cash.
+func (r *Result) WriteEquity(out io.Writer) error {
+	w := csv.NewWriter(out)
+	bench := r.BenchmarkEquity()
+	header := []string{"time", "cash", "holdings", "equity"}
+	if bench != nil {
+		header = append(header, r.Config.Benchmark.Name)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for i, p := range r.Equity {
+		row := []string{time.UnixMilli(p.Time).Format("2006-01-02 15:04"), f(p.Cash), f(p.Holdings), f(p.Equity())}
+		if bench != nil {
+			row = append(row, f(bench[i]))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
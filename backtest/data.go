@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"stock-backend/kline"
+)
+
+// Data is the bars of every symbol in a run, oldest first.
+type Data map[string][]kline.Bar
+
+// LoadBatch is how many symbols Load asks a kline.BulkSource for at once,
+// keeping each query's symbol list well under ClickHouse's query size
+// limit.
+const LoadBatch = 2000
+
+// Load reads bars for symbols in [from, to) from src, LoadBatch symbols a
+// query when src is a kline.BulkSource and one by one otherwise. Symbols
+// with no bars are left out.
+func Load(ctx context.Context, src kline.Source, symbols []string, period kline.Period, from, to int64) (Data, error) {
+	data := make(Data, len(symbols))
+	if bulk, ok := src.(kline.BulkSource); ok {
+		for k := 0; k < len(symbols); k += LoadBatch {
+			batch, err := bulk.BarsMany(ctx, symbols[k:min(k+LoadBatch, len(symbols))], period, from, to)
+			if err != nil {
+				return nil, err
+			}
+			for symbol, bars := range batch {
+				if len(bars) > 0 {
+					data[symbol] = bars
+				}
+			}
+		}
+		return data, nil
+	}
+	for _, symbol := range symbols {
+		bars, err := src.Bars(ctx, symbol, period, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(bars) > 0 {
+			data[symbol] = bars
+		}
+	}
+	return data, nil
+}
+
+// Symbols lists the symbols in sorted order, the order the engine visits
+// them in within one timestamp.
+func (d Data) Symbols() []string {
+	res := make([]string, 0, len(d))
+	for symbol := range d {
+		res = append(res, symbol)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// timeline is every distinct bar timestamp across symbols, ascending.
+func (d Data) timeline() []int64 {
+	n := 0
+	for _, bars := range d {
+		n += len(bars)
+	}
+	res := make([]int64, 0, n)
+	for _, bars := range d {
+		for _, b := range bars {
+			res = append(res, b.Timestamp)
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res)
+}
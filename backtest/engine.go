@@ -0,0 +1,516 @@
+package backtest
+
+import (
+	"fmt"
+	"sort"
+
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/scoring"
+	"stock-backend/strategy"
+)
+
+// FillMode is where an entry signal gets filled.
+type FillMode int
+
+const (
+	// FillSignal fills on the signal bar at Signal.Price, the way
+	// daily-pop-analysis buys at the gap open. The price must lie within the
+	// bar's range.
+	FillSignal FillMode = iota
+	// FillNextOpen fills at the open of the symbol's next bar.
+	FillNextOpen
+)
+
+// Config describes one run.
+type Config struct {
+	Strategy strategy.Strategy
+	// Start and End bound the bars the strategy may trade on, [Start, End)
+	// in unix milliseconds; End 0 means the end of the data. Bars before
+	// Start only serve as history.
+	Start int64
+	End   int64
+	// Cash is the starting cash.
+	Cash float64
+	// Sizer decides the cash put into each new position, capped by what is
+	// free; nil puts a tenth of the starting cash into each.
+	Sizer Sizer
+	// MaxPositions caps the positions open at once, 0 for no cap.
+	MaxPositions int
+	// MaxPerSymbol caps one position at this fraction of equity, 0 for no
+	// cap.
+	MaxPerSymbol float64
+	// Priority ranks the buys that come up at the same time, best first, so
+	// the best get the capital when there is not enough for all. nil takes
+	// them in symbol order.
+	Priority *scoring.Config
+	Fill     FillMode
+	// HoldBars closes a position at the open of the bar that many bars after
+	// entry; 0 holds until a sell signal, an Exit or the end of the data.
+	HoldBars int
+	// Exit closes positions by rule, such as a stop-loss, alongside
+	// HoldBars and sell signals. Exits at the open fill with the open
+	// sells; the others fill before the strategy checks the bar. nil for
+	// none.
+	Exit strategy.Exit
+	// Market charges fees and applies lot, settlement and price limit rules;
+	// nil trades for free.
+	Market *Market
+	// ST marks the days symbols traded under risk warning, when their price
+	// limit is narrower; nil treats every symbol as a normal one.
+	ST ST
+	// Slippage moves fill prices against the order; nil fills at the
+	// quoted price.
+	Slippage Slippage
+	// Universe limits new positions to the symbols that were members when
+	// the signal came; positions already open are still managed. nil lets
+	// every symbol in the data trade.
+	Universe Universe
+	// Benchmark, when set, adds index-relative figures to the metrics and
+	// a benchmark column to the equity curve.
+	Benchmark *Benchmark
+	// Calendar groups intraday bars into the trading days they belong to:
+	// price limits are set from the previous day's last close and daily
+	// returns end at each day's close, even when a session crosses local
+	// midnight. nil takes every bar as a day of its own and returns by
+	// local date, right for daily and weekly bars.
+	Calendar *calendar.Market
+	// Workers is how many symbols the strategy checks at once, GOMAXPROCS
+	// when zero. The result is the same for any number.
+	Workers int
+}
+
+// Universe is the set of tradable symbols over time, such as a
+// universe.History.
+type Universe interface {
+	Contains(symbol string, ts int64) bool
+}
+
+// DefaultCash is the starting cash when Config.Cash is zero.
+const DefaultCash = 100000
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Cash == 0 {
+		cfg.Cash = DefaultCash
+	}
+	if cfg.Sizer == nil {
+		cfg.Sizer = FixedAmount(cfg.Cash / 10)
+	}
+	return cfg
+}
+
+type position struct {
+	qty        float64
+	entryTime  int64
+	entryPrice float64
+	entryIndex int
+	entryFee   float64
+	signal     map[string]float64
+}
+
+// order is a pending FillNextOpen order.
+type order struct {
+	direction strategy.Direction
+	sig       strategy.Signal
+}
+
+// entry is a buy waiting for its turn at one timestamp.
+type entry struct {
+	symbol string
+	i      int
+	price  float64
+	sig    strategy.Signal
+}
+
+// engine is the state of one run.
+type engine struct {
+	cfg     Config
+	data    Data
+	symbols []string
+
+	cash      float64
+	positions map[string]*position
+	pending   map[string]order
+	cursor    map[string]int
+	// signals are the strategy's, worked out by scan before the replay.
+	signals map[string]map[int]strategy.Signal
+	// marks are the latest closes seen, for sizing against equity without
+	// looking at the current bar's close.
+	marks map[string]float64
+	// err is the first lookahead an exit rule made in the replay; Run
+	// stops on it.
+	err error
+
+	res *Result
+}
+
+// Run replays data through cfg.Strategy in timestamp order. The strategy
+// checks every symbol's bars first, in parallel; the portfolio is then
+// replayed one timestamp at a time. At each timestamp the symbols with a
+// bar there are visited in sorted order: first sells due at the open fill,
+// then pending buys fill at the open in priority order, then each bar's
+// signal is taken up, sells fill and the buys fill in priority order, and
+// finally holdings are marked at the close. The same data and config
+// always give the same result.
+func Run(data Data, cfg Config) (*Result, error) {
+	if cfg.Strategy == nil {
+		return nil, fmt.Errorf("no strategy")
+	}
+	cfg = cfg.withDefaults()
+	e := &engine{
+		cfg:       cfg,
+		data:      data,
+		symbols:   data.Symbols(),
+		cash:      cfg.Cash,
+		positions: make(map[string]*position),
+		pending:   make(map[string]order),
+		cursor:    make(map[string]int),
+		marks:     make(map[string]float64),
+		signals:   make(map[string]map[int]strategy.Signal),
+		res:       &Result{Config: cfg},
+	}
+	if err := e.scan(); err != nil {
+		return nil, err
+	}
+	for _, ts := range data.timeline() {
+		if e.err != nil {
+			return nil, e.err
+		}
+		if cfg.End > 0 && ts >= cfg.End {
+			break
+		}
+		var active []string
+		for _, symbol := range e.symbols {
+			bars := data[symbol]
+			i := e.cursor[symbol]
+			if i >= len(bars) || bars[i].Timestamp != ts {
+				continue
+			}
+			e.cursor[symbol] = i + 1
+			active = append(active, symbol)
+		}
+		var buys []entry
+		for _, symbol := range active {
+			if b, ok := e.open(symbol); ok {
+				buys = append(buys, b)
+			}
+		}
+		e.enter(buys)
+		if ts < cfg.Start {
+			continue
+		}
+		buys = buys[:0]
+		for _, symbol := range active {
+			if b, ok := e.check(symbol); ok {
+				buys = append(buys, b)
+			}
+		}
+		e.enter(buys)
+		e.mark(ts)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.closeAll()
+	if n := len(e.res.Equity); n > 0 {
+		// 期末平仓的费用算进最后一个权益点
+		e.res.Equity[n-1].Cash, e.res.Equity[n-1].Holdings = e.cash, 0
+	}
+	sort.SliceStable(e.res.Trades, func(i, j int) bool {
+		a, b := e.res.Trades[i], e.res.Trades[j]
+		if a.EntryTime != b.EntryTime {
+			return a.EntryTime < b.EntryTime
+		}
+		return a.Symbol < b.Symbol
+	})
+	return e.res, nil
+}
+
+// open sells what is due at the open of symbol's current bar and returns
+// its pending buy, if any.
+func (e *engine) open(symbol string) (entry, bool) {
+	bar, i := e.lastBar(symbol)
+	var buy entry
+	pendingBuy := false
+	if o, ok := e.pending[symbol]; ok {
+		delete(e.pending, symbol)
+		switch o.direction {
+		case strategy.Buy:
+			buy, pendingBuy = entry{symbol: symbol, i: i, price: bar.Open, sig: o.sig}, true
+		case strategy.Sell:
+			if !e.sell(symbol, i, bar.Open, "signal") {
+				// 卖不出去（跌停或T+1）就留到下一根再试
+				e.pending[symbol] = o
+			}
+		}
+	}
+	if p, ok := e.positions[symbol]; ok && e.cfg.HoldBars > 0 && i-p.entryIndex >= e.cfg.HoldBars {
+		e.sell(symbol, i, bar.Open, "hold")
+	}
+	if p, ok := e.positions[symbol]; ok && e.cfg.Exit != nil {
+		if x, ok := e.exit(symbol, p, e.data[symbol], i); ok && x.Phase == strategy.AtOpen {
+			e.sell(symbol, i, x.Price, x.Rule)
+		}
+	}
+	return buy, pendingBuy
+}
+
+// check takes up the strategy's signal on symbol's current bar. Sells fill
+// right away; a buy to fill on this bar is returned for enter.
+func (e *engine) check(symbol string) (entry, bool) {
+	bars := e.data[symbol]
+	_, i := e.lastBar(symbol)
+	if p, ok := e.positions[symbol]; ok && e.cfg.Exit != nil {
+		// 开盘的退出已经在 open 里处理过了
+		if x, ok := e.exit(symbol, p, bars, i); ok && x.Phase != strategy.AtOpen && e.sell(symbol, i, x.Price, x.Rule) {
+			return entry{}, false
+		}
+	}
+	if _, holding := e.positions[symbol]; !holding && e.cfg.Universe != nil && !e.cfg.Universe.Contains(symbol, bars[i].Timestamp) {
+		// 当天不在股票池里只能卖不能买
+		return entry{}, false
+	}
+	sig, ok := e.signals[symbol][i]
+	if !ok {
+		return entry{}, false
+	}
+	_, holding := e.positions[symbol]
+	if sig.Direction == strategy.Buy && holding || sig.Direction == strategy.Sell && !holding {
+		return entry{}, false
+	}
+	if e.cfg.Fill == FillNextOpen {
+		e.pending[symbol] = order{direction: sig.Direction, sig: sig}
+		return entry{}, false
+	}
+	bar := bars[i]
+	if sig.Price < bar.Low || sig.Price > bar.High {
+		return entry{}, false
+	}
+	if sig.Direction == strategy.Sell {
+		e.sell(symbol, i, sig.Price, "signal")
+		return entry{}, false
+	}
+	return entry{symbol: symbol, i: i, price: sig.Price, sig: sig}, true
+}
+
+// enter fills buys best first by Config.Priority.
+func (e *engine) enter(buys []entry) {
+	if e.cfg.Priority != nil && len(buys) > 1 {
+		cands := make([]scoring.Candidate, len(buys))
+		for k, b := range buys {
+			history := known(e.data[b.symbol], b.sig.Index)
+			cands[k] = scoring.Candidate{
+				Symbol:   b.symbol,
+				Strategy: b.sig.Strategy,
+				Bars:     history,
+				Values:   b.sig.Values,
+				Periods:  scoring.DownPeriods(history),
+			}
+		}
+		ranked, err := scoring.Rank(cands, *e.cfg.Priority)
+		if err == nil {
+			order := make(map[string]int, len(ranked))
+			for k, r := range ranked {
+				order[r.Symbol] = k
+			}
+			sort.SliceStable(buys, func(a, b int) bool { return order[buys[a].symbol] < order[buys[b].symbol] })
+		}
+	}
+	for _, b := range buys {
+		e.buy(b.symbol, b.i, b.price, b.sig)
+	}
+}
+
+// limited reports whether price sits at the limit the order runs into:
+// limit-up for buys, limit-down for sells.
+func (e *engine) limited(symbol string, i int, direction strategy.Direction, price float64) bool {
+	prev, ok := e.prevClose(symbol, i)
+	if !ok || e.cfg.Market == nil {
+		return false
+	}
+	day := e.data[symbol][i].Time()
+	if cal, err := calendar.Get(e.cfg.Market.Name); err == nil {
+		day = day.In(cal.Location)
+	}
+	st := e.cfg.ST[symbol][day.Format("2006-01-02")]
+	up, down, ok := e.cfg.Market.Limits(symbol, day, st, prev)
+	if !ok {
+		return false
+	}
+	if direction == strategy.Buy {
+		return price >= up-0.005
+	}
+	return price <= down+0.005
+}
+
+// prevClose is the close of the trading day before bar i of symbol: the
+// previous bar's, or with Config.Calendar that of the last bar of an earlier
+// session day, so the bars after the lunch break keep the day's limits.
+func (e *engine) prevClose(symbol string, i int) (float64, bool) {
+	bars := e.data[symbol]
+	j := i - 1
+	if cal := e.cfg.Calendar; cal != nil {
+		day := cal.SessionDate(bars[i].Time())
+		for j >= 0 && cal.SessionDate(bars[j].Time()).Equal(day) {
+			j--
+		}
+	}
+	if j < 0 {
+		return 0, false
+	}
+	return bars[j].Close, true
+}
+
+func (e *engine) slip(direction strategy.Direction, price, qty float64, bar kline.Bar) float64 {
+	if e.cfg.Slippage == nil {
+		return price
+	}
+	return e.cfg.Slippage.Price(direction, price, qty, bar)
+}
+
+func (e *engine) reject(symbol string, ts int64, direction strategy.Direction, reason string) {
+	e.res.Rejects = append(e.res.Rejects, Reject{Symbol: symbol, Time: ts, Direction: direction, Reason: reason})
+}
+
+func (e *engine) buy(symbol string, i int, price float64, sig strategy.Signal) {
+	bar := e.data[symbol][i]
+	if _, ok := e.positions[symbol]; ok || price <= 0 {
+		return
+	}
+	if e.cfg.MaxPositions > 0 && len(e.positions) >= e.cfg.MaxPositions {
+		e.reject(symbol, bar.Timestamp, strategy.Buy, "max-positions")
+		return
+	}
+	if e.limited(symbol, i, strategy.Buy, price) {
+		e.reject(symbol, bar.Timestamp, strategy.Buy, "limit-up")
+		return
+	}
+	equity := e.equity()
+	stake := e.cfg.Sizer.Size(Sizing{Equity: equity, Cash: e.cash, Price: price, History: known(e.data[symbol], i-1)})
+	if e.cfg.MaxPerSymbol > 0 {
+		stake = min(stake, e.cfg.MaxPerSymbol*equity)
+	}
+	if stake <= 0 {
+		e.reject(symbol, bar.Timestamp, strategy.Buy, "size")
+		return
+	}
+	stake = min(stake, e.cash)
+	m := e.cfg.Market
+	qty := m.Lots(stake / price)
+	fill := e.slip(strategy.Buy, price, qty, bar)
+	fee := m.Fee(strategy.Buy, fill, qty)
+	// 手续费和滑点可能让资金不够，按手往下减
+	step := 1.0
+	if m != nil && m.LotSize > 0 {
+		step = m.LotSize
+	}
+	for qty > 0 && qty*fill+fee > e.cash {
+		if m == nil {
+			qty = e.cash / fill
+			break
+		}
+		qty -= step
+		fee = m.Fee(strategy.Buy, fill, qty)
+	}
+	if qty <= 0 {
+		e.reject(symbol, bar.Timestamp, strategy.Buy, "cash")
+		return
+	}
+	e.cash -= qty*fill + fee
+	e.positions[symbol] = &position{
+		qty:        qty,
+		entryTime:  bar.Timestamp,
+		entryPrice: fill,
+		entryIndex: i,
+		entryFee:   fee,
+		signal:     sig.Values,
+	}
+	e.res.Fills = append(e.res.Fills, Fill{Symbol: symbol, Direction: strategy.Buy, Time: bar.Timestamp, Price: fill, Qty: qty, Fee: fee})
+}
+
+// sell closes the position at price and reports whether it could. Closing
+// at the end of the data ignores settlement and limits.
+func (e *engine) sell(symbol string, i int, price float64, reason string) bool {
+	p, ok := e.positions[symbol]
+	if !ok {
+		return false
+	}
+	bar := e.data[symbol][i]
+	if reason != "end" {
+		if !e.cfg.Market.Settled(p.entryTime, bar.Timestamp) {
+			e.reject(symbol, bar.Timestamp, strategy.Sell, "settlement")
+			return false
+		}
+		if e.limited(symbol, i, strategy.Sell, price) {
+			e.reject(symbol, bar.Timestamp, strategy.Sell, "limit-down")
+			return false
+		}
+	}
+	fill := e.slip(strategy.Sell, price, p.qty, bar)
+	fee := e.cfg.Market.Fee(strategy.Sell, fill, p.qty)
+	delete(e.positions, symbol)
+	e.cash += p.qty*fill - fee
+	e.res.Fills = append(e.res.Fills, Fill{Symbol: symbol, Direction: strategy.Sell, Time: bar.Timestamp, Price: fill, Qty: p.qty, Fee: fee})
+	e.res.Trades = append(e.res.Trades, Trade{
+		Symbol:     symbol,
+		Strategy:   e.cfg.Strategy.Name(),
+		EntryTime:  p.entryTime,
+		EntryPrice: p.entryPrice,
+		ExitTime:   bar.Timestamp,
+		ExitPrice:  fill,
+		Qty:        p.qty,
+		Fees:       p.entryFee + fee,
+		Bars:       i - p.entryIndex,
+		Reason:     reason,
+		Signal:     p.signal,
+	})
+	return true
+}
+
+// lastBar is the latest bar of symbol the engine has reached.
+func (e *engine) lastBar(symbol string) (kline.Bar, int) {
+	i := e.cursor[symbol] - 1
+	return e.data[symbol][i], i
+}
+
+// equity is cash plus holdings at their latest marks.
+func (e *engine) equity() float64 {
+	res := e.cash
+	for _, symbol := range e.symbols {
+		p, ok := e.positions[symbol]
+		if !ok {
+			continue
+		}
+		price, ok := e.marks[symbol]
+		if !ok {
+			price = p.entryPrice
+		}
+		res += p.qty * price
+	}
+	return res
+}
+
+func (e *engine) mark(ts int64) {
+	holdings := 0.0
+	for _, symbol := range e.symbols {
+		p, ok := e.positions[symbol]
+		if !ok {
+			continue
+		}
+		bar, _ := e.lastBar(symbol)
+		e.marks[symbol] = bar.Close
+		holdings += p.qty * bar.Close
+	}
+	e.res.Equity = append(e.res.Equity, EquityPoint{Time: ts, Cash: e.cash, Holdings: holdings})
+}
+
+// closeAll sells what is still held at its last close.
+func (e *engine) closeAll() {
+	for _, symbol := range e.symbols {
+		if _, ok := e.positions[symbol]; !ok {
+			continue
+		}
+		bar, i := e.lastBar(symbol)
+		e.sell(symbol, i, bar.Close, "end")
+	}
+}
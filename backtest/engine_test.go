@@ -0,0 +1,109 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRunFills(t *testing.T) {
+	bars := cnDays(10, 11, 12, 13, 14)
+	tests := []struct {
+		name string
+		cfg  Config
+		// The single trade: entry bar and price, exit bar, price and reason.
+		entry, exit     int
+		entryPx, exitPx float64
+		reason          string
+		noTrade         bool
+	}{
+		{
+			name:  "signal price, hold one bar",
+			cfg:   Config{Strategy: signalOn{buys: indices(1)}, HoldBars: 1},
+			entry: 1, entryPx: 11, exit: 2, exitPx: 12, reason: "hold",
+		},
+		{
+			name:  "inside the bar's range",
+			cfg:   Config{Strategy: signalOn{buys: indices(1), Price: 10.9}, HoldBars: 2},
+			entry: 1, entryPx: 10.9, exit: 3, exitPx: 13, reason: "hold",
+		},
+		{
+			name:    "outside the bar's range",
+			cfg:     Config{Strategy: signalOn{buys: indices(1), Price: 5}},
+			noTrade: true,
+		},
+		{
+			name:  "next open",
+			cfg:   Config{Strategy: signalOn{buys: indices(1), sells: indices(3)}, Fill: FillNextOpen},
+			entry: 2, entryPx: 12, exit: 4, exitPx: 14, reason: "signal",
+		},
+		{
+			name:  "sell signal",
+			cfg:   Config{Strategy: signalOn{buys: indices(0), sells: indices(2)}},
+			entry: 0, entryPx: 10, exit: 2, exitPx: 12, reason: "signal",
+		},
+		{
+			name:  "held to the end",
+			cfg:   Config{Strategy: signalOn{buys: indices(2)}},
+			entry: 2, entryPx: 12, exit: 4, exitPx: 14, reason: "end",
+		},
+		{
+			name:    "before Start",
+			cfg:     Config{Strategy: signalOn{buys: indices(1)}, Start: bars[2].Timestamp},
+			noTrade: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Run(Data{"SH600000": bars}, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.noTrade {
+				if len(res.Trades) != 0 {
+					t.Fatalf("trades = %+v, want none", res.Trades)
+				}
+				return
+			}
+			if len(res.Trades) != 1 {
+				t.Fatalf("trades = %+v, want one", res.Trades)
+			}
+			tr := res.Trades[0]
+			if tr.EntryTime != bars[tt.entry].Timestamp || tr.EntryPrice != tt.entryPx {
+				t.Errorf("entry %d at %v, want bar %d at %v", tr.EntryTime, tr.EntryPrice, tt.entry, tt.entryPx)
+			}
+			if tr.ExitTime != bars[tt.exit].Timestamp || tr.ExitPrice != tt.exitPx || tr.Reason != tt.reason {
+				t.Errorf("exit at %v (%s), want bar %d at %v (%s)", tr.ExitPrice, tr.Reason, tt.exit, tt.exitPx, tt.reason)
+			}
+			if tr.Bars != tt.exit-tt.entry {
+				t.Errorf("held %d bars, want %d", tr.Bars, tt.exit-tt.entry)
+			}
+			// 默认每笔投入起始资金的十分之一，不收费用
+			if want := DefaultCash / 10 / tt.entryPx; math.Abs(tr.Qty-want) > 1e-9 {
+				t.Errorf("qty %v, want %v", tr.Qty, want)
+			}
+			last := res.Equity[len(res.Equity)-1]
+			if want := DefaultCash + tr.PnL(); math.Abs(last.Equity()-want) > 1e-6 {
+				t.Errorf("final equity %v, want %v", last.Equity(), want)
+			}
+		})
+	}
+}
+
+// TestRunSymbolOrder checks that buys on the same bar fill in symbol order
+// when there is only room for one.
+func TestRunSymbolOrder(t *testing.T) {
+	data := Data{
+		"SZ000001": cnDays(10, 11, 12),
+		"SH600000": cnDays(10, 11, 12),
+	}
+	res, err := Run(data, Config{Strategy: signalOn{buys: indices(1)}, MaxPositions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Trades) != 1 || res.Trades[0].Symbol != "SH600000" {
+		t.Fatalf("trades = %+v, want SH600000 only", res.Trades)
+	}
+	if len(res.Rejects) != 1 || res.Rejects[0].Symbol != "SZ000001" || res.Rejects[0].Reason != "max-positions" {
+		t.Errorf("rejects = %+v, want SZ000001 max-positions", res.Rejects)
+	}
+}
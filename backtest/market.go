@@ -0,0 +1,240 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/strategy"
+)
+
+// Market holds an exchange's fees and trading rules. A nil *Market in
+// Config trades without costs or restrictions.
+type Market struct {
+	// Name is the calendar the settlement rule uses, "cn" or "us".
+	Name string
+	// CommissionRate is charged on the traded value, at least MinCommission.
+	CommissionRate float64
+	MinCommission  float64
+	// PerShare is a commission per share, at least MinPerOrder and at most
+	// MaxPerOrderRate of the traded value when that is set.
+	PerShare        float64
+	MinPerOrder     float64
+	MaxPerOrderRate float64
+	// SellTaxRate is charged on the value of sells only: stamp duty in
+	// China, the SEC fee in the US.
+	SellTaxRate float64
+	// TransferRate is charged on the value of both sides.
+	TransferRate float64
+	// LotSize is the share count orders are rounded down to.
+	LotSize float64
+	// SettleDays is how many sessions must pass before shares bought can be
+	// sold: 1 for T+1, 0 to allow selling the same day.
+	SettleDays int
+	// PriceLimits blocks buys at the limit-up price and sells at the
+	// limit-down price.
+	PriceLimits bool
+}
+
+// CN is the A-share market: 万2.5 commission with a 5 yuan minimum, 0.05%
+// stamp duty on sells, 0.001% transfer fee, 100-share lots, T+1 and daily
+// price limits.
+var CN = &Market{
+	Name:           "cn",
+	CommissionRate: 0.00025,
+	MinCommission:  5,
+	SellTaxRate:    0.0005,
+	TransferRate:   0.00001,
+	LotSize:        100,
+	SettleDays:     1,
+	PriceLimits:    true,
+}
+
+// US is a per-share broker: $0.005 a share, $1 minimum, capped at 1% of the
+// trade, plus the SEC fee on sells.
+var US = &Market{
+	Name:            "us",
+	PerShare:        0.005,
+	MinPerOrder:     1,
+	MaxPerOrderRate: 0.01,
+	SellTaxRate:     0.0000278,
+	LotSize:         1,
+}
+
+// MarketFor returns the rules for a market name.
+func MarketFor(name string) (*Market, error) {
+	switch name {
+	case "cn":
+		return CN, nil
+	case "us":
+		return US, nil
+	}
+	return nil, fmt.Errorf("no cost model for market %q", name)
+}
+
+// Fee is what an order of qty shares at price costs.
+func (m *Market) Fee(direction strategy.Direction, price, qty float64) float64 {
+	if m == nil || qty == 0 {
+		return 0
+	}
+	value := price * qty
+	fee := 0.0
+	if m.CommissionRate > 0 {
+		fee += math.Max(value*m.CommissionRate, m.MinCommission)
+	}
+	if m.PerShare > 0 {
+		c := math.Max(qty*m.PerShare, m.MinPerOrder)
+		if m.MaxPerOrderRate > 0 {
+			c = math.Min(c, value*m.MaxPerOrderRate)
+		}
+		fee += c
+	}
+	if direction == strategy.Sell {
+		fee += value * m.SellTaxRate
+	}
+	fee += value * m.TransferRate
+	return fee
+}
+
+// Lots rounds qty down to whole lots.
+func (m *Market) Lots(qty float64) float64 {
+	if m == nil || m.LotSize <= 0 {
+		return qty
+	}
+	return math.Floor(qty/m.LotSize) * m.LotSize
+}
+
+// Settled reports whether shares bought at entry may be sold at t.
+func (m *Market) Settled(entry, t int64) bool {
+	if m == nil || m.SettleDays == 0 {
+		return true
+	}
+	cal, err := calendar.Get(m.Name)
+	if err != nil {
+		return true
+	}
+	due := cal.SessionDate(time.UnixMilli(entry))
+	for n := 0; n < m.SettleDays; {
+		due = due.AddDate(0, 0, 1)
+		if cal.IsTradingDay(due) {
+			n++
+		}
+	}
+	return !cal.SessionDate(time.UnixMilli(t)).Before(due)
+}
+
+// Limits returns the limit-up and limit-down prices for a bar on day whose
+// previous close is prevClose, rounded to the cent. st marks a symbol under
+// risk warning that day. ok is false when the market has no limits. These
+// are the exchange rules as far as the symbol and its ST status tell them;
+// new listings' unlimited first days are not modelled.
+func (m *Market) Limits(symbol string, day time.Time, st bool, prevClose float64) (up, down float64, ok bool) {
+	if m == nil || !m.PriceLimits || prevClose <= 0 {
+		return 0, 0, false
+	}
+	pct := limitPct(symbol, day, st)
+	up = math.Round(prevClose*(1+pct)*100) / 100
+	down = math.Round(prevClose*(1-pct)*100) / 100
+	return up, down, true
+}
+
+// stWiden is the day the Shanghai and Shenzhen main boards raised the limit
+// of ST stocks from 5% to 10%.
+var stWiden = time.Date(2025, 7, 7, 0, 0, 0, 0, calendar.CN.Location)
+
+// limitPct is the daily limit of an A-share symbol such as SZ300750: 20%
+// on ChiNext and STAR, 30% on the Beijing exchange, 10% elsewhere, and 5%
+// for main board ST stocks before stWiden.
+func limitPct(symbol string, day time.Time, st bool) float64 {
+	code := strings.TrimLeft(symbol, "SHZBJshzbj")
+	switch {
+	case strings.HasPrefix(symbol, "BJ"):
+		return 0.3
+	case strings.HasPrefix(code, "300"), strings.HasPrefix(code, "301"),
+		strings.HasPrefix(code, "688"), strings.HasPrefix(code, "689"):
+		return 0.2
+	case st && day.Before(stWiden):
+		return 0.05
+	}
+	return 0.1
+}
+
+// ST lists the days each symbol traded under risk warning, keyed by symbol
+// and then by the day as 2006-01-02 in the market's time zone.
+type ST map[string]map[string]bool
+
+// IsST reports whether a name marks a risk-warning stock: ST, *ST or S*ST.
+func IsST(name string) bool {
+	return strings.Contains(name, "ST")
+}
+
+// Slippage moves a fill price against the order.
+type Slippage interface {
+	// Price returns what an order of qty shares actually pays or gets for
+	// price on bar.
+	Price(direction strategy.Direction, price, qty float64, bar kline.Bar) float64
+}
+
+// FixedSlippage is a fixed amount per share.
+type FixedSlippage float64
+
+func (s FixedSlippage) Price(direction strategy.Direction, price, qty float64, bar kline.Bar) float64 {
+	return against(direction, price, float64(s))
+}
+
+// PercentSlippage is a fraction of the price.
+type PercentSlippage float64
+
+func (s PercentSlippage) Price(direction strategy.Direction, price, qty float64, bar kline.Bar) float64 {
+	return against(direction, price, price*float64(s))
+}
+
+// VolumeSlippage grows with the order's share of the bar's volume: the
+// price moves by Impact times the participation rate, as a fraction of the
+// price. A bar without volume gets no slippage.
+type VolumeSlippage struct {
+	Impact float64
+}
+
+func (s VolumeSlippage) Price(direction strategy.Direction, price, qty float64, bar kline.Bar) float64 {
+	if bar.Volume <= 0 {
+		return price
+	}
+	return against(direction, price, price*s.Impact*qty/bar.Volume)
+}
+
+func against(direction strategy.Direction, price, amount float64) float64 {
+	if direction == strategy.Sell {
+		return price - amount
+	}
+	return price + amount
+}
+
+// ParseSlippage reads a slippage model written as fixed:0.01, pct:0.001 or
+// volume:0.1. An empty string is no slippage.
+func ParseSlippage(s string) (Slippage, error) {
+	if s == "" {
+		return nil, nil
+	}
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("slippage %q: want kind:value", s)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("slippage %q: %w", s, err)
+	}
+	switch kind {
+	case "fixed":
+		return FixedSlippage(v), nil
+	case "pct":
+		return PercentSlippage(v), nil
+	case "volume":
+		return VolumeSlippage{Impact: v}, nil
+	}
+	return nil, fmt.Errorf("slippage %q: unknown kind %q, want fixed, pct or volume", s, kind)
+}
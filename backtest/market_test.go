@@ -0,0 +1,228 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/strategy"
+)
+
+func cnTime(s string) int64 {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, calendar.CN.Location)
+	if err != nil {
+		panic(err)
+	}
+	return t.UnixMilli()
+}
+
+func TestLimits(t *testing.T) {
+	before := time.Date(2024, 3, 4, 0, 0, 0, 0, calendar.CN.Location)
+	after := time.Date(2025, 9, 1, 0, 0, 0, 0, calendar.CN.Location)
+	tests := []struct {
+		symbol    string
+		day       time.Time
+		st        bool
+		prev      float64
+		up, down  float64
+		hasLimits bool
+	}{
+		{"SH600000", before, false, 10, 11, 9, true},
+		{"SZ000001", before, false, 12.34, 13.57, 11.11, true},
+		{"SZ300750", before, false, 100, 120, 80, true},
+		{"SH688981", before, false, 50, 60, 40, true},
+		{"BJ830799", before, false, 10, 13, 7, true},
+		{"SH600000", before, false, 0, 0, 0, false},
+		{"SZ000004", before, true, 10, 10.5, 9.5, true},
+		{"SZ000004", after, true, 10, 11, 9, true},
+		{"SZ300313", before, true, 10, 12, 8, true},
+	}
+	for _, tt := range tests {
+		up, down, ok := CN.Limits(tt.symbol, tt.day, tt.st, tt.prev)
+		if ok != tt.hasLimits || math.Abs(up-tt.up) > 1e-9 || math.Abs(down-tt.down) > 1e-9 {
+			t.Errorf("Limits(%s, %s, st %v, %v) = %v, %v, %v; want %v, %v, %v", tt.symbol, tt.day.Format("2006-01-02"), tt.st, tt.prev, up, down, ok, tt.up, tt.down, tt.hasLimits)
+		}
+	}
+	if _, _, ok := US.Limits("AAPL", after, false, 100); ok {
+		t.Error("US has price limits")
+	}
+	for name, want := range map[string]bool{"*ST华仪": true, "ST易购": true, "S*ST前锋": true, "平安银行": false} {
+		if IsST(name) != want {
+			t.Errorf("IsST(%s) = %v", name, !want)
+		}
+	}
+}
+
+func TestSettled(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry, at string
+		want      bool
+	}{
+		{"same day", "2024-03-04 09:45", "2024-03-04 14:45", false},
+		{"next day", "2024-03-04 14:45", "2024-03-05 09:45", true},
+		{"over the weekend", "2024-03-08 14:45", "2024-03-11 09:45", true},
+		{"over the National Day holiday", "2024-09-30 10:00", "2024-10-08 09:45", true},
+	}
+	for _, tt := range tests {
+		if got := CN.Settled(cnTime(tt.entry), cnTime(tt.at)); got != tt.want {
+			t.Errorf("%s: CN.Settled = %v, want %v", tt.name, got, tt.want)
+		}
+		if !US.Settled(cnTime(tt.entry), cnTime(tt.at)) {
+			t.Errorf("%s: US is not settled", tt.name)
+		}
+	}
+}
+
+func TestLots(t *testing.T) {
+	res, err := Run(Data{"SH600000": cnDays(10.37, 10.5, 10.6)}, Config{Strategy: signalOn{buys: indices(0)}, Market: CN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buy := res.Fills[0]
+	// 一万块按 10.37 元买，向下取整到 900 股
+	if buy.Qty != 900 {
+		t.Errorf("bought %v shares, want 900", buy.Qty)
+	}
+	if want := 5 + 900*10.37*0.00001; math.Abs(buy.Fee-want) > 1e-9 {
+		t.Errorf("buy fee %v, want %v", buy.Fee, want)
+	}
+	if got := CN.Lots(1234); got != 1200 {
+		t.Errorf("CN.Lots(1234) = %v", got)
+	}
+	if got := US.Lots(12.7); got != 12 {
+		t.Errorf("US.Lots(12.7) = %v", got)
+	}
+}
+
+// bars15m builds 15-minute A-share bars at the given times, each opening
+// and closing at its price.
+func bars15m(times []string, prices []float64) []kline.Bar {
+	bars := make([]kline.Bar, len(times))
+	for i, s := range times {
+		p := prices[i]
+		bars[i] = kline.Bar{Timestamp: cnTime(s), Open: p, High: p, Low: p, Close: p, Volume: 1e6}
+	}
+	return bars
+}
+
+func TestT1(t *testing.T) {
+	bars := bars15m(
+		[]string{"2024-03-04 09:45", "2024-03-04 10:00", "2024-03-05 09:45", "2024-03-05 10:00"},
+		[]float64{10, 10.2, 10.3, 10.4},
+	)
+	s := signalOn{buys: indices(0), sells: indices(1, 2)}
+	res, err := Run(Data{"SH600000": bars}, Config{Strategy: s, Market: CN, Calendar: calendar.CN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rejects) != 1 || res.Rejects[0].Reason != "settlement" || res.Rejects[0].Time != bars[1].Timestamp {
+		t.Errorf("rejects = %+v, want the same-day sell refused", res.Rejects)
+	}
+	if len(res.Trades) != 1 || res.Trades[0].ExitTime != bars[2].Timestamp || res.Trades[0].Reason != "signal" {
+		t.Fatalf("trades = %+v, want a sell the next morning", res.Trades)
+	}
+	// 美股没有 T+1，当天就能卖
+	res, err = Run(Data{"AAPL": bars}, Config{Strategy: s, Market: US, Calendar: calendar.CN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Trades) != 1 || res.Trades[0].ExitTime != bars[1].Timestamp {
+		t.Errorf("US trades = %+v, want a same-day sell", res.Trades)
+	}
+}
+
+func TestPriceLimits(t *testing.T) {
+	day := func(open, close float64) kline.Bar {
+		return kline.Bar{Open: open, High: math.Max(open, close), Low: math.Min(open, close), Close: close, Volume: 1e6}
+	}
+	days := func(bars ...kline.Bar) []kline.Bar {
+		ts := cnDays(make([]float64, len(bars))...)
+		for i := range bars {
+			bars[i].Timestamp = ts[i].Timestamp
+		}
+		return bars
+	}
+
+	t.Run("buy at limit-up", func(t *testing.T) {
+		bars := days(day(10, 10), day(11, 11), day(11.5, 11.5))
+		res, err := Run(Data{"SH600000": bars}, Config{Strategy: signalOn{buys: indices(0)}, Fill: FillNextOpen, Market: CN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Trades) != 0 || len(res.Rejects) != 1 || res.Rejects[0].Reason != "limit-up" {
+			t.Errorf("trades %+v, rejects %+v; want the buy refused at limit-up", res.Trades, res.Rejects)
+		}
+	})
+	t.Run("ChiNext is not at its limit at 10%", func(t *testing.T) {
+		bars := days(day(10, 10), day(11, 11), day(11.5, 11.5))
+		res, err := Run(Data{"SZ300750": bars}, Config{Strategy: signalOn{buys: indices(0)}, Fill: FillNextOpen, Market: CN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rejects) != 0 || len(res.Trades) != 1 || res.Trades[0].EntryPrice != 11 {
+			t.Errorf("trades %+v, rejects %+v; want a buy at 11", res.Trades, res.Rejects)
+		}
+	})
+	t.Run("sell at limit-down waits", func(t *testing.T) {
+		bars := days(day(10, 10), day(10, 10), day(9, 9), day(8.5, 8.6), day(8.8, 8.8))
+		s := signalOn{buys: indices(0), sells: indices(1)}
+		res, err := Run(Data{"SH600000": bars}, Config{Strategy: s, Fill: FillNextOpen, Market: CN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 第 3 根开在跌停价 9.00 卖不掉，第 4 根的开盘价离跌停 8.10 还远
+		if len(res.Rejects) != 1 || res.Rejects[0].Reason != "limit-down" || res.Rejects[0].Time != bars[2].Timestamp {
+			t.Errorf("rejects = %+v, want one limit-down on bar 2", res.Rejects)
+		}
+		if len(res.Trades) != 1 || res.Trades[0].ExitTime != bars[3].Timestamp || res.Trades[0].ExitPrice != 8.5 {
+			t.Errorf("trades = %+v, want a sell at 8.5 on bar 3", res.Trades)
+		}
+	})
+	t.Run("ST stock at its 5% limit", func(t *testing.T) {
+		bars := days(day(10, 10), day(10.5, 10.5), day(10.8, 10.8))
+		st := ST{"SZ000004": {time.UnixMilli(bars[1].Timestamp).In(calendar.CN.Location).Format("2006-01-02"): true}}
+		res, err := Run(Data{"SZ000004": bars}, Config{Strategy: signalOn{buys: indices(0)}, Fill: FillNextOpen, Market: CN, ST: st})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Trades) != 0 || len(res.Rejects) != 1 || res.Rejects[0].Reason != "limit-up" {
+			t.Errorf("trades %+v, rejects %+v; want the buy refused at the ST limit-up", res.Trades, res.Rejects)
+		}
+	})
+	t.Run("no limits without a market", func(t *testing.T) {
+		bars := days(day(10, 10), day(11, 11), day(11.5, 11.5))
+		res, err := Run(Data{"SH600000": bars}, Config{Strategy: signalOn{buys: indices(0)}, Fill: FillNextOpen})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Rejects) != 0 || len(res.Trades) != 1 {
+			t.Errorf("trades %+v, rejects %+v; want a free buy", res.Trades, res.Rejects)
+		}
+	})
+}
+
+func TestFee(t *testing.T) {
+	tests := []struct {
+		name      string
+		m         *Market
+		direction strategy.Direction
+		price     float64
+		qty       float64
+		want      float64
+	}{
+		{"cn minimum commission", CN, strategy.Buy, 10, 100, 5 + 1000*0.00001},
+		{"cn sell pays stamp duty", CN, strategy.Sell, 10, 10000, 100000*0.00025 + 100000*0.0005 + 100000*0.00001},
+		{"us minimum per order", US, strategy.Buy, 100, 10, 1},
+		{"us per share", US, strategy.Buy, 100, 1000, 5},
+		{"us capped at 1%", US, strategy.Buy, 0.1, 10000, 10},
+		{"no market", nil, strategy.Sell, 10, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Fee(tt.direction, tt.price, tt.qty); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Fee = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
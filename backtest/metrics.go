@@ -0,0 +1,392 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// TradingDays is the number of trading days used to annualize.
+const TradingDays = 252
+
+// Metrics summarises a run. Return based figures use the equity curve taken
+// at the last point of each day, the trading day by Config.Calendar or else
+// the local calendar day, so daily and intraday runs annualize the same
+// way; the risk-free rate is taken as zero.
+type Metrics struct {
+	Start, End  time.Time
+	StartEquity float64
+	EndEquity   float64
+	TotalReturn float64
+	CAGR        float64
+	// Volatility is the annualized standard deviation of daily returns.
+	Volatility float64
+	Sharpe     float64
+	Sortino    float64
+	// MaxDrawdown is the deepest fall from a peak, as a positive fraction.
+	MaxDrawdown float64
+	// DrawdownPeak and DrawdownTrough bound the deepest drawdown, and
+	// DrawdownDuration is the longest time spent below a previous peak.
+	DrawdownPeak     time.Time
+	DrawdownTrough   time.Time
+	DrawdownDuration time.Duration
+
+	Trades  int
+	Wins    int
+	Losses  int
+	WinRate float64
+	// ProfitFactor is gross profit over gross loss; +Inf without losses.
+	ProfitFactor float64
+	// Expectancy is the mean profit per trade in cash, ExpectedReturn the
+	// mean return per trade.
+	Expectancy     float64
+	ExpectedReturn float64
+	AvgWin         float64
+	AvgLoss        float64
+	AvgHolding     time.Duration
+	AvgBars        float64
+	// Exposure is the share of equity points with a position open.
+	Exposure float64
+
+	// Benchmark compares the run with Config.Benchmark; nil without one.
+	Benchmark *Relative
+
+	Years   []Group
+	Months  []Group
+	Symbols []Group
+}
+
+// Group is one row of a breakdown. Trades are counted by exit time for the
+// calendar breakdowns. Return is the equity return over the period and is
+// left zero for the symbol breakdown.
+type Group struct {
+	Key       string
+	Trades    int
+	Wins      int
+	PnL       float64
+	AvgReturn float64
+	Return    float64
+}
+
+// WinRate is the share of the group's trades that made money.
+func (g Group) WinRate() float64 {
+	if g.Trades == 0 {
+		return 0
+	}
+	return float64(g.Wins) / float64(g.Trades)
+}
+
+// Metrics computes the statistics of r.
+func (r *Result) Metrics() Metrics {
+	m := Metrics{StartEquity: r.Config.Cash, EndEquity: r.FinalEquity()}
+	m.TotalReturn = m.EndEquity/m.StartEquity - 1
+	if len(r.Equity) > 0 {
+		m.Start = time.UnixMilli(r.Equity[0].Time)
+		m.End = time.UnixMilli(r.Equity[len(r.Equity)-1].Time)
+	}
+	r.returnStats(&m)
+	r.drawdown(&m)
+	r.tradeStats(&m)
+	r.relative(&m)
+	m.Years = r.breakdown("2006")
+	m.Months = r.breakdown("2006-01")
+	m.Symbols = r.bySymbol()
+	return m
+}
+
+// day is the day ts counts towards: its session date with Config.Calendar,
+// else its local time.
+func (r *Result) day(ts int64) time.Time {
+	if cal := r.Config.Calendar; cal != nil {
+		return cal.SessionDate(time.UnixMilli(ts))
+	}
+	return time.UnixMilli(ts)
+}
+
+// daily is the equity at the last point of each day, preceded by the
+// starting equity.
+func (r *Result) daily(start float64) []float64 {
+	res := []float64{start}
+	day := ""
+	for _, p := range r.Equity {
+		d := r.day(p.Time).Format("2006-01-02")
+		if d == day {
+			res[len(res)-1] = p.Equity()
+			continue
+		}
+		day = d
+		res = append(res, p.Equity())
+	}
+	return res
+}
+
+func (r *Result) returnStats(m *Metrics) {
+	years := m.End.Sub(m.Start).Hours() / 24 / 365.25
+	if years > 0 && m.EndEquity > 0 {
+		m.CAGR = math.Pow(m.EndEquity/m.StartEquity, 1/years) - 1
+	}
+	eq := r.daily(m.StartEquity)
+	if len(eq) < 3 {
+		return
+	}
+	rets := make([]float64, 0, len(eq)-1)
+	for i := 1; i < len(eq); i++ {
+		rets = append(rets, eq[i]/eq[i-1]-1)
+	}
+	mean, sd := meanStd(rets)
+	down := 0.0
+	for _, v := range rets {
+		if v < 0 {
+			down += v * v
+		}
+	}
+	down = math.Sqrt(down / float64(len(rets)))
+	scale := math.Sqrt(TradingDays)
+	m.Volatility = sd * scale
+	if sd > 0 {
+		m.Sharpe = mean / sd * scale
+	}
+	if down > 0 {
+		m.Sortino = mean / down * scale
+	}
+}
+
+func (r *Result) drawdown(m *Metrics) {
+	if len(r.Equity) == 0 {
+		return
+	}
+	peak, peakAt := m.StartEquity, r.Equity[0].Time
+	underSince := int64(-1)
+	for _, p := range r.Equity {
+		eq := p.Equity()
+		if eq >= peak {
+			if underSince >= 0 {
+				m.DrawdownDuration = max(m.DrawdownDuration, time.Duration(p.Time-underSince)*time.Millisecond)
+				underSince = -1
+			}
+			peak, peakAt = eq, p.Time
+			continue
+		}
+		if underSince < 0 {
+			underSince = peakAt
+		}
+		if dd := 1 - eq/peak; dd > m.MaxDrawdown {
+			m.MaxDrawdown = dd
+			m.DrawdownPeak = time.UnixMilli(peakAt)
+			m.DrawdownTrough = time.UnixMilli(p.Time)
+		}
+	}
+	if underSince >= 0 {
+		last := r.Equity[len(r.Equity)-1].Time
+		m.DrawdownDuration = max(m.DrawdownDuration, time.Duration(last-underSince)*time.Millisecond)
+	}
+}
+
+func (r *Result) tradeStats(m *Metrics) {
+	var profit, loss, pnl, ret, bars float64
+	var holding time.Duration
+	for _, t := range r.Trades {
+		m.Trades++
+		v := t.PnL()
+		pnl += v
+		ret += t.Return()
+		bars += float64(t.Bars)
+		holding += time.Duration(t.ExitTime-t.EntryTime) * time.Millisecond
+		if t.Win() {
+			m.Wins++
+			profit += v
+		} else {
+			m.Losses++
+			loss -= v
+		}
+	}
+	if m.Trades > 0 {
+		n := float64(m.Trades)
+		m.WinRate = float64(m.Wins) / n
+		m.Expectancy = pnl / n
+		m.ExpectedReturn = ret / n
+		m.AvgBars = bars / n
+		m.AvgHolding = holding / time.Duration(m.Trades)
+	}
+	if m.Wins > 0 {
+		m.AvgWin = profit / float64(m.Wins)
+	}
+	if m.Losses > 0 {
+		m.AvgLoss = -loss / float64(m.Losses)
+	}
+	switch {
+	case loss > 0:
+		m.ProfitFactor = profit / loss
+	case profit > 0:
+		m.ProfitFactor = math.Inf(1)
+	}
+	in := 0
+	for _, p := range r.Equity {
+		if p.Holdings != 0 {
+			in++
+		}
+	}
+	if len(r.Equity) > 0 {
+		m.Exposure = float64(in) / float64(len(r.Equity))
+	}
+}
+
+// breakdown groups trades by exit time and the equity curve by the period
+// layout formats to, e.g. "2006" for years.
+func (r *Result) breakdown(layout string) []Group {
+	groups := make(map[string]*Group)
+	var keys []string
+	get := func(key string) *Group {
+		g, ok := groups[key]
+		if !ok {
+			g = &Group{Key: key}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		return g
+	}
+	prev := r.Config.Cash
+	for i, p := range r.Equity {
+		key := r.day(p.Time).Format(layout)
+		g := get(key)
+		last := i == len(r.Equity)-1 || r.day(r.Equity[i+1].Time).Format(layout) != key
+		if last {
+			g.Return = p.Equity()/prev - 1
+			prev = p.Equity()
+		}
+	}
+	for _, t := range r.Trades {
+		addTrade(get(r.day(t.ExitTime).Format(layout)), t)
+	}
+	sort.Strings(keys)
+	return finish(groups, keys)
+}
+
+func (r *Result) bySymbol() []Group {
+	groups := make(map[string]*Group)
+	var keys []string
+	for _, t := range r.Trades {
+		g, ok := groups[t.Symbol]
+		if !ok {
+			g = &Group{Key: t.Symbol}
+			groups[t.Symbol] = g
+			keys = append(keys, t.Symbol)
+		}
+		addTrade(g, t)
+	}
+	res := finish(groups, keys)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].PnL > res[j].PnL })
+	return res
+}
+
+func addTrade(g *Group, t Trade) {
+	g.Trades++
+	if t.Win() {
+		g.Wins++
+	}
+	g.PnL += t.PnL()
+	// summed here, divided in finish
+	g.AvgReturn += t.Return()
+}
+
+func finish(groups map[string]*Group, keys []string) []Group {
+	res := make([]Group, 0, len(keys))
+	for _, k := range keys {
+		g := *groups[k]
+		if g.Trades > 0 {
+			g.AvgReturn /= float64(g.Trades)
+		}
+		res = append(res, g)
+	}
+	return res
+}
+
+func meanStd(v []float64) (mean, sd float64) {
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	for _, x := range v {
+		sd += (x - mean) * (x - mean)
+	}
+	if len(v) > 1 {
+		sd = math.Sqrt(sd / float64(len(v)-1))
+	}
+	return mean, sd
+}
+
+// WriteReport prints m as aligned tables. symbols caps the symbol
+// breakdown, best and worst by profit, 0 for all.
+func (m Metrics) WriteReport(out io.Writer, symbols int) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	pct := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+	day := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02")
+	}
+	rows := [][2]string{
+		{"period", day(m.Start) + " ~ " + day(m.End)},
+		{"equity", fmt.Sprintf("%.2f -> %.2f", m.StartEquity, m.EndEquity)},
+		{"total return", pct(m.TotalReturn)},
+		{"CAGR", pct(m.CAGR)},
+		{"volatility", pct(m.Volatility)},
+		{"Sharpe", fmt.Sprintf("%.2f", m.Sharpe)},
+		{"Sortino", fmt.Sprintf("%.2f", m.Sortino)},
+		{"max drawdown", fmt.Sprintf("%s (%s ~ %s)", pct(m.MaxDrawdown), day(m.DrawdownPeak), day(m.DrawdownTrough))},
+		{"longest drawdown", formatDuration(m.DrawdownDuration)},
+		{"trades", fmt.Sprintf("%d (%d won, %d lost)", m.Trades, m.Wins, m.Losses)},
+		{"win rate", pct(m.WinRate)},
+		{"profit factor", fmt.Sprintf("%.2f", m.ProfitFactor)},
+		{"expectancy", fmt.Sprintf("%.2f (%s)", m.Expectancy, pct(m.ExpectedReturn))},
+		{"avg win / loss", fmt.Sprintf("%.2f / %.2f", m.AvgWin, m.AvgLoss)},
+		{"avg holding", fmt.Sprintf("%s (%.1f bars)", formatDuration(m.AvgHolding), m.AvgBars)},
+		{"exposure", pct(m.Exposure)},
+	}
+	if b := m.Benchmark; b != nil {
+		rows = append(rows, [][2]string{
+			{"benchmark", fmt.Sprintf("%s %s (CAGR %s)", b.Benchmark, pct(b.Return), pct(b.CAGR))},
+			{"excess return", pct(b.Excess)},
+			{"alpha / beta", fmt.Sprintf("%s / %.2f", pct(b.Alpha), b.Beta)},
+			{"correlation", fmt.Sprintf("%.2f", b.Correlation)},
+			{"tracking error", pct(b.TrackingError)},
+			{"information ratio", fmt.Sprintf("%.2f", b.InformationRatio)},
+		}...)
+	}
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\n", r[0], r[1])
+	}
+	table := func(title string, groups []Group, withReturn bool) {
+		fmt.Fprintf(w, "\n%s\ttrades\twin rate\tpnl\tavg return", title)
+		if withReturn {
+			fmt.Fprint(w, "\treturn")
+		}
+		fmt.Fprintln(w)
+		for _, g := range groups {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%.2f\t%s", g.Key, g.Trades, pct(g.WinRate()), g.PnL, pct(g.AvgReturn))
+			if withReturn {
+				fmt.Fprintf(w, "\t%s", pct(g.Return))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	table("year", m.Years, true)
+	table("month", m.Months, true)
+	bySymbol := m.Symbols
+	if symbols > 0 && len(bySymbol) > 2*symbols {
+		bySymbol = append(bySymbol[:symbols:symbols], bySymbol[len(bySymbol)-symbols:]...)
+	}
+	table("symbol", bySymbol, false)
+	return w.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%.1fd", d.Hours()/24)
+	}
+	return d.Round(time.Minute).String()
+}
@@ -0,0 +1,106 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stock-backend/calendar"
+)
+
+func TestMetricsEquity(t *testing.T) {
+	days := []string{"2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05", "2024-01-08", "2024-01-09"}
+	curve := []float64{100, 110, 99, 88, 121, 110}
+	r := &Result{Config: Config{Cash: 100, Calendar: calendar.CN}}
+	for i, d := range days {
+		// 一天有多个点时只取最后一根 K 线的权益
+		r.Equity = append(r.Equity,
+			EquityPoint{Time: cnTime(d + " 10:00"), Cash: 100},
+			EquityPoint{Time: cnTime(d + " 14:45"), Cash: curve[i] - 50, Holdings: 50})
+	}
+	m := r.Metrics()
+
+	if !near(m.TotalReturn, 0.1) {
+		t.Errorf("total return %v, want 0.1", m.TotalReturn)
+	}
+	years := m.End.Sub(m.Start).Hours() / 24 / 365.25
+	if want := math.Pow(1.1, 1/years) - 1; !near(m.CAGR, want) {
+		t.Errorf("CAGR %v, want %v", m.CAGR, want)
+	}
+
+	// 起始资金之后的日收益
+	rets := []float64{0, 0.1, -0.1, -1.0 / 9, 0.375, -1.0 / 11}
+	mean, ss, down := 0.0, 0.0, 0.0
+	for _, v := range rets {
+		mean += v / 6
+	}
+	for _, v := range rets {
+		ss += (v - mean) * (v - mean)
+		if v < 0 {
+			down += v * v
+		}
+	}
+	sd := math.Sqrt(ss / 5)
+	if want := mean / sd * math.Sqrt(252); !near(m.Sharpe, want) {
+		t.Errorf("Sharpe %v, want %v", m.Sharpe, want)
+	}
+	if want := mean / math.Sqrt(down/6) * math.Sqrt(252); !near(m.Sortino, want) {
+		t.Errorf("Sortino %v, want %v", m.Sortino, want)
+	}
+	if want := sd * math.Sqrt(252); !near(m.Volatility, want) {
+		t.Errorf("volatility %v, want %v", m.Volatility, want)
+	}
+
+	if !near(m.MaxDrawdown, 0.2) {
+		t.Errorf("max drawdown %v, want 0.2", m.MaxDrawdown)
+	}
+	if got := m.DrawdownPeak.UnixMilli(); got != cnTime("2024-01-03 14:45") {
+		t.Errorf("drawdown peak %v, want 2024-01-03 14:45", m.DrawdownPeak)
+	}
+	if got := m.DrawdownTrough.UnixMilli(); got != cnTime("2024-01-05 14:45") {
+		t.Errorf("drawdown trough %v, want 2024-01-05 14:45", m.DrawdownTrough)
+	}
+	// 01-03 的高点到 01-08 才收复
+	if m.DrawdownDuration != 5*24*time.Hour {
+		t.Errorf("drawdown duration %v, want 120h", m.DrawdownDuration)
+	}
+}
+
+func TestMetricsTrades(t *testing.T) {
+	trade := func(pnl float64) Trade {
+		return Trade{EntryPrice: 10, ExitPrice: 10 + pnl/100, Qty: 100}
+	}
+	tests := []struct {
+		name            string
+		pnls            []float64
+		wins, losses    int
+		profitFactor    float64
+		expectancy      float64
+		avgWin, avgLoss float64
+	}{
+		{"mixed", []float64{30, -10, 20, -5}, 2, 2, 50.0 / 15, 35.0 / 4, 25, -7.5},
+		{"no losses", []float64{30, 20}, 2, 0, math.Inf(1), 25, 25, 0},
+		{"no wins", []float64{-10, -30}, 0, 2, 0, -20, 0, -20},
+		{"break even counts as a loss", []float64{40, 0}, 1, 1, math.Inf(1), 20, 40, 0},
+		{"no trades", nil, 0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		r := &Result{Config: Config{Cash: 1000}}
+		for _, p := range tt.pnls {
+			r.Trades = append(r.Trades, trade(p))
+		}
+		m := r.Metrics()
+		if m.Trades != len(tt.pnls) || m.Wins != tt.wins || m.Losses != tt.losses {
+			t.Errorf("%s: %d trades %d won %d lost, want %d %d %d", tt.name, m.Trades, m.Wins, m.Losses, len(tt.pnls), tt.wins, tt.losses)
+		}
+		pfOK := near(m.ProfitFactor, tt.profitFactor) || math.IsInf(tt.profitFactor, 1) && math.IsInf(m.ProfitFactor, 1)
+		if !pfOK || !near(m.Expectancy, tt.expectancy) || !near(m.AvgWin, tt.avgWin) || !near(m.AvgLoss, tt.avgLoss) {
+			t.Errorf("%s: profit factor %v expectancy %v avg win %v loss %v, want %v %v %v %v",
+				tt.name, m.ProfitFactor, m.Expectancy, m.AvgWin, m.AvgLoss, tt.profitFactor, tt.expectancy, tt.avgWin, tt.avgLoss)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
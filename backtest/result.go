@@ -0,0 +1,115 @@
+package backtest
+
+import "stock-backend/strategy"
+
+// Fill is one executed order.
+type Fill struct {
+	Symbol    string
+	Direction strategy.Direction
+	Time      int64
+	Price     float64
+	Qty       float64
+	Fee       float64
+}
+
+// Reject is an order the market rules refused.
+type Reject struct {
+	Symbol    string
+	Time      int64
+	Direction strategy.Direction
+	// Reason is "limit-up", "limit-down", "settlement", "cash", "size" or
+	// "max-positions".
+	Reason string
+}
+
+// Trade is a closed round trip. Times are bar timestamps in unix
+// milliseconds.
+type Trade struct {
+	Symbol     string
+	Strategy   string
+	EntryTime  int64
+	EntryPrice float64
+	ExitTime   int64
+	ExitPrice  float64
+	Qty        float64
+	// Fees is the cost of both sides.
+	Fees float64
+	// Bars is how many bars the position was held across.
+	Bars int
+	// Reason is why the position was closed: "hold" after Config.HoldBars,
+	// "signal" on a sell signal, the exit rule's name such as "stop" for
+	// Config.Exit, "end" when the data ran out.
+	Reason string
+	// Signal is what the entry signal was based on.
+	Signal map[string]float64
+}
+
+// PnL is the profit of the trade in cash, after fees.
+func (t Trade) PnL() float64 {
+	return (t.ExitPrice-t.EntryPrice)*t.Qty - t.Fees
+}
+
+// Return is the profit as a fraction of the cost of the entry.
+func (t Trade) Return() float64 {
+	return t.PnL() / (t.EntryPrice * t.Qty)
+}
+
+// Win reports whether the trade made money.
+func (t Trade) Win() bool {
+	return t.PnL() > 0
+}
+
+// EquityPoint is the account after the bars at one timestamp.
+type EquityPoint struct {
+	Time     int64
+	Cash     float64
+	Holdings float64
+}
+
+// Equity is cash plus the holdings marked at their closes.
+func (p EquityPoint) Equity() float64 {
+	return p.Cash + p.Holdings
+}
+
+// Result is what a run produced.
+type Result struct {
+	Config  Config
+	Trades  []Trade
+	Fills   []Fill
+	Rejects []Reject
+	Equity  []EquityPoint
+}
+
+// FinalEquity is the equity after the last bar, or the starting cash when
+// nothing was replayed.
+func (r *Result) FinalEquity() float64 {
+	if len(r.Equity) == 0 {
+		return r.Config.Cash
+	}
+	return r.Equity[len(r.Equity)-1].Equity()
+}
+
+// RejectsByDay groups the refused orders by the day they came on, keyed
+// like TradesByDay.
+func (r *Result) RejectsByDay() map[string][]Reject {
+	res := make(map[string][]Reject)
+	for _, x := range r.Rejects {
+		day := r.day(x.Time).Format("2006-01-02")
+		res[day] = append(res[day], x)
+	}
+	return res
+}
+
+// TradesByDay groups trades by the day they were entered on, as the
+// metrics count days, in entry order.
+func (r *Result) TradesByDay() (days []string, trades map[string][]Trade) {
+	trades = make(map[string][]Trade)
+	for _, t := range r.Trades {
+		day := r.day(t.EntryTime).Format("2006-01-02")
+		if _, ok := trades[day]; !ok {
+			days = append(days, day)
+		}
+		trades[day] = append(trades[day], t)
+	}
+	return days, trades
+}
@@ -0,0 +1,87 @@
+package backtest
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"stock-backend/strategy"
+)
+
+// scanned is one symbol's signals by bar index, or the lookahead its
+// strategy made or what it panicked with.
+type scanned struct {
+	signals map[int]strategy.Signal
+	err     error
+	failure any
+}
+
+// scan works out the strategy's signals on every bar of every symbol that
+// the run trades on, Config.Workers symbols at a time. A strategy only
+// sees the bars up to the one it decides on and keeps no state, so its
+// signals do not depend on the portfolio; the replay then takes them up in
+// timestamp and symbol order, which keeps the result the same for any
+// number of workers.
+func (e *engine) scan() error {
+	workers := e.cfg.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	res := make([]scanned, len(e.symbols))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				res[k] = e.scanSymbol(e.symbols[k])
+			}
+		}()
+	}
+	for k := range e.symbols {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	// 按代码顺序找第一个出错的，和单线程时报的是同一个
+	for k, symbol := range e.symbols {
+		if res[k].failure != nil {
+			panic(res[k].failure)
+		}
+		if res[k].err != nil {
+			return res[k].err
+		}
+		e.signals[symbol] = res[k].signals
+	}
+	return nil
+}
+
+// scanSymbol checks each bar of symbol in [Config.Start, Config.End),
+// stopping at the first lookahead. A panic is handed back for scan to
+// raise on Run's goroutine.
+func (e *engine) scanSymbol(symbol string) (res scanned) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = scanned{failure: r}
+		}
+	}()
+	bars := e.data[symbol]
+	i := sort.Search(len(bars), func(k int) bool { return bars[k].Timestamp >= e.cfg.Start })
+	for ; i < len(bars); i++ {
+		if e.cfg.End > 0 && bars[i].Timestamp >= e.cfg.End {
+			break
+		}
+		sig, ok, err := e.signal(symbol, bars, i)
+		if err != nil {
+			return scanned{err: err}
+		}
+		if ok {
+			if res.signals == nil {
+				res.signals = make(map[int]strategy.Signal)
+			}
+			res.signals[i] = sig
+		}
+	}
+	return res
+}
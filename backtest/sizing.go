@@ -0,0 +1,115 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"stock-backend/kline"
+)
+
+// Sizing is what a Sizer knows when a position is opened.
+type Sizing struct {
+	// Equity is cash plus holdings at the last closes seen, Cash what is
+	// free to spend.
+	Equity float64
+	Cash   float64
+	Price  float64
+	// History is the symbol's bars before the one being traded on.
+	History []kline.Bar
+}
+
+// Sizer decides how much cash goes into a new position. Zero or less skips
+// the trade.
+type Sizer interface {
+	Size(s Sizing) float64
+}
+
+// FixedAmount puts the same cash into every position.
+type FixedAmount float64
+
+func (f FixedAmount) Size(s Sizing) float64 { return float64(f) }
+
+// PercentEquity puts a fraction of current equity into every position.
+type PercentEquity float64
+
+func (p PercentEquity) Size(s Sizing) float64 { return float64(p) * s.Equity }
+
+// VolatilityTarget sizes each position so that, alone, it would run at
+// Target annualized volatility, measured over the Lookback daily closes
+// before entry. The weight is capped at the whole equity.
+type VolatilityTarget struct {
+	Target   float64
+	Lookback int
+}
+
+func (v VolatilityTarget) Size(s Sizing) float64 {
+	n := v.Lookback
+	if n <= 1 || len(s.History) <= n {
+		return 0
+	}
+	closes := kline.Closes(s.History[len(s.History)-n-1:])
+	rets := make([]float64, n)
+	for i := range rets {
+		rets[i] = closes[i+1]/closes[i] - 1
+	}
+	_, sd := meanStd(rets)
+	vol := sd * math.Sqrt(TradingDays)
+	if vol <= 0 {
+		return 0
+	}
+	return math.Min(v.Target/vol, 1) * s.Equity
+}
+
+// ATRRisk sizes each position so that a move of Multiple ATRs against it
+// loses Risk of equity. ATR is the simple average true range over Period
+// bars before entry.
+type ATRRisk struct {
+	Risk     float64
+	Multiple float64
+	Period   int
+}
+
+func (a ATRRisk) Size(s Sizing) float64 {
+	atr := kline.ATR(s.History, a.Period)
+	if atr <= 0 || a.Multiple <= 0 {
+		return 0
+	}
+	shares := s.Equity * a.Risk / (a.Multiple * atr)
+	return shares * s.Price
+}
+
+// ParseSizer reads a sizing rule written as fixed:<cash>, pct:<fraction>,
+// vol:<target>[:<lookback>] or atr:<risk>[:<multiple>[:<period>]].
+func ParseSizer(s string) (Sizer, error) {
+	parts := strings.Split(s, ":")
+	nums := make([]float64, len(parts)-1)
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("sizer %q: %w", s, err)
+		}
+		nums[i] = v
+	}
+	arg := func(i int, def float64) float64 {
+		if i < len(nums) {
+			return nums[i]
+		}
+		return def
+	}
+	if len(nums) == 0 {
+		return nil, fmt.Errorf("sizer %q: want kind:value", s)
+	}
+	switch parts[0] {
+	case "fixed":
+		return FixedAmount(nums[0]), nil
+	case "pct":
+		return PercentEquity(nums[0]), nil
+	case "vol":
+		return VolatilityTarget{Target: nums[0], Lookback: int(arg(1, 20))}, nil
+	case "atr":
+		return ATRRisk{Risk: nums[0], Multiple: arg(1, 2), Period: int(arg(2, 14))}, nil
+	}
+	return nil, fmt.Errorf("sizer %q: unknown kind %q, want fixed, pct, vol or atr", s, parts[0])
+}
@@ -142,25 +142,6 @@ type Point struct {
 	trigger int
 }
 
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -511,13 +492,6 @@ func main() {
 			}
 
 			str += "http://xueqiu.com/s/" + symbol + "\n"
-			//if start < end {
-			//	slope := linearRegression(x[start:end+1], y[start:end+1])
-			//	slope2 := linearRegression(x[end+1:], y[end+1:])
-			//	fmt.Println("http://xueqiu.com/s/" + symbol)
-
-			//	fmt.Printf("%.5f, %.5f\n", slope, slope2)
-			//}
 			_, err = file.WriteString(str)
 			if err != nil {
 				fmt.Println("Error writing to file:", err)
@@ -0,0 +1,78 @@
+// Package benchmark lists the indices backtests are compared against and
+// loads their daily bars from the <market>_index_daily tables the daily
+// feeders fill.
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/backtest"
+	"stock-backend/kline"
+)
+
+// Index is one benchmark index. Symbol is the xueqiu symbol.
+type Index struct {
+	Key    string
+	Symbol string
+	Name   string
+	Market string
+}
+
+// Indices are the indices the feeders fetch. The first of each market is
+// its default benchmark.
+var Indices = []Index{
+	{Key: "csi300", Symbol: "SH000300", Name: "沪深300", Market: "cn"},
+	{Key: "sse", Symbol: "SH000001", Name: "上证指数", Market: "cn"},
+	{Key: "spx", Symbol: ".INX", Name: "标普500", Market: "us"},
+	{Key: "ndx", Symbol: ".NDX", Name: "纳斯达克100", Market: "us"},
+}
+
+// Get finds an index by key or symbol.
+func Get(name string) (Index, error) {
+	for _, idx := range Indices {
+		if idx.Key == name || strings.EqualFold(idx.Symbol, name) {
+			return idx, nil
+		}
+	}
+	keys := make([]string, len(Indices))
+	for i, idx := range Indices {
+		keys[i] = idx.Key
+	}
+	return Index{}, fmt.Errorf("unknown benchmark %q, want one of %s", name, strings.Join(keys, ", "))
+}
+
+// ForMarket lists the indices of a market, default first.
+func ForMarket(market string) []Index {
+	var res []Index
+	for _, idx := range Indices {
+		if idx.Market == market {
+			res = append(res, idx)
+		}
+	}
+	return res
+}
+
+// Default is the market's default benchmark: CSI 300 for cn, the S&P 500
+// for us.
+func Default(market string) (Index, error) {
+	if l := ForMarket(market); len(l) > 0 {
+		return l[0], nil
+	}
+	return Index{}, fmt.Errorf("no benchmark for market %q", market)
+}
+
+// Load reads the index's daily bars in [from, to) as a backtest benchmark.
+func Load(ctx context.Context, conn driver.Conn, idx Index, from, to int64) (*backtest.Benchmark, error) {
+	bars, err := kline.NewIndexSource(conn, idx.Market).Bars(ctx, idx.Symbol, kline.Day, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("no %s bars for %s (%s)", kline.Day, idx.Symbol, idx.Name)
+	}
+	return &backtest.Benchmark{Name: idx.Name, Bars: bars}, nil
+}
@@ -0,0 +1,166 @@
+package calendar
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+// Session is one continuous trading window, as offsets from local midnight.
+type Session struct {
+	Open  time.Duration
+	Close time.Duration
+}
+
+// Market is an exchange's trading hours in its own time zone.
+type Market struct {
+	Name     string
+	Location *time.Location
+	// Sessions are the day's windows in order; CN has a lunch break
+	// between two of them.
+	Sessions []Session
+	// Holidays are the weekdays the market is closed, as 2006-01-02 local
+	// dates.
+	Holidays map[string]bool
+	// EarlyCloses are the days trading stops before the usual close, with
+	// the time it stops.
+	EarlyCloses map[string]time.Duration
+	// Through is the last year Holidays and EarlyCloses cover. Later dates
+	// are checked without holidays, and the first one logs a warning.
+	Through int
+}
+
+// pastTables holds the names of the markets that have warned about a date
+// after Through.
+var pastTables sync.Map
+
+const dateLayout = "2006-01-02"
+
+func clock(h, m int) time.Duration {
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+}
+
+var (
+	CN = &Market{
+		Name:        "cn",
+		Location:    mustLoad("Asia/Shanghai"),
+		Sessions:    []Session{{clock(9, 30), clock(11, 30)}, {clock(13, 0), clock(15, 0)}},
+		Holidays:    dates(cnHolidays),
+		EarlyCloses: map[string]time.Duration{},
+		Through:     2027,
+	}
+	US = &Market{
+		Name:        "us",
+		Location:    mustLoad("America/New_York"),
+		Sessions:    []Session{{clock(9, 30), clock(16, 0)}},
+		Holidays:    dates(usHolidays),
+		EarlyCloses: usEarlyCloses,
+		Through:     2027,
+	}
+)
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Get returns the market called name, cn or us.
+func Get(name string) (*Market, error) {
+	switch name {
+	case "cn":
+		return CN, nil
+	case "us":
+		return US, nil
+	}
+	return nil, fmt.Errorf("unknown market %q", name)
+}
+
+// IsTradingDay reports whether the market trades on d's date in the
+// market's time zone: a weekday that is not a holiday.
+func (m *Market) IsTradingDay(d time.Time) bool {
+	local := d.In(m.Location)
+	if m.Through > 0 && local.Year() > m.Through {
+		if _, warned := pastTables.LoadOrStore(m.Name, true); !warned {
+			log.Printf("calendar %s: no holidays after %d, %s and later dates are only checked for weekends; add the year to calendar/holidays.go", m.Name, m.Through, local.Format(dateLayout))
+		}
+	}
+	wd := local.Weekday()
+	return wd != time.Saturday && wd != time.Sunday && !m.Holidays[local.Format(dateLayout)]
+}
+
+// SessionsOn are the windows of d's date, cut short on an early close; nil
+// when the market is closed that day.
+func (m *Market) SessionsOn(d time.Time) []Session {
+	if !m.IsTradingDay(d) {
+		return nil
+	}
+	end, early := m.EarlyCloses[d.In(m.Location).Format(dateLayout)]
+	if !early {
+		return m.Sessions
+	}
+	var res []Session
+	for _, s := range m.Sessions {
+		if s.Open >= end {
+			break
+		}
+		res = append(res, Session{s.Open, min(s.Close, end)})
+	}
+	return res
+}
+
+// At is the instant the market's clock reads offset on d's date. It goes
+// by the wall clock, so 9:30 stays 9:30 on the days DST starts or ends.
+func (m *Market) At(d time.Time, offset time.Duration) time.Time {
+	local := d.In(m.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(),
+		int(offset/time.Hour), int(offset%time.Hour/time.Minute), int(offset%time.Minute/time.Second), 0, m.Location)
+}
+
+// SessionDate is the trading day t belongs to, as local midnight: the
+// current day until its last close, then the next trading day. A US alert
+// at 22:00 Beijing time and one at 03:00 the next morning share a session
+// date.
+func (m *Market) SessionDate(t time.Time) time.Time {
+	local := t.In(m.Location)
+	d := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, m.Location)
+	if sessions := m.SessionsOn(d); len(sessions) > 0 && wallClock(local) >= sessions[len(sessions)-1].Close {
+		d = d.AddDate(0, 0, 1)
+	}
+	for !m.IsTradingDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// InSession reports whether t falls inside one of the day's windows.
+func (m *Market) InSession(t time.Time) bool {
+	local := t.In(m.Location)
+	at := wallClock(local)
+	for _, s := range m.SessionsOn(local) {
+		if at >= s.Open && at < s.Close {
+			return true
+		}
+	}
+	return false
+}
+
+// wallClock is the local time of day, which differs from the time since
+// midnight on DST switch days.
+func wallClock(t time.Time) time.Duration {
+	return clock(t.Hour(), t.Minute()) + time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// BarsPerDay is how many bars of length d a trading day holds, counting a
+// bar cut short by a break or the close.
+func (m *Market) BarsPerDay(d time.Duration) int {
+	n := 0
+	for _, s := range m.Sessions {
+		n += int((s.Close - s.Open + d - 1) / d)
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package calendar
+
+import "time"
+
+// The exchanges publish their holidays a year ahead, SSE in December and
+// NYSE years out; add each year's here once it is out and move the
+// markets' Through up to it. A missing holiday only costs a day of runs
+// that find nothing new, but the backtest's T+1 count also relies on these.
+
+// cnHolidays are the SSE/SZSE weekday closures. The make-up working
+// Saturdays stay closed for trading.
+var cnHolidays = []string{
+	// 2024
+	"2024-01-01",
+	"2024-02-09", "2024-02-12", "2024-02-13", "2024-02-14", "2024-02-15", "2024-02-16",
+	"2024-04-04", "2024-04-05",
+	"2024-05-01", "2024-05-02", "2024-05-03",
+	"2024-06-10",
+	"2024-09-16", "2024-09-17",
+	"2024-10-01", "2024-10-02", "2024-10-03", "2024-10-04", "2024-10-07",
+	// 2025
+	"2025-01-01",
+	"2025-01-28", "2025-01-29", "2025-01-30", "2025-01-31", "2025-02-03", "2025-02-04",
+	"2025-04-04",
+	"2025-05-01", "2025-05-02", "2025-05-05",
+	"2025-06-02",
+	"2025-10-01", "2025-10-02", "2025-10-03", "2025-10-06", "2025-10-07", "2025-10-08",
+	// 2026
+	"2026-01-01", "2026-01-02",
+	"2026-02-16", "2026-02-17", "2026-02-18", "2026-02-19", "2026-02-20", "2026-02-23",
+	"2026-04-06",
+	"2026-05-01", "2026-05-04", "2026-05-05",
+	"2026-06-19",
+	"2026-09-25",
+	"2026-10-01", "2026-10-02", "2026-10-05", "2026-10-06", "2026-10-07",
+	// 2027, ahead of the State Council notice: only the statutory days and
+	// the weekdays owed for those on a weekend. The notice usually closes a
+	// few more days around them; replace this block once it is out.
+	"2027-01-01",
+	"2027-02-05", "2027-02-08", "2027-02-09", "2027-02-10",
+	"2027-04-05",
+	"2027-05-03", "2027-05-04",
+	"2027-06-09",
+	"2027-09-15",
+	"2027-10-01", "2027-10-04", "2027-10-05",
+}
+
+// usHolidays are the NYSE full-day closures.
+var usHolidays = []string{
+	// 2024
+	"2024-01-01", "2024-01-15", "2024-02-19", "2024-03-29", "2024-05-27",
+	"2024-06-19", "2024-07-04", "2024-09-02", "2024-11-28", "2024-12-25",
+	// 2025, with the day of mourning for President Carter
+	"2025-01-01", "2025-01-09", "2025-01-20", "2025-02-17", "2025-04-18", "2025-05-26",
+	"2025-06-19", "2025-07-04", "2025-09-01", "2025-11-27", "2025-12-25",
+	// 2026
+	"2026-01-01", "2026-01-19", "2026-02-16", "2026-04-03", "2026-05-25",
+	"2026-06-19", "2026-07-03", "2026-09-07", "2026-11-26", "2026-12-25",
+	// 2027
+	"2027-01-01", "2027-01-18", "2027-02-15", "2027-03-26", "2027-05-31",
+	"2027-06-18", "2027-07-05", "2027-09-06", "2027-11-25", "2027-12-24",
+}
+
+// usEarlyCloses are the NYSE 13:00 closes around Independence Day,
+// Thanksgiving and Christmas.
+var usEarlyCloses = map[string]time.Duration{
+	"2024-07-03": clock(13, 0), "2024-11-29": clock(13, 0), "2024-12-24": clock(13, 0),
+	"2025-07-03": clock(13, 0), "2025-11-28": clock(13, 0), "2025-12-24": clock(13, 0),
+	"2026-11-27": clock(13, 0), "2026-12-24": clock(13, 0),
+	"2027-11-26": clock(13, 0),
+}
+
+func dates(list []string) map[string]bool {
+	res := make(map[string]bool, len(list))
+	for _, d := range list {
+		res[d] = true
+	}
+	return res
+}
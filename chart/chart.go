@@ -0,0 +1,193 @@
+// Package chart renders candlestick charts with volume, overlays and signal
+// markers, and backtest equity and drawdown curves, to PNG or SVG with
+// gonum/plot. It replaces the mplfinance charts of
+// generate_cn_kline_image.py for the Go tools.
+package chart
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	_ "gonum.org/v1/plot/vg/vgimg" // png
+	_ "gonum.org/v1/plot/vg/vgsvg" // svg
+)
+
+// Default size of a rendered chart.
+const (
+	Width  = 30 * vg.Centimeter
+	Height = 20 * vg.Centimeter
+)
+
+// Colors used across charts. Up and Down follow the A-share convention of
+// red for a rising bar.
+var (
+	Up      = color.RGBA{R: 0xd6, G: 0x27, B: 0x28, A: 0xff}
+	Down    = color.RGBA{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff}
+	Neutral = color.RGBA{R: 0x55, G: 0x55, B: 0x55, A: 0xff}
+	// Palette colors overlays in order.
+	Palette = []color.Color{
+		color.RGBA{B: 0xff, A: 0xff},
+		color.RGBA{R: 0xff, G: 0x8c, A: 0xff},
+		color.RGBA{R: 0x94, G: 0x00, B: 0xd3, A: 0xff},
+		color.RGBA{G: 0x80, B: 0x80, A: 0xff},
+		color.RGBA{A: 0xff},
+		color.RGBA{R: 0x8b, G: 0x45, B: 0x13, A: 0xff},
+	}
+)
+
+// Panel is one plot in a vertical stack, sized by Weight relative to the
+// others.
+type Panel struct {
+	Plot   *plot.Plot
+	Weight float64
+}
+
+// Draw stacks panels top to bottom on c, lining up their data areas so a
+// shared x axis reads straight down.
+func Draw(c draw.Canvas, panels ...Panel) {
+	total := 0.0
+	for _, p := range panels {
+		total += p.Weight
+	}
+	height := c.Max.Y - c.Min.Y
+	canvases := make([]draw.Canvas, len(panels))
+	top := c.Max.Y
+	for i, p := range panels {
+		h := vg.Length(p.Weight / total * float64(height))
+		canvases[i] = draw.Crop(c, 0, 0, top-h-c.Min.Y, top-c.Max.Y)
+		top -= h
+	}
+	// 和 plot.Align 一样，按最宽的坐标轴留边，让各面板的数据区左右对齐
+	var left, right vg.Length
+	for i, p := range panels {
+		dc := p.Plot.DataCanvas(canvases[i])
+		left = max(left, dc.Min.X-canvases[i].Min.X)
+		right = max(right, canvases[i].Max.X-dc.Max.X)
+	}
+	for i, p := range panels {
+		dc := p.Plot.DataCanvas(canvases[i])
+		l := left - (dc.Min.X - canvases[i].Min.X)
+		r := right - (canvases[i].Max.X - dc.Max.X)
+		p.Plot.Draw(draw.Crop(canvases[i], l, -r, 0, 0))
+	}
+}
+
+// WriteTo renders panels as format, "png" or "svg", at the given size.
+func WriteTo(w io.Writer, format string, width, height vg.Length, panels ...Panel) error {
+	c, err := draw.NewFormattedCanvas(width, height, format)
+	if err != nil {
+		return err
+	}
+	dc := draw.New(c)
+	// 先铺白底，PNG 默认是透明的
+	dc.FillPolygon(color.White, []vg.Point{dc.Min, {X: dc.Max.X, Y: dc.Min.Y}, dc.Max, {X: dc.Min.X, Y: dc.Max.Y}})
+	Draw(dc, panels...)
+	_, err = c.WriteTo(w)
+	return err
+}
+
+// Save renders panels to path, the format taken from its extension.
+func Save(path string, width, height vg.Length, panels ...Panel) error {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if format != "png" && format != "svg" {
+		return fmt.Errorf("chart %s: want a .png or .svg file", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteTo(f, format, width, height, panels...); err != nil {
+		f.Close()
+		return fmt.Errorf("chart %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// timeTicks labels an axis whose x values are indices into times, so bars
+// sit side by side without gaps for nights, weekends and holidays.
+type timeTicks struct {
+	times  []int64
+	layout string
+}
+
+func (t timeTicks) Ticks(lo, hi float64) []plot.Tick {
+	n := len(t.times)
+	if n == 0 {
+		return nil
+	}
+	step := max(1, int(math.Ceil(float64(n)/8)))
+	var res []plot.Tick
+	for i := 0; i < n; i++ {
+		v := float64(i)
+		if v < lo || v > hi {
+			continue
+		}
+		label := ""
+		if i%step == 0 {
+			label = time.UnixMilli(t.times[i]).Format(t.layout)
+		} else if step > 4 && i%(step/2) != 0 {
+			continue
+		}
+		res = append(res, plot.Tick{Value: v, Label: label})
+	}
+	return res
+}
+
+// layout picks a date format for timestamps spaced like times.
+func layout(times []int64) string {
+	if len(times) > 1 && times[1]-times[0] < 24*3600*1000 {
+		return "01-02 15:04"
+	}
+	return "2006-01-02"
+}
+
+// newPlot is a plot with its x axis as indices labelled by times.
+func newPlot(times []int64) *plot.Plot {
+	p := plot.New()
+	p.X.Tick.Marker = timeTicks{times: times, layout: layout(times)}
+	p.X.Min, p.X.Max = -0.5, float64(len(times))-0.5
+	p.Add(gridLines{})
+	return p
+}
+
+// gridLines draws light horizontal lines at the y ticks.
+type gridLines struct{}
+
+func (gridLines) Plot(c draw.Canvas, p *plot.Plot) {
+	_, trY := p.Transforms(&c)
+	sty := draw.LineStyle{Color: color.Gray{Y: 0xe0}, Width: vg.Points(0.5)}
+	for _, t := range p.Y.Tick.Marker.Ticks(p.Y.Min, p.Y.Max) {
+		if t.IsMinor() {
+			continue
+		}
+		y := trY(t.Value)
+		c.StrokeLine2(sty, c.Min.X, y, c.Max.X, y)
+	}
+}
+
+// unlabelled keeps a ticker's marks but drops their labels, for a panel
+// whose x axis is labelled by the one below it.
+type unlabelled struct {
+	plot.Ticker
+}
+
+func (u unlabelled) Ticks(lo, hi float64) []plot.Tick {
+	ticks := u.Ticker.Ticks(lo, hi)
+	for i := range ticks {
+		ticks[i].Label = ""
+	}
+	return ticks
+}
+
+func hideX(p *plot.Plot) {
+	p.X.Tick.Marker = unlabelled{p.X.Tick.Marker}
+}
@@ -0,0 +1,78 @@
+package chart
+
+import (
+	"image/color"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+
+	"stock-backend/backtest"
+)
+
+// Equity is a backtest's equity curve, with the benchmark on the same
+// starting cash when the run had one.
+func Equity(r *backtest.Result) Panel {
+	times := make([]int64, len(r.Equity))
+	eq := make([]float64, len(r.Equity))
+	for i, p := range r.Equity {
+		times[i], eq[i] = p.Time, p.Equity()
+	}
+	p := newPlot(times)
+	p.Title.Text = "Equity"
+	l := &line{values: eq, style: draw.LineStyle{Color: Palette[0], Width: vg.Points(1.2)}}
+	p.Add(l)
+	p.Legend.Add(r.Config.Strategy.Name(), l)
+	if bench := r.BenchmarkEquity(); bench != nil {
+		b := &line{values: bench, style: draw.LineStyle{Color: Neutral, Width: vg.Points(1), Dashes: []vg.Length{vg.Points(4), vg.Points(2)}}}
+		p.Add(b)
+		p.Legend.Add(r.Config.Benchmark.Name, b)
+	}
+	p.Legend.Top = true
+	p.Legend.Left = true
+	return Panel{Plot: p, Weight: 3}
+}
+
+// Drawdown is the fall of equity below its running peak, in percent.
+func Drawdown(r *backtest.Result) Panel {
+	times := make([]int64, len(r.Equity))
+	dd := make([]float64, len(r.Equity))
+	peak := r.Config.Cash
+	for i, p := range r.Equity {
+		eq := p.Equity()
+		peak = max(peak, eq)
+		times[i], dd[i] = p.Time, (eq/peak-1)*100
+	}
+	p := newPlot(times)
+	p.Y.Label.Text = "Drawdown %"
+	p.Add(&area{line{values: dd, style: draw.LineStyle{Color: Down, Width: vg.Points(0.8)}}})
+	p.Y.Max = 0
+	return Panel{Plot: p, Weight: 1}
+}
+
+// Performance stacks the equity and drawdown panels, the equity curve's x
+// labels left to the drawdown below it.
+func Performance(r *backtest.Result) []Panel {
+	eq, dd := Equity(r), Drawdown(r)
+	hideX(eq.Plot)
+	return []Panel{eq, dd}
+}
+
+// area is a line filled down to zero.
+type area struct {
+	line
+}
+
+func (a *area) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	if len(a.values) == 0 {
+		return
+	}
+	pts := []vg.Point{{X: trX(0), Y: trY(0)}}
+	for i, v := range a.values {
+		pts = append(pts, vg.Point{X: trX(float64(i)), Y: trY(v)})
+	}
+	pts = append(pts, vg.Point{X: trX(float64(len(a.values) - 1)), Y: trY(0)})
+	dc.FillPolygon(color.NRGBA{R: Down.R, G: Down.G, B: Down.B, A: 0x60}, dc.ClipPolygonXY(pts))
+	a.line.Plot(dc, p)
+}
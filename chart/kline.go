@@ -0,0 +1,311 @@
+package chart
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+
+	"stock-backend/indicator"
+	"stock-backend/kline"
+	"stock-backend/strategy"
+	"stock-backend/volprofile"
+)
+
+// Overlay is a line drawn over the candles, one value per bar; NaN leaves
+// a gap.
+type Overlay struct {
+	Name   string
+	Values []float64
+	Color  color.Color
+}
+
+// MA is the simple moving average of the closes as an overlay.
+func MA(bars []kline.Bar, n int) Overlay {
+	return Overlay{Name: fmt.Sprintf("MA%d", n), Values: indicator.MA(kline.Closes(bars), n)}
+}
+
+// EMA is the exponential moving average of the closes as an overlay.
+func EMA(bars []kline.Bar, n int) Overlay {
+	return Overlay{Name: fmt.Sprintf("EMA%d", n), Values: indicator.EMA(kline.Closes(bars), n)}
+}
+
+// Level is a horizontal price line from bar From to bar To, or to the
+// right edge when To is 0, such as a gap's open or a support or resistance
+// line.
+type Level struct {
+	Name     string
+	Price    float64
+	From, To int
+	Color    color.Color
+	// Dashed draws the line dashed, for support and resistance.
+	Dashed bool
+}
+
+// Marker flags a signal on bar Index at Price: an up triangle under the
+// bar for a buy, a down triangle over it for a sell.
+type Marker struct {
+	Index     int
+	Price     float64
+	Direction strategy.Direction
+	Label     string
+}
+
+// gapSpan is how many bars a gap level is drawn across.
+const gapSpan = 12
+
+// Gaps are levels at the open of every gap bar in bars, a bar opening above
+// the highs of the highs bars before it, the rule of the gap tables. Each
+// runs across the bars the gap strategies watch it for.
+func Gaps(bars []kline.Bar, highs int) []Level {
+	var res []Level
+	for j := max(highs, 1); j < len(bars); j++ {
+		high := math.Inf(-1)
+		for k := max(0, j-highs); k < j; k++ {
+			high = math.Max(high, bars[k].High)
+		}
+		if bars[j].Open > high {
+			res = append(res, Level{Name: "gap", Price: bars[j].Open, From: j, To: min(j+gapSpan, len(bars)-1), Color: color.Gray{Y: 0x80}})
+		}
+	}
+	return res
+}
+
+// VolumeLevels are dashed support and resistance levels from the volume
+// profile of bars, across the whole chart: the value area's low and high,
+// the point of control and the middle of every high-volume node.
+func VolumeLevels(bars []kline.Bar, opts volprofile.Options) ([]Level, error) {
+	p, err := volprofile.Build(bars, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := []Level{
+		{Name: "VAL", Price: p.VAL, Dashed: true},
+		{Name: "VAH", Price: p.VAH, Dashed: true},
+		{Name: "POC", Price: p.POC, Dashed: true, Color: Palette[0]},
+	}
+	for _, n := range p.HighNodes {
+		res = append(res, Level{Name: "HVN", Price: (n.Low + n.High) / 2, Dashed: true, Color: color.Gray{Y: 0xa0}})
+	}
+	return res, nil
+}
+
+// Signals are markers for signals found on bars, e.g. by strategy.Scan.
+func Signals(sigs []strategy.Signal) []Marker {
+	res := make([]Marker, len(sigs))
+	for i, s := range sigs {
+		res[i] = Marker{Index: s.Index, Price: s.Price, Direction: s.Direction, Label: s.Strategy}
+	}
+	return res
+}
+
+// KLine is a candlestick chart with a volume panel below.
+type KLine struct {
+	Title    string
+	Bars     []kline.Bar
+	Overlays []Overlay
+	Levels   []Level
+	Markers  []Marker
+}
+
+// Panels builds the price and volume panels, price three times as tall.
+func (k KLine) Panels() []Panel {
+	times := make([]int64, len(k.Bars))
+	for i, b := range k.Bars {
+		times[i] = b.Timestamp
+	}
+	price := newPlot(times)
+	price.Title.Text = k.Title
+	price.Y.Label.Text = "Price"
+	price.Add(candles(k.Bars))
+	for i, o := range k.Overlays {
+		l := overlayLine(o, i)
+		price.Add(l)
+		price.Legend.Add(o.Name, l)
+	}
+	for _, l := range k.Levels {
+		price.Add(level(l))
+	}
+	if len(k.Markers) > 0 {
+		price.Add(markers(k.Markers))
+	}
+	price.Legend.Top = true
+	price.Legend.Left = true
+	hideX(price)
+
+	vol := newPlot(times)
+	vol.Y.Label.Text = "Volume"
+	vol.Add(volumes(k.Bars))
+	return []Panel{{Plot: price, Weight: 3}, {Plot: vol, Weight: 1}}
+}
+
+// Save renders the chart to a .png or .svg file at the default size.
+func (k KLine) Save(path string) error {
+	return Save(path, Width, Height, k.Panels()...)
+}
+
+// candles draws one candlestick per bar at x = its index.
+type candles []kline.Bar
+
+func (c candles) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	w := (trX(1) - trX(0)) * 0.7
+	for i, b := range c {
+		col := Up
+		if b.Close < b.Open {
+			col = Down
+		}
+		x := trX(float64(i))
+		dc.StrokeLine2(draw.LineStyle{Color: col, Width: vg.Points(0.6)}, x, trY(b.Low), x, trY(b.High))
+		bottom, top := trY(math.Min(b.Open, b.Close)), trY(math.Max(b.Open, b.Close))
+		if top-bottom < vg.Points(0.5) {
+			top = bottom + vg.Points(0.5)
+		}
+		body := []vg.Point{{X: x - w/2, Y: bottom}, {X: x + w/2, Y: bottom}, {X: x + w/2, Y: top}, {X: x - w/2, Y: top}}
+		dc.FillPolygon(col, dc.ClipPolygonXY(body))
+	}
+}
+
+func (c candles) DataRange() (xmin, xmax, ymin, ymax float64) {
+	ymin, ymax = math.Inf(1), math.Inf(-1)
+	for _, b := range c {
+		ymin, ymax = math.Min(ymin, b.Low), math.Max(ymax, b.High)
+	}
+	return -0.5, float64(len(c)) - 0.5, ymin, ymax
+}
+
+// volumes draws a volume bar per bar, colored like its candle.
+type volumes []kline.Bar
+
+func (v volumes) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	w := (trX(1) - trX(0)) * 0.7
+	for i, b := range v {
+		col := Up
+		if b.Close < b.Open {
+			col = Down
+		}
+		x := trX(float64(i))
+		bar := []vg.Point{{X: x - w/2, Y: trY(0)}, {X: x + w/2, Y: trY(0)}, {X: x + w/2, Y: trY(b.Volume)}, {X: x - w/2, Y: trY(b.Volume)}}
+		dc.FillPolygon(col, dc.ClipPolygonXY(bar))
+	}
+}
+
+func (v volumes) DataRange() (xmin, xmax, ymin, ymax float64) {
+	for _, b := range v {
+		ymax = math.Max(ymax, b.Volume)
+	}
+	return -0.5, float64(len(v)) - 0.5, 0, ymax
+}
+
+// overlayLine turns an overlay into a line, split at NaNs.
+func overlayLine(o Overlay, i int) *line {
+	col := o.Color
+	if col == nil {
+		col = Palette[i%len(Palette)]
+	}
+	return &line{values: o.Values, style: draw.LineStyle{Color: col, Width: vg.Points(1)}}
+}
+
+// line is a series over bar indices that skips NaN values.
+type line struct {
+	values []float64
+	style  draw.LineStyle
+}
+
+func (l *line) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	var seg []vg.Point
+	flush := func() {
+		if len(seg) > 1 {
+			dc.StrokeLines(l.style, dc.ClipLinesXY(seg)...)
+		}
+		seg = nil
+	}
+	for i, v := range l.values {
+		if math.IsNaN(v) {
+			flush()
+			continue
+		}
+		seg = append(seg, vg.Point{X: trX(float64(i)), Y: trY(v)})
+	}
+	flush()
+}
+
+func (l *line) DataRange() (xmin, xmax, ymin, ymax float64) {
+	ymin, ymax = math.Inf(1), math.Inf(-1)
+	for _, v := range l.values {
+		if !math.IsNaN(v) {
+			ymin, ymax = math.Min(ymin, v), math.Max(ymax, v)
+		}
+	}
+	return -0.5, float64(len(l.values)) - 0.5, ymin, ymax
+}
+
+// Thumbnail implements plot.Thumbnailer for the legend.
+func (l *line) Thumbnail(c *draw.Canvas) {
+	y := c.Center().Y
+	c.StrokeLine2(l.style, c.Min.X, y, c.Max.X, y)
+}
+
+// level draws a Level.
+type level Level
+
+func (l level) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	col := l.Color
+	if col == nil {
+		col = Neutral
+	}
+	sty := draw.LineStyle{Color: col, Width: vg.Points(0.8)}
+	if l.Dashed {
+		sty.Dashes = []vg.Length{vg.Points(4), vg.Points(3)}
+	}
+	y := trY(l.Price)
+	if !dc.ContainsY(y) {
+		return
+	}
+	right := dc.Max.X
+	if l.To > 0 {
+		right = min(trX(float64(l.To)), right)
+	}
+	dc.StrokeLine2(sty, max(trX(float64(l.From)), dc.Min.X), y, right, y)
+}
+
+// markers draws signal markers off the bar they flag.
+type markers []Marker
+
+func (m markers) Plot(dc draw.Canvas, p *plot.Plot) {
+	trX, trY := p.Transforms(&dc)
+	size := vg.Points(5)
+	for _, mk := range m {
+		x, y := trX(float64(mk.Index)), trY(mk.Price)
+		sty := draw.GlyphStyle{Radius: size, Color: Up, Shape: triangle{up: true}}
+		pt := vg.Point{X: x, Y: y - 2*size}
+		if mk.Direction == strategy.Sell {
+			sty.Color, sty.Shape = Down, triangle{}
+			pt.Y = y + 2*size
+		}
+		if dc.Contains(pt) {
+			dc.DrawGlyph(sty, pt)
+		}
+	}
+}
+
+// triangle is a filled triangle pointing up or down.
+type triangle struct {
+	up bool
+}
+
+func (t triangle) DrawGlyph(c *draw.Canvas, sty draw.GlyphStyle, pt vg.Point) {
+	r := sty.Radius
+	dx, dy := r*vg.Length(math.Cos(math.Pi/6)), r*vg.Length(math.Sin(math.Pi/6))
+	tip, base := pt.Y+r, pt.Y-dy
+	if !t.up {
+		tip, base = pt.Y-r, pt.Y+dy
+	}
+	c.FillPolygon(sty.Color, []vg.Point{{X: pt.X, Y: tip}, {X: pt.X - dx, Y: base}, {X: pt.X + dx, Y: base}})
+}
@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/backtest"
+	"stock-backend/benchmark"
+	"stock-backend/kline"
+	"stock-backend/montecarlo"
+	"stock-backend/scoring"
+	"stock-backend/stocknames"
+	"stock-backend/strategy"
+	"stock-backend/universe"
 )
 
 type Market struct {
@@ -154,25 +165,6 @@ type DownPeriod struct {
 	avgVal     float64
 }
 
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -261,10 +253,12 @@ func updateCookies(url string, jar *cookiejar.Jar) error {
 
 func main() {
 	now := time.Now()
-	country := "cn"
-	talbeName := country + "_stock_daily"
-	talbeGap := country + "_gap_records"
-	// tableName := "cn_stock_daily"
+	country := flag.String("market", "cn", "cn or us")
+	days := flag.Int("days", -40, "start this many days from today")
+	cash := flag.Float64("cash", 1000000, "starting capital")
+	maxPositions := flag.Int("max-positions", 0, "most positions open at once, each with a tenth of equity; 0 takes every signal")
+	mcRuns := flag.Int("montecarlo", 10000, "resample the trades this many times to see how much of the result is luck, 0 to skip")
+	flag.Parse()
 	file, err := os.OpenFile("running.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		fmt.Println("Error opening file:", err)
@@ -287,168 +281,132 @@ func main() {
 		fmt.Println("删除文件出错")
 	}
 
-	symbolsQuery := `SELECT DISTINCT symbol FROM ` + talbeName + ` where timestamp = (select max(timestamp) from ` + talbeName + `) and market_capital > 10045411866`
-	rows, err := conn.Query(context.Background(), symbolsQuery)
+	// 股票池按每个交易日当时的市值筛，退市和后来缩水的票也在里面，避免幸存者偏差
+	start := now.AddDate(0, 0, *days).UnixMilli()
+	pool, err := universe.Load(context.Background(), conn, *country, []universe.Condition{
+		{Field: "market_capital", Op: ">=", Values: []float64{10045411866}},
+	}, start, 0)
 	if err != nil {
 		log.Fatalf("Failed to execute query: %v", err)
 	}
-	defer rows.Close()
 
-	var symbols []string
-	for rows.Next() {
-		var symbol string
-		if err := rows.Scan(&symbol); err != nil {
-			log.Fatalf("Failed to scan row: %v", err)
+	// 一次取回所有标的的日线交给回测引擎回放；要留出均线和缺口窗口的历史
+	src := kline.NewClickHouseSource(conn, *country)
+	data, err := backtest.Load(context.Background(), src, pool.Symbols(), kline.Day, now.AddDate(0, 0, *days-30).UnixMilli(), 0)
+	if err != nil {
+		log.Fatalf("Failed to execute query: %v", err)
+	}
+	idx, err := benchmark.Default(*country)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 指数没导入就不算相对指标
+	bench, err := benchmark.Load(context.Background(), conn, idx, now.AddDate(0, 0, *days-10).UnixMilli(), 0)
+	if err != nil {
+		fmt.Println("读取基准失败，不算相对指标（指数日线用 csv-gen/import_index.sh 导入）:", err)
+	}
+	rules, err := backtest.MarketFor(*country)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// ST 股的涨跌停窄，按每天导入的股票名称认出来；没导入名称就都按普通股票算
+	var st backtest.ST
+	if rules.PriceLimits {
+		st, err = stocknames.LoadST(context.Background(), conn, *country, start, 0)
+		if err != nil {
+			fmt.Println("读取股票名称失败，ST 股按普通涨跌停算:", err)
 		}
-		symbols = append(symbols, symbol)
 	}
-	index := -40
-
-	for index < -2 {
-		// 创建 time.Time 对象
-		startTime := now.AddDate(0, 0, index).Unix() * 1000 // 8天前的时间戳（毫秒）
-		maTime := now.AddDate(0, 0, index-14).Unix() * 1000 // 8天前的时间戳（毫秒）
-		seconds := startTime / 1000
-		nanoseconds := (startTime % 1000) * 1000000
-		t := time.Unix(int64(seconds), int64(nanoseconds))
-		formattedTime := t.Format("2006-01-02 15:04:05")
-		_, err = file.WriteString(formattedTime + "\n")
+	// 信号当天按缺口价买入，下一根日线开盘卖出；按市场收手续费，A股还有涨跌停和T+1
+	// 默认每个信号都买，每笔固定百分之一的本金，赚了/亏了/点数数的是全部信号；
+	// 设了 max-positions 就每笔一成权益，同一天信号太多时按打分先后买，没买上的记在未成交里
+	var sizer backtest.Sizer = backtest.FixedAmount(*cash / 100)
+	if *maxPositions > 0 {
+		sizer = backtest.PercentEquity(0.1)
+	}
+	res, err := backtest.Run(data, backtest.Config{
+		Strategy:     strategy.DailyGapPop,
+		Start:        start,
+		End:          now.AddDate(0, 0, -1).UnixMilli(),
+		Cash:         *cash,
+		Fill:         backtest.FillSignal,
+		HoldBars:     1,
+		Market:       rules,
+		ST:           st,
+		Sizer:        sizer,
+		MaxPositions: *maxPositions,
+		Priority:     &scoring.Default,
+		Universe:     pool,
+		Benchmark:    bench,
+	})
+	if err != nil {
+		log.Fatalf("Failed to run backtest: %v", err)
+	}
+
+	totalWins, totalTrades, totalPoints := 0, 0, 0.0
+	dayList, byDay := res.TradesByDay()
+	// 没成交的信号按天数出来，一笔没买上的日子也要列出来
+	rejected := res.RejectsByDay()
+	for day := range rejected {
+		if _, ok := byDay[day]; !ok {
+			dayList = append(dayList, day)
+		}
+	}
+	sort.Strings(dayList)
+	for _, day := range dayList {
+		_, err = file.WriteString(day + "\n")
 		wins := 0
 		loses := 0
 		points := 0.0
-		for _, symbol := range symbols {
-			frontTime := now.AddDate(0, 0, index-5).Unix() * 1000 // 5天前的时间戳（毫秒）
-			backTime := now.AddDate(0, 0, index-12).Unix() * 1000 // 10天前的时间戳（毫秒）
-
-			// 使用 fmt.Sprintf 构建 SQL 查询
-			sqlStatements := fmt.Sprintf(`
-			WITH ranked_records AS (
-				SELECT symbol, open, close, high, low, timestamp, AVG(close) OVER (
-					PARTITION BY symbol
-					ORDER BY timestamp
-					ROWS BETWEEN 9 PRECEDING AND CURRENT ROW
-				) as avg, market_capital AS mc
-				FROM %s
-				WHERE timestamp > %d and symbol = '%s'
-			)
-				SELECT symbol, open, close, high, timestamp, avg, low
-				FROM ranked_records
-				WHERE timestamp > %d
-				ORDER BY timestamp ASC 
-				LIMIT 2`,
-				talbeName,
-				maTime,
-				symbol,
-				startTime,
-			)
-
-			rows, err := conn.Query(context.Background(), sqlStatements)
-			if err != nil {
-				log.Fatalf("Failed to execute query: %v", err)
-			}
-			defer rows.Close()
-			var str string
-			var op, cl, hi, lo float64
-			var tss uint64
-			buy := 0.0
-			for rows.Next() {
-				var (
-					symbol string
-					open   float64
-					close  float64
-					high   float64
-					ts     uint64
-					avg    float64
-					low    float64
-				)
-
-				err := rows.Scan(&symbol, &open, &close, &high, &ts, &avg, &low)
-				if err != nil {
-					log.Fatalf("Failed to scan row: %v", err)
-				}
-
-				if str != "." && len(str) > 0 {
-					if open-buy > 0 {
-						wins++
-					} else {
-						loses++
-					}
-					points += (open - buy) / buy
-					str += fmt.Sprintf("    	卖点 %f, 盈利 %f\n", open, (open-buy)/buy)
-					continue
-				} else if str == "." {
-					continue
-				}
-
-				sql := fmt.Sprintf(`
-					WITH RankedSymbols AS (
-						SELECT *,
-							ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
-						FROM %s
-						WHERE timestamp >= %d
-						AND timestamp <= %d
-						AND symbol = '%s'
-					)
-					SELECT symbol, open, close, high,low, timestamp
-					FROM RankedSymbols
-					WHERE rn = 1;`,
-					talbeGap,
-					backTime,
-					frontTime,
-					symbol,
-				)
-
-				gap, err := conn.Query(context.Background(), sql)
-				if err != nil {
-					log.Fatalf("Failed to execute query: %v", err)
-				}
-				defer gap.Close()
-
-				for gap.Next() {
-					err := gap.Scan(&symbol, &op, &cl, &hi, &lo, &tss)
-					if err != nil {
-						fmt.Println("gg")
-						return
-					}
-					seconds := ts / 1000
-					nanoseconds := (ts % 1000) * 1000000
-
-					// 创建 time.Time 对象
-					t := time.Unix(int64(seconds), int64(nanoseconds))
-					ft := t.Format("2006-01-02 15:04:05")
-					seconds = tss / 1000
-					nanoseconds = (tss % 1000) * 1000000
-					tt := time.Unix(int64(seconds), int64(nanoseconds))
-					ftt := tt.Format("2006-01-02 15:04:05")
-					if low < avg && op > avg && op < high {
-						if open > op {
-							buy = open
-						} else {
-							buy = op
-						}
-						str = fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,买点：%f(%s), 收盘：%f\n", symbol, cl, ftt, avg, open, ft, close)
-					} else {
-						str = "."
-					}
+		for _, t := range byDay[day] {
+			ft := time.UnixMilli(t.EntryTime).Format("2006-01-02 15:04:05")
+			ftt := time.UnixMilli(int64(t.Signal["gap_ts"])).Format("2006-01-02 15:04:05")
+			str := fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,买点：%f(%s)\n", t.Symbol, t.Signal["gap_close"], ftt, t.Signal["ma"], t.EntryPrice, ft)
+			if t.Reason == "end" {
+				str += fmt.Sprintf("    	未平仓, 收盘 %f\n", t.ExitPrice)
+			} else {
+				if t.Win() {
+					wins++
+				} else {
+					loses++
 				}
+				points += t.Return()
+				str += fmt.Sprintf("    	卖点 %f, 盈利 %f\n", t.ExitPrice, t.Return())
 			}
 
-			if str != "." && len(str) > 0 {
-				_, err = file.WriteString(str)
-				if err != nil {
-					fmt.Println("Error writing to file:", err)
-					return
-				}
+			_, err = file.WriteString(str)
+			if err != nil {
+				fmt.Println("Error writing to file:", err)
+				return
 			}
 		}
-		fmt.Printf("%d, 赚了：%d, 亏了：%d, 点数：%f\n", index, wins, loses, points/float64(wins+loses))
+		fmt.Printf("%s, 赚了：%d, 亏了：%d, 点数：%f", day, wins, loses, points/float64(wins+loses))
+		if n := len(rejected[day]); n > 0 {
+			fmt.Printf(", 未成交：%d", n)
+		}
+		fmt.Println()
+		totalWins += wins
+		totalTrades += wins + loses
+		totalPoints += points
 		loopLine := "======================================\n"
 		_, err = file.WriteString(loopLine)
 		if err != nil {
 			fmt.Println("Error writing to file:", err)
 			return
 		}
-		index = index + 1
+	}
+	fmt.Printf("合计 %d 笔, 赚了：%d, 平均点数：%f\n", totalTrades, totalWins, totalPoints/float64(totalTrades))
+	if err := res.Metrics().WriteReport(os.Stdout, 10); err != nil {
+		fmt.Println("Error:", err)
+	}
+	// 四十天的交易太少，平均点数可能只是运气；重抽样看看区间有多宽
+	if *mcRuns > 0 {
+		mc := montecarlo.Config{Runs: *mcRuns}
+		sample := montecarlo.FromResult(res)
+		fmt.Println()
+		if err := montecarlo.WriteReport(os.Stdout, sample, montecarlo.Run(sample, mc), mc); err != nil {
+			fmt.Println("Error:", err)
+		}
 	}
 
 	file.Close()
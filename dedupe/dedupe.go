@@ -0,0 +1,153 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/calendar"
+)
+
+// Table keeps every alert sent, so a checker restarted mid-session knows
+// what it already reported.
+const Table = "alerts"
+
+const createTable = `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+	strategy   LowCardinality(String),
+	symbol     String,
+	market     LowCardinality(String),
+	session    Date,
+	alerted_at DateTime64(3)
+) ENGINE = MergeTree
+ORDER BY (market, session, strategy, symbol)
+TTL session + INTERVAL 90 DAY`
+
+// Options sets how soon the same strategy may alert on the same symbol
+// again within a session. Zero means once per session; a new session always
+// starts clean.
+type Options struct {
+	Cooldown time.Duration
+	// PerStrategy overrides Cooldown for the named strategies.
+	PerStrategy map[string]time.Duration
+}
+
+type key struct {
+	strategy string
+	symbol   string
+}
+
+// session is what has been alerted in one market's trading day.
+type session struct {
+	date time.Time
+	last map[key]time.Time
+}
+
+// Store decides whether an alert is new. It is safe for concurrent use.
+type Store struct {
+	conn driver.Conn
+	opts Options
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// Open returns a store on conn, creating the table if it is missing.
+func Open(ctx context.Context, conn driver.Conn, opts Options) (*Store, error) {
+	if err := conn.Exec(ctx, createTable); err != nil {
+		return nil, fmt.Errorf("create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, opts: opts, sessions: make(map[string]*session)}, nil
+}
+
+func (s *Store) cooldown(strategy string) time.Duration {
+	if d, ok := s.opts.PerStrategy[strategy]; ok {
+		return d
+	}
+	return s.opts.Cooldown
+}
+
+// current returns market's session at now, loading what was alerted so far
+// when the session has changed since the last call.
+func (s *Store) current(ctx context.Context, market string, now time.Time) (*session, error) {
+	cal, err := calendar.Get(market)
+	if err != nil {
+		return nil, err
+	}
+	date := cal.SessionDate(now)
+	if cur, ok := s.sessions[market]; ok && cur.date.Equal(date) {
+		return cur, nil
+	}
+	rows, err := s.conn.Query(ctx, `SELECT strategy, symbol, max(alerted_at)
+		FROM `+Table+`
+		WHERE market = ? AND session = toDate(?)
+		GROUP BY strategy, symbol`, market, date.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("load %s for %s %s: %w", Table, market, date.Format("2006-01-02"), err)
+	}
+	defer rows.Close()
+	cur := &session{date: date, last: make(map[key]time.Time)}
+	for rows.Next() {
+		var (
+			k  key
+			at time.Time
+		)
+		if err := rows.Scan(&k.strategy, &k.symbol, &at); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", Table, err)
+		}
+		cur.last[k] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.sessions[market] = cur
+	return cur, nil
+}
+
+func (s *Store) blocked(cur *session, k key, now time.Time) bool {
+	last, ok := cur.last[k]
+	if !ok {
+		return false
+	}
+	cd := s.cooldown(k.strategy)
+	return cd == 0 || now.Sub(last) < cd
+}
+
+// Seen reports whether an alert for strategy and symbol at now would be
+// suppressed, without recording anything. Checkers use it to skip symbols
+// they have already reported.
+func (s *Store) Seen(ctx context.Context, strategy, market, symbol string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, err := s.current(ctx, market, now)
+	if err != nil {
+		return false, err
+	}
+	return s.blocked(cur, key{strategy, symbol}, now), nil
+}
+
+// Allow reports whether the alert is new and, if so, records it. A false
+// result means the same strategy already alerted on symbol this session
+// and its cooldown has not passed.
+func (s *Store) Allow(ctx context.Context, strategy, market, symbol string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, err := s.current(ctx, market, now)
+	if err != nil {
+		return false, err
+	}
+	k := key{strategy, symbol}
+	if s.blocked(cur, k, now) {
+		return false, nil
+	}
+	err = s.conn.Exec(ctx, `INSERT INTO `+Table+` (strategy, symbol, market, session, alerted_at)
+		VALUES (?, ?, ?, toDate(?), fromUnixTimestamp64Milli(?))`,
+		strategy, symbol, market, cur.date.Format("2006-01-02"), now.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("insert into %s: %w", Table, err)
+	}
+	cur.last[k] = now
+	return true, nil
+}
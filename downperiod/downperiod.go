@@ -0,0 +1,419 @@
+package downperiod
+
+import (
+	"math"
+
+	"stock-backend/kline"
+)
+
+// State is where the fast EMA sits relative to the slow one.
+type State int
+
+const (
+	// Above is the fast EMA over the slow one. It is also the state before
+	// the first crossing has been seen.
+	Above State = iota
+	// CrossingDown is the bar on which the fast EMA fell below the slow one.
+	CrossingDown
+	// UnderWater is every following bar until the fast EMA recovers.
+	UnderWater
+	// CrossingUp is the bar on which the fast EMA got back above.
+	CrossingUp
+)
+
+func (s State) String() string {
+	switch s {
+	case CrossingDown:
+		return "crossing down"
+	case UnderWater:
+		return "under water"
+	case CrossingUp:
+		return "crossing up"
+	}
+	return "above"
+}
+
+// EventKind tells what happened on a bar.
+type EventKind int
+
+const (
+	// CrossDown: 下穿, the fast EMA crossed below the slow one.
+	CrossDown EventKind = iota
+	// CrossUp: 上穿, the down period is over.
+	CrossUp
+	// NewLow: 更新底部下线, the low undercut the down line.
+	NewLow
+	// TouchLow: 接触底部下线, the low came back to the down line.
+	TouchLow
+	// Climb: 增加底部上线, the low moved further above the down line than
+	// any bar since the last new low or touch.
+	Climb
+	// Drift: 趋近底部下线, the low moved back towards the down line.
+	Drift
+	// DownStrength: 下线转强, three rising closes while under water.
+	DownStrength
+	// UpStrength: 上线强, three rising closes while above.
+	UpStrength
+)
+
+// Event is something the machine noticed on a bar.
+type Event struct {
+	Kind  EventKind
+	Index int
+	Bar   kline.Bar
+	// Times is the number of bars spent under water so far.
+	Times int
+	// VolRatio is the strength events' three-bar volume against the running
+	// average, the down period's average for CrossUp and the up leg's
+	// average for CrossDown.
+	VolRatio float64
+	// MaxDiff is the largest squared distance from the down line seen since
+	// the last new low or touch, for Climb and Drift.
+	MaxDiff float64
+
+	// Period is the finished down period, for CrossUp.
+	Period *DownPeriod
+	// MA is the slow simple moving average of closes, for CrossUp.
+	MA float64
+	// Setup marks a CrossUp ending a quiet period right after a long, heavy
+	// one (the old "zzzz" marker).
+	Setup bool
+
+	// UpLine is the highest high of the up leg, for CrossDown.
+	UpLine float64
+	// UpTimes is the number of bars in the up leg, for CrossDown.
+	UpTimes int
+	// Rise is how far the up line sits above the previous down line as a
+	// fraction of the up line, for CrossDown. NaN until there is a previous
+	// down line to compare with.
+	Rise float64
+}
+
+// DownPeriod summarises one stretch with the fast EMA under the slow one.
+type DownPeriod struct {
+	// Timestamp is the bar the period started on; for a pending period it
+	// is the latest bar instead.
+	Timestamp int64
+	Climb     int
+	Update    int
+	Touch     int
+	Times     int
+	DownLine  float64
+	VolRatio  float64
+	UpLine    float64
+	EnterLine float64
+	AvgClose  float64
+	// Setup is only set on a pending period, see Event.Setup.
+	Setup bool
+}
+
+// Config holds the EMA periods and how many bars to skip before acting.
+type Config struct {
+	Fast   int
+	Slow   int
+	Warmup int
+}
+
+// DefaultConfig is the EMA5/EMA20 setup main.go has always used.
+var DefaultConfig = Config{Fast: 5, Slow: 20, Warmup: 21}
+
+// Machine runs the down-period logic over bars pushed one at a time, so a
+// full history and a live feed go through exactly the same code.
+type Machine struct {
+	cfg   Config
+	index int
+	state State
+
+	fast, slow *ema
+	closes     []float64
+	cumVol     float64
+	lastVols   [3]float64
+
+	prevClose float64
+	rising    int
+
+	// 水下阶段
+	downTs     int64
+	downVol    float64
+	downVal    float64
+	enterVal   float64
+	downLine   float64
+	downRatio  float64
+	downTimes  int
+	downUpdate int
+	downTouch  int
+	downClimb  int
+	downMax    float64
+
+	// 水上阶段
+	upVol   float64
+	upLine  float64
+	upTimes int
+
+	lineCount int
+	lastLine  float64
+
+	periods   []DownPeriod
+	pending   *DownPeriod
+	pendingAt int
+}
+
+func New(cfg Config) *Machine {
+	return &Machine{
+		cfg:    cfg,
+		fast:   newEMA(cfg.Fast),
+		slow:   newEMA(cfg.Slow),
+		closes: make([]float64, 0, cfg.Slow),
+	}
+}
+
+// State is the machine's state after the latest bar.
+func (m *Machine) State() State {
+	return m.state
+}
+
+// Periods returns the finished down periods.
+func (m *Machine) Periods() []DownPeriod {
+	return m.periods
+}
+
+// Pending is a snapshot of the unfinished down period as of the latest bar.
+// ok is false when the latest bar was not under water.
+func (m *Machine) Pending() (DownPeriod, bool) {
+	if m.pending == nil {
+		return DownPeriod{}, false
+	}
+	return *m.pending, true
+}
+
+// History returns the finished periods with the pending one slotted in where
+// it was taken.
+func (m *Machine) History() []DownPeriod {
+	res := append([]DownPeriod(nil), m.periods...)
+	if m.pending != nil {
+		res = append(res[:m.pendingAt], append([]DownPeriod{*m.pending}, res[m.pendingAt:]...)...)
+	}
+	return res
+}
+
+// Push feeds the next bar and returns what happened on it.
+func (m *Machine) Push(bar kline.Bar) []Event {
+	i := m.index
+	m.index++
+
+	fastPrev, slowPrev := m.fast.value, m.slow.value
+	m.fast.push(bar.Close)
+	m.slow.push(bar.Close)
+	m.cumVol += bar.Volume
+	copy(m.lastVols[:], m.lastVols[1:])
+	m.lastVols[2] = bar.Volume
+	if len(m.closes) == m.cfg.Slow {
+		m.closes = m.closes[1:]
+	}
+	m.closes = append(m.closes, bar.Close)
+	m.pending = nil
+
+	if i < m.cfg.Warmup {
+		return nil
+	}
+	if m.state == CrossingDown {
+		m.state = UnderWater
+	} else if m.state == CrossingUp {
+		m.state = Above
+	}
+
+	var events []Event
+	avgVol := m.cumVol / float64(i+1)
+	ev := func(kind EventKind) Event {
+		return Event{Kind: kind, Index: i, Bar: bar, Times: m.downTimes, Rise: math.NaN()}
+	}
+
+	if m.state == UnderWater {
+		m.downVol += bar.Volume
+		m.downVal += bar.Close
+		m.downTimes++
+		if m.risingClose(bar) {
+			m.downRatio = m.threeBarVol() / 3 / avgVol
+			e := ev(DownStrength)
+			e.VolRatio = m.downRatio
+			events = append(events, e)
+		}
+		if m.downLine > bar.Low {
+			m.downLine = bar.Low
+			m.downUpdate++
+			m.downMax = 0
+			events = append(events, ev(NewLow))
+		} else {
+			diff := (m.downLine - bar.Low) / m.downLine
+			diff = diff * diff * 10000
+			if diff < 0.0001 {
+				m.downTouch++
+				m.downMax = 0
+				events = append(events, ev(TouchLow))
+			} else if diff > m.downMax {
+				m.downClimb++
+				m.downMax = diff
+				e := ev(Climb)
+				e.MaxDiff = m.downMax
+				events = append(events, e)
+			} else {
+				e := ev(Drift)
+				e.MaxDiff = m.downMax
+				events = append(events, e)
+			}
+		}
+		m.pending = &DownPeriod{
+			Timestamp: bar.Timestamp,
+			Climb:     m.downClimb,
+			Update:    m.downUpdate,
+			Touch:     m.downTouch,
+			Times:     m.downTimes,
+			DownLine:  m.downLine,
+			VolRatio:  m.downRatio,
+			EnterLine: m.enterVal,
+			AvgClose:  m.downVal / float64(m.downTimes),
+			Setup:     m.setup(),
+		}
+		m.pendingAt = len(m.periods)
+	} else {
+		m.upTimes++
+		m.upVol += bar.Volume
+		if m.risingClose(bar) {
+			e := ev(UpStrength)
+			e.VolRatio = m.threeBarVol() / 3 / avgVol
+			events = append(events, e)
+		}
+		if m.upLine < bar.High {
+			m.upLine = bar.High
+		}
+	}
+	m.prevClose = bar.Close
+
+	fast, slow := m.fast.value, m.slow.value
+	if fastPrev < slowPrev && fast > slow {
+		e := ev(CrossUp)
+		e.Setup = len(m.periods) > 0 && m.setup()
+		m.downRatio = m.downVol / float64(m.downTimes) / avgVol
+		p := DownPeriod{
+			Timestamp: m.downTs,
+			Climb:     m.downClimb,
+			Update:    m.downUpdate,
+			Touch:     m.downTouch,
+			Times:     m.downTimes,
+			DownLine:  m.downLine,
+			VolRatio:  m.downRatio,
+			EnterLine: bar.High,
+			AvgClose:  m.downVal / float64(m.downTimes),
+		}
+		m.periods = append(m.periods, p)
+		e.Period = &p
+		e.VolRatio = p.VolRatio
+		e.MA = calculateSMA(m.closes)
+		events = append(events, e)
+
+		m.addLine(m.downLine)
+		m.upVol = bar.Volume
+		m.upLine = bar.High
+		m.rising = 0
+		m.downVol, m.downClimb, m.downTouch, m.downUpdate = 0, 0, 0, 0
+		m.upTimes = 0
+		m.state = CrossingUp
+	}
+	if fastPrev > slowPrev && fast < slow {
+		e := ev(CrossDown)
+		if m.lineCount > 1 {
+			e.Rise = (m.upLine - m.lastLine) / m.upLine
+		}
+		if len(m.periods) > 1 {
+			m.periods[len(m.periods)-1].UpLine = m.upLine
+			m.periods[len(m.periods)-1].AvgClose = m.downVal / float64(m.downTimes)
+		}
+		m.addLine(m.upLine)
+		e.UpLine = m.upLine
+		e.UpTimes = m.upTimes
+		e.VolRatio = m.upVol / float64(m.upTimes) / avgVol
+
+		m.downTimes = 1
+		m.downTs = bar.Timestamp
+		m.downVal = bar.Close
+		m.enterVal = bar.Close
+		m.downLine = bar.Low
+		m.downVol = bar.Volume
+		m.downMax = 0
+		m.upVol = 0
+		m.state = CrossingDown
+		e.Times = m.downTimes
+		events = append(events, e)
+	}
+	return events
+}
+
+// setup is the quiet-after-heavy pattern: the running period rarely made new
+// lows and is trading on light volume, right after a down period of more than
+// ten bars on heavy volume.
+func (m *Machine) setup() bool {
+	if m.downTimes == 0 || len(m.periods) == 0 {
+		return false
+	}
+	last := m.periods[len(m.periods)-1]
+	// 原逻辑是整数除法 downUpdate/downtimes < 0.2，即更新根数少于水下根数
+	return m.downUpdate < m.downTimes && m.downRatio < 1 && last.VolRatio > 1 && last.Times > 10
+}
+
+// risingClose counts consecutive higher closes and reports every third one.
+func (m *Machine) risingClose(bar kline.Bar) bool {
+	if m.prevClose < bar.Close {
+		m.rising++
+	} else {
+		m.rising = 0
+	}
+	if m.rising >= 3 {
+		m.rising = 0
+		return true
+	}
+	return false
+}
+
+func (m *Machine) threeBarVol() float64 {
+	return m.lastVols[0] + m.lastVols[1] + m.lastVols[2]
+}
+
+func (m *Machine) addLine(v float64) {
+	m.lineCount++
+	m.lastLine = v
+}
+
+// ema is calculateEMA in streaming form: NaN until n values have been seen,
+// seeded with their SMA.
+type ema struct {
+	n     int
+	k     float64
+	count int
+	sum   float64
+	value float64
+}
+
+func newEMA(n int) *ema {
+	return &ema{n: n, k: 2.0 / float64(n+1), value: math.NaN()}
+}
+
+func (e *ema) push(v float64) {
+	e.count++
+	switch {
+	case e.count < e.n:
+		e.sum += v
+	case e.count == e.n:
+		e.sum += v
+		e.value = e.sum / float64(e.n)
+	default:
+		e.value = v*e.k + e.value*(1-e.k)
+	}
+}
+
+func calculateSMA(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
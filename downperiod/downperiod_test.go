@@ -0,0 +1,265 @@
+package downperiod
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"stock-backend/kline"
+)
+
+// randomBars is a seeded random walk in cents with trending stretches, so the
+// EMAs cross often and lows land exactly on earlier lows now and then.
+func randomBars(seed int64, n int) []kline.Bar {
+	r := rand.New(rand.NewSource(seed))
+	cents := func(v float64) float64 { return math.Round(v*100) / 100 }
+	bars := make([]kline.Bar, n)
+	price, drift := 10.0, 0.0
+	for i := range bars {
+		if i%15 == 0 {
+			drift = (r.Float64() - 0.5) * 0.02
+		}
+		open := cents(price)
+		price = math.Max(1, price*(1+drift+(r.Float64()-0.5)*0.03))
+		c := cents(price)
+		bars[i] = kline.Bar{
+			Timestamp: int64(i+1) * 86400000,
+			Open:      open,
+			High:      cents(math.Max(open, c) * (1 + r.Float64()*0.01)),
+			Low:       cents(math.Min(open, c) * (1 - r.Float64()*0.01)),
+			Close:     c,
+			Volume:    float64(1000 + r.Intn(9000)),
+		}
+	}
+	return bars
+}
+
+// oldLoop is the EMA5/EMA20 loop main.go ran before Machine existed, with the
+// running.txt lines turned into Events and the array indexing kept as it was.
+// The last-bar pending period is returned apart, and its setup check skips
+// the lookup that panicked when there was no finished period yet.
+func oldLoop(bars []kline.Bar) (events []Event, downPrds []DownPeriod, pending *DownPeriod) {
+	var z, vols []float64
+	var avgVol float64
+	for _, bar := range bars {
+		z = append(z, bar.Close)
+		avgVol += bar.Volume
+		vols = append(vols, avgVol)
+	}
+	ema5 := oldEMA(z, 5)
+	ema20 := oldEMA(z, 20)
+	ma20 := oldMA(z, 20)
+
+	var lines []float64
+	var downDiffMax float64
+	down := false
+	upline, downline, previousClose := 0.0, 0.0, 0.0
+	uptimes, downtimes, previousTimes := 0, 0, 0
+	downUpdate, downTouch, downClimb := 0, 0, 0
+	var downTs int64
+	downVal, downratio, enterVal, downVol, upVol := 0.0, 0.0, 0.0, 0.0, 0.0
+	setup := func() bool {
+		return len(downPrds) > 0 && downtimes > 0 && float64(downUpdate/downtimes) < 0.2 && downratio < 1 && downPrds[len(downPrds)-1].VolRatio > 1 && downPrds[len(downPrds)-1].Times > 10
+	}
+
+	for i, bar := range bars {
+		if i < 21 {
+			continue
+		}
+		ev := func(kind EventKind) Event {
+			return Event{Kind: kind, Index: i, Times: downtimes, Rise: math.NaN()}
+		}
+		avgVol = vols[i] / float64(i+1)
+		if down {
+			downVol += bar.Volume
+			downVal += bar.Close
+			downtimes++
+			if previousClose < bar.Close {
+				previousTimes++
+			} else {
+				previousTimes = 0
+			}
+			if previousTimes >= 3 {
+				previousTimes = 0
+				downratio = (vols[i] - vols[i-3]) / 3 / avgVol
+				e := ev(DownStrength)
+				e.VolRatio = downratio
+				events = append(events, e)
+			}
+			if downline > bar.Low {
+				downline = bar.Low
+				downUpdate++
+				events = append(events, ev(NewLow))
+				downDiffMax = 0
+			} else {
+				diff := (downline - bar.Low) / downline
+				diff = diff * diff * 10000
+				if diff < 0.0001 {
+					downTouch++
+					events = append(events, ev(TouchLow))
+					downDiffMax = 0
+				} else if diff > downDiffMax {
+					downClimb++
+					downDiffMax = diff
+					e := ev(Climb)
+					e.MaxDiff = downDiffMax
+					events = append(events, e)
+				} else {
+					e := ev(Drift)
+					e.MaxDiff = downDiffMax
+					events = append(events, e)
+				}
+			}
+			if i == len(bars)-1 {
+				pending = &DownPeriod{Timestamp: bar.Timestamp, Climb: downClimb, Update: downUpdate, Touch: downTouch, Times: downtimes, DownLine: downline, VolRatio: downratio, EnterLine: enterVal, AvgClose: downVal / float64(downtimes), Setup: setup()}
+			}
+		} else {
+			uptimes++
+			upVol += bar.Volume
+			if previousClose < bar.Close {
+				previousTimes++
+			} else {
+				previousTimes = 0
+			}
+			if previousTimes >= 3 {
+				previousTimes = 0
+				e := ev(UpStrength)
+				e.VolRatio = (vols[i] - vols[i-3]) / 3 / avgVol
+				events = append(events, e)
+			}
+			if upline < bar.High {
+				upline = bar.High
+			}
+		}
+		previousClose = bar.Close
+		if ema5[i-5] < ema20[i-20] && ema5[i-4] > ema20[i-19] {
+			e := ev(CrossUp)
+			e.Setup = setup()
+			downratio = downVol / float64(downtimes) / avgVol
+			downPrds = append(downPrds, DownPeriod{Timestamp: downTs, Climb: downClimb, Update: downUpdate, Touch: downTouch, Times: downtimes, DownLine: downline, VolRatio: downratio, EnterLine: bar.High, AvgClose: downVal / float64(downtimes)})
+			e.VolRatio = downVol / float64(downtimes) / avgVol
+			e.MA = ma20[i-19]
+			events = append(events, e)
+			lines = append(lines, downline)
+			upVol = bar.Volume
+			upline = bar.High
+			previousTimes = 0
+			downVol, downClimb, downTouch, downUpdate = 0, 0, 0, 0
+			down = false
+			uptimes = 0
+		}
+		if ema5[i-5] > ema20[i-20] && ema5[i+1-5] < ema20[i+1-20] {
+			e := ev(CrossDown)
+			if len(lines) > 1 {
+				e.Rise = (upline - lines[len(lines)-1]) / upline
+			}
+			if len(downPrds) > 1 {
+				downPrds[len(downPrds)-1].UpLine = upline
+				downPrds[len(downPrds)-1].AvgClose = downVal / float64(downtimes)
+			}
+			lines = append(lines, upline)
+			down = true
+			downtimes = 1
+			downTs = bar.Timestamp
+			downVal = bar.Close
+			enterVal = bar.Close
+			downline = bar.Low
+			downVol = bar.Volume
+			downDiffMax = 0
+			e.Times = downtimes
+			e.UpLine = upline
+			e.UpTimes = uptimes
+			e.VolRatio = upVol / float64(uptimes) / avgVol
+			events = append(events, e)
+			upVol = 0
+		}
+	}
+	return events, downPrds, pending
+}
+
+func oldEMA(prices []float64, n int) []float64 {
+	k := 2.0 / float64(n+1)
+	res := []float64{calculateSMA(prices[:n])}
+	for i := n; i < len(prices); i++ {
+		res = append(res, prices[i]*k+res[i-n]*(1-k))
+	}
+	return res
+}
+
+func oldMA(prices []float64, period int) []float64 {
+	var res []float64
+	for i := 0; i <= len(prices)-period; i++ {
+		sum := 0.0
+		for j := 0; j < period; j++ {
+			sum += prices[i+j]
+		}
+		res = append(res, sum/float64(period))
+	}
+	return res
+}
+
+func near(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func samePeriod(a, b DownPeriod) bool {
+	return a.Timestamp == b.Timestamp && a.Climb == b.Climb && a.Update == b.Update && a.Touch == b.Touch &&
+		a.Times == b.Times && a.Setup == b.Setup && near(a.DownLine, b.DownLine) && near(a.VolRatio, b.VolRatio) &&
+		near(a.UpLine, b.UpLine) && near(a.EnterLine, b.EnterLine) && near(a.AvgClose, b.AvgClose)
+}
+
+func TestMachineMatchesOldLoop(t *testing.T) {
+	kinds := map[EventKind]int{}
+	for seed := int64(1); seed <= 20; seed++ {
+		bars := randomBars(seed, 400)
+		wantEvents, wantPeriods, wantPending := oldLoop(bars)
+
+		m := New(DefaultConfig)
+		var got []Event
+		for _, bar := range bars {
+			got = append(got, m.Push(bar)...)
+		}
+
+		if len(got) != len(wantEvents) {
+			t.Fatalf("seed %d: %d events, want %d", seed, len(got), len(wantEvents))
+		}
+		for k, w := range wantEvents {
+			g := got[k]
+			kinds[g.Kind]++
+			if g.Kind != w.Kind || g.Index != w.Index || g.Bar != bars[w.Index] || g.Times != w.Times ||
+				g.UpTimes != w.UpTimes || g.Setup != w.Setup || !near(g.VolRatio, w.VolRatio) ||
+				!near(g.MaxDiff, w.MaxDiff) || !near(g.MA, w.MA) || !near(g.UpLine, w.UpLine) || !near(g.Rise, w.Rise) {
+				t.Fatalf("seed %d: event %d = %+v, want %+v", seed, k, g, w)
+			}
+		}
+		periods := m.Periods()
+		if len(periods) != len(wantPeriods) {
+			t.Fatalf("seed %d: %d periods, want %d", seed, len(periods), len(wantPeriods))
+		}
+		for k := range periods {
+			if !samePeriod(periods[k], wantPeriods[k]) {
+				t.Errorf("seed %d: period %d = %+v, want %+v", seed, k, periods[k], wantPeriods[k])
+			}
+		}
+
+		p, ok := m.Pending()
+		if ok != (wantPending != nil) {
+			t.Fatalf("seed %d: pending %v, want %v", seed, ok, wantPending != nil)
+		}
+		if ok && !samePeriod(p, *wantPending) {
+			t.Errorf("seed %d: pending %+v, want %+v", seed, p, *wantPending)
+		}
+		if m.State() == UnderWater && !ok {
+			t.Errorf("seed %d: under water without a pending period", seed)
+		}
+	}
+	// 每种事件都要出现过，否则这组数据比不出什么
+	for kind := CrossDown; kind <= UpStrength; kind++ {
+		if kinds[kind] == 0 {
+			t.Errorf("no event of kind %d", kind)
+		}
+	}
+}
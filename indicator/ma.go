@@ -0,0 +1,75 @@
+package indicator
+
+import "math"
+
+// MA returns the simple moving average of values over period. The result has
+// the same length as values; entries before the first full window are NaN.
+func MA(values []float64, period int) []float64 {
+	res := nan(len(values))
+	if period <= 0 || len(values) < period {
+		return res
+	}
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			res[i] = sum / float64(period)
+		}
+	}
+	return res
+}
+
+// EMA returns the n-period exponential moving average aligned with values.
+// Like calculateEMA it is seeded with the SMA of the first n values, so the
+// first n-1 entries are NaN.
+func EMA(values []float64, n int) []float64 {
+	res := nan(len(values))
+	if n <= 0 || len(values) < n {
+		return res
+	}
+	k := 2.0 / float64(n+1)
+	res[n-1] = SMA(values[:n])
+	for i := n; i < len(values); i++ {
+		res[i] = values[i]*k + res[i-1]*(1-k)
+	}
+	return res
+}
+
+// SMA is the plain average of values.
+func SMA(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// CrossUp reports whether fast crossed above slow at i.
+func CrossUp(fast, slow []float64, i int) bool {
+	if i < 1 || i >= len(fast) || i >= len(slow) {
+		return false
+	}
+	return fast[i-1] < slow[i-1] && fast[i] > slow[i]
+}
+
+// CrossDown reports whether fast crossed below slow at i.
+func CrossDown(fast, slow []float64, i int) bool {
+	if i < 1 || i >= len(fast) || i >= len(slow) {
+		return false
+	}
+	return fast[i-1] > slow[i-1] && fast[i] < slow[i]
+}
+
+func nan(n int) []float64 {
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = math.NaN()
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/chart"
+	"stock-backend/kline"
+	"stock-backend/strategy"
+	"stock-backend/volprofile"
+)
+
+// readSymbols reads one symbol per line, skipping blanks.
+func readSymbols(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var symbols []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if s := strings.TrimSpace(scanner.Text()); s != "" {
+			symbols = append(symbols, s)
+		}
+	}
+	return symbols, scanner.Err()
+}
+
+func main() {
+	symbolsFile := flag.String("symbols", "symbols.txt", "file with one symbol per line")
+	market := flag.String("market", "cn", "market: cn or us")
+	period := flag.String("period", string(kline.Day), "bar period: day, week or 15m")
+	n := flag.Int("bars", 180, "number of latest bars to draw")
+	out := flag.String("out", ".", "directory to write the charts to")
+	format := flag.String("format", "png", "image format: png or svg")
+	ema := flag.Bool("ema", false, "draw EMA5 and EMA20 as well as the MAs")
+	gaps := flag.Int("gaps", 5, "mark gaps over the highs of this many bars, 0 for none")
+	levels := flag.Bool("levels", false, "draw support and resistance from the volume profile of the drawn bars: value area, POC and high-volume nodes")
+	strategies := flag.String("strategy", "", "comma-separated strategies whose signals to mark")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	flag.Parse()
+
+	if *format != "png" && *format != "svg" {
+		log.Fatalf("Unknown format %q, want png or svg", *format)
+	}
+	var strats []strategy.Strategy
+	for _, name := range strings.Split(*strategies, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		s, err := strategy.Get(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		strats = append(strats, s)
+	}
+	symbols, err := readSymbols(*symbolsFile)
+	if err != nil {
+		log.Fatalf("Failed to read symbols: %v", err)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	src := kline.NewClickHouseSource(conn, *market)
+	start := time.Now()
+	drawn := 0
+	for _, symbol := range symbols {
+		bars, err := src.Latest(ctx, symbol, kline.Period(*period), *n)
+		if err != nil {
+			log.Fatalf("Failed to load bars: %v", err)
+		}
+		// 和原来的 Python 脚本一样，数据不足的跳过
+		if len(bars) < *n {
+			fmt.Printf("%s 只有 %d 根K线，跳过\n", symbol, len(bars))
+			continue
+		}
+		k := chart.KLine{Title: symbol, Bars: bars}
+		for _, m := range []int{5, 10, 20, 30, 60} {
+			k.Overlays = append(k.Overlays, chart.MA(bars, m))
+		}
+		if *ema {
+			k.Overlays = append(k.Overlays, chart.EMA(bars, 5), chart.EMA(bars, 20))
+		}
+		if *gaps > 0 {
+			k.Levels = chart.Gaps(bars, *gaps)
+		}
+		if *levels {
+			vl, err := chart.VolumeLevels(bars, volprofile.Options{})
+			if err != nil {
+				fmt.Printf("%s 没有成交量分布: %v\n", symbol, err)
+			}
+			k.Levels = append(k.Levels, vl...)
+		}
+		for _, s := range strats {
+			sigs, err := strategy.Scan(s, symbol, bars)
+			if err != nil {
+				log.Fatalf("Failed to scan %s: %v", symbol, err)
+			}
+			k.Markers = append(k.Markers, chart.Signals(sigs)...)
+		}
+		path := filepath.Join(*out, fmt.Sprintf("%s_candlestick.%s", symbol, *format))
+		if err := k.Save(path); err != nil {
+			log.Fatalf("Failed to save chart: %v", err)
+		}
+		drawn++
+	}
+	fmt.Printf("生成 %d 张K线图, 耗时：%s\n", drawn, time.Since(start))
+}
@@ -0,0 +1,144 @@
+package kline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MultiFrame lines a base series up with higher timeframe series of the same
+// symbol. For every base bar it records the latest higher bar that had
+// already closed when the base bar closed, so a rule evaluated on base bar i
+// never sees a daily or weekly bar that was still forming.
+//
+// A rule such as "15m EMA5 crosses EMA20 while above the daily MA20" reads:
+//
+//	ma20 := indicator.MA(kline.Closes(mf.Higher(kline.Day)), 20)
+//	if crossUp(i) && mf.Bars[i].Close > mf.Value(kline.Day, i, ma20) { ... }
+type MultiFrame struct {
+	Base Period
+	Bars []Bar
+	// Start is the first base bar at or after the requested From; bars before
+	// it were only loaded to warm indicators up.
+	Start int
+
+	higher map[Period][]Bar
+	index  map[Period][]int
+}
+
+// Request describes the series Load should fetch.
+type Request struct {
+	Symbol string
+	Base   Period
+	Higher []Period
+	From   int64
+	To     int64
+	// Warmup is extra history loaded before From for every series so moving
+	// averages on the higher timeframes are primed at the first base bar.
+	Warmup time.Duration
+}
+
+// Load reads the base and higher series for req.Symbol from src and aligns
+// them.
+func Load(ctx context.Context, src Source, req Request) (*MultiFrame, error) {
+	from := req.From - req.Warmup.Milliseconds()
+	bars, err := src.Bars(ctx, req.Symbol, req.Base, from, req.To)
+	if err != nil {
+		return nil, err
+	}
+	higher := make(map[Period][]Bar, len(req.Higher))
+	for _, p := range req.Higher {
+		// 高周期多取一根，保证第一根基础 K 线之前的那根已收盘的高周期 K 线也在
+		hb, err := src.Bars(ctx, req.Symbol, p, from-p.Duration().Milliseconds(), req.To)
+		if err != nil {
+			return nil, err
+		}
+		higher[p] = hb
+	}
+	mf, err := Align(req.Base, bars, higher)
+	if err != nil {
+		return nil, fmt.Errorf("align %s: %w", req.Symbol, err)
+	}
+	for mf.Start < len(mf.Bars) && mf.Bars[mf.Start].Timestamp < req.From {
+		mf.Start++
+	}
+	return mf, nil
+}
+
+// Align builds a MultiFrame from already loaded series. All series must be
+// sorted by timestamp ascending.
+func Align(base Period, bars []Bar, higher map[Period][]Bar) (*MultiFrame, error) {
+	if err := checkSorted(bars); err != nil {
+		return nil, fmt.Errorf("%s: %w", base, err)
+	}
+	mf := &MultiFrame{
+		Base:   base,
+		Bars:   bars,
+		higher: make(map[Period][]Bar, len(higher)),
+		index:  make(map[Period][]int, len(higher)),
+	}
+	for p, hb := range higher {
+		if p.Duration() <= base.Duration() {
+			return nil, fmt.Errorf("%s is not a higher timeframe than %s", p, base)
+		}
+		if err := checkSorted(hb); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		idx := make([]int, len(bars))
+		j := -1
+		for i, b := range bars {
+			end := b.End(base)
+			for j+1 < len(hb) && hb[j+1].End(p) <= end {
+				j++
+			}
+			idx[i] = j
+		}
+		mf.higher[p] = hb
+		mf.index[p] = idx
+	}
+	return mf, nil
+}
+
+// Higher returns the full higher timeframe series for p.
+func (m *MultiFrame) Higher(p Period) []Bar {
+	return m.higher[p]
+}
+
+// Index returns the index into Higher(p) of the latest bar that had closed by
+// the end of base bar i, or -1 if none had.
+func (m *MultiFrame) Index(p Period, i int) int {
+	idx, ok := m.index[p]
+	if !ok || i < 0 || i >= len(idx) {
+		return -1
+	}
+	return idx[i]
+}
+
+// At returns the latest closed higher bar visible from base bar i.
+func (m *MultiFrame) At(p Period, i int) (Bar, bool) {
+	j := m.Index(p, i)
+	if j < 0 {
+		return Bar{}, false
+	}
+	return m.higher[p][j], true
+}
+
+// Value picks the entry of series, computed over Higher(p), that base bar i
+// is allowed to see. It returns NaN when no higher bar has closed yet.
+func (m *MultiFrame) Value(p Period, i int, series []float64) float64 {
+	j := m.Index(p, i)
+	if j < 0 || j >= len(series) {
+		return math.NaN()
+	}
+	return series[j]
+}
+
+func checkSorted(bars []Bar) error {
+	for i := 1; i < len(bars); i++ {
+		if bars[i].Timestamp <= bars[i-1].Timestamp {
+			return fmt.Errorf("bars not in ascending timestamp order at %d", i)
+		}
+	}
+	return nil
+}
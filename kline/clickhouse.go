@@ -0,0 +1,139 @@
+package kline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Source loads bars for one symbol in the half-open range [from, to), both
+// unix milliseconds. A to of 0 means up to the latest stored bar.
+type Source interface {
+	Bars(ctx context.Context, symbol string, period Period, from, to int64) ([]Bar, error)
+}
+
+// BulkSource is a Source that can also load many symbols in one round
+// trip, for backtests over a whole market.
+type BulkSource interface {
+	Source
+	// BarsMany returns the bars of each of symbols in [from, to), oldest
+	// first; symbols without bars are missing from the map.
+	BarsMany(ctx context.Context, symbols []string, period Period, from, to int64) (map[string][]Bar, error)
+}
+
+// ClickHouseSource reads bars from the <market>_stock_<period> tables that the
+// xueqiu-feed importers fill.
+type ClickHouseSource struct {
+	Conn   driver.Conn
+	Market string
+	// Index reads the <market>_index_<period> tables instead, where the
+	// benchmark indices are fed.
+	Index bool
+}
+
+func NewClickHouseSource(conn driver.Conn, market string) *ClickHouseSource {
+	return &ClickHouseSource{Conn: conn, Market: market}
+}
+
+// NewIndexSource reads index bars, such as SH000300, for a market.
+func NewIndexSource(conn driver.Conn, market string) *ClickHouseSource {
+	return &ClickHouseSource{Conn: conn, Market: market, Index: true}
+}
+
+func (s *ClickHouseSource) table(period Period) (string, error) {
+	if s.Index {
+		return period.IndexTable(s.Market)
+	}
+	return period.Table(s.Market)
+}
+
+// barColumns is the select list scanBars expects.
+const barColumns = `toInt64(timestamp), toFloat64(open), toFloat64(high), toFloat64(low), toFloat64(close),
+	toFloat64(volume), toFloat64(ifNull(amount, 0)), toFloat64(ifNull(turnoverrate, 0))`
+
+func (s *ClickHouseSource) Bars(ctx context.Context, symbol string, period Period, from, to int64) ([]Bar, error) {
+	table, err := s.table(period)
+	if err != nil {
+		return nil, err
+	}
+	if to <= 0 {
+		to = 1<<63 - 1
+	}
+	query := `SELECT ` + barColumns + `
+		FROM ` + table + `
+		WHERE symbol = ? AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp ASC`
+	rows, err := s.Conn.Query(ctx, query, symbol, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query %s for %s: %w", table, symbol, err)
+	}
+	return scanBars(rows, table, symbol)
+}
+
+// BarsMany reads the bars of all symbols with a single query.
+func (s *ClickHouseSource) BarsMany(ctx context.Context, symbols []string, period Period, from, to int64) (map[string][]Bar, error) {
+	table, err := s.table(period)
+	if err != nil {
+		return nil, err
+	}
+	if to <= 0 {
+		to = 1<<63 - 1
+	}
+	query := `SELECT symbol, ` + barColumns + `
+		FROM ` + table + `
+		WHERE symbol IN ? AND timestamp >= ? AND timestamp < ?
+		ORDER BY symbol, timestamp ASC`
+	rows, err := s.Conn.Query(ctx, query, symbols, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query %s for %d symbols: %w", table, len(symbols), err)
+	}
+	defer rows.Close()
+	res := make(map[string][]Bar, len(symbols))
+	for rows.Next() {
+		var (
+			symbol string
+			b      Bar
+		)
+		if err := rows.Scan(&symbol, &b.Timestamp, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume, &b.Amount, &b.TurnoverRate); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", table, err)
+		}
+		res[symbol] = append(res[symbol], b)
+	}
+	return res, rows.Err()
+}
+
+// Latest returns the n most recent bars of symbol, oldest first.
+func (s *ClickHouseSource) Latest(ctx context.Context, symbol string, period Period, n int) ([]Bar, error) {
+	table, err := s.table(period)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + barColumns + `
+		FROM ` + table + `
+		WHERE symbol = ?
+		ORDER BY timestamp DESC
+		LIMIT ?`
+	rows, err := s.Conn.Query(ctx, query, symbol, n)
+	if err != nil {
+		return nil, fmt.Errorf("query %s for %s: %w", table, symbol, err)
+	}
+	bars, err := scanBars(rows, table, symbol)
+	for i, j := 0, len(bars)-1; i < j; i, j = i+1, j-1 {
+		bars[i], bars[j] = bars[j], bars[i]
+	}
+	return bars, err
+}
+
+func scanBars(rows driver.Rows, table, symbol string) ([]Bar, error) {
+	defer rows.Close()
+	var bars []Bar
+	for rows.Next() {
+		var b Bar
+		if err := rows.Scan(&b.Timestamp, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume, &b.Amount, &b.TurnoverRate); err != nil {
+			return nil, fmt.Errorf("scan %s for %s: %w", table, symbol, err)
+		}
+		bars = append(bars, b)
+	}
+	return bars, rows.Err()
+}
@@ -0,0 +1,161 @@
+package kline
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"stock-backend/calendar"
+)
+
+// Period is a bar size as xueqiu names it in the kline "period" parameter.
+type Period string
+
+const (
+	Min15 Period = "15m"
+	Day   Period = "day"
+	Week  Period = "week"
+)
+
+// Duration is the length of one bar. A bar is treated as complete once this
+// much time has passed since its timestamp.
+func (p Period) Duration() time.Duration {
+	switch p {
+	case Min15:
+		return 15 * time.Minute
+	case Day:
+		return 24 * time.Hour
+	case Week:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Warmup is how far before a start date to load so that n bars of history
+// precede it: twice their length plus ten days for daily and weekly bars.
+// Intraday bars only come during the market's sessions, so they are
+// counted in trading days instead, again doubled for weekends and holidays.
+func (p Period) Warmup(market string, n int) time.Duration {
+	const day = 24 * time.Hour
+	cal, err := calendar.Get(market)
+	if p.Duration() >= day || err != nil {
+		return time.Duration(n*2)*p.Duration() + 10*day
+	}
+	perDay := cal.BarsPerDay(p.Duration())
+	return time.Duration((n+perDay-1)/perDay*2)*day + 10*day
+}
+
+// Table returns the ClickHouse table holding this period for a market,
+// e.g. cn_stock_daily.
+func (p Period) Table(market string) (string, error) {
+	switch p {
+	case Min15:
+		return market + "_stock_15m", nil
+	case Day:
+		return market + "_stock_daily", nil
+	case Week:
+		return market + "_stock_weekly", nil
+	}
+	return "", fmt.Errorf("unknown period %q", p)
+}
+
+// IndexTable returns the ClickHouse table holding index bars for a market,
+// e.g. cn_index_daily. Only daily index bars are fed.
+func (p Period) IndexTable(market string) (string, error) {
+	if p != Day {
+		return "", fmt.Errorf("no %s index bars, only %s", p, Day)
+	}
+	return market + "_index_daily", nil
+}
+
+// Bar is one candlestick. Timestamp is the bar open time in unix
+// milliseconds, the same value xueqiu returns and ClickHouse stores.
+type Bar struct {
+	Timestamp    int64
+	Open         float64
+	High         float64
+	Low          float64
+	Close        float64
+	Volume       float64
+	Amount       float64
+	TurnoverRate float64
+}
+
+// End is the unix millisecond time at which the bar is complete.
+func (b Bar) End(p Period) int64 {
+	return b.Timestamp + p.Duration().Milliseconds()
+}
+
+// Time converts the bar timestamp to a time.Time.
+func (b Bar) Time() time.Time {
+	return time.UnixMilli(b.Timestamp)
+}
+
+// Closes returns the close prices of bars.
+func Closes(bars []Bar) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.Close
+	}
+	return res
+}
+
+// Volumes returns the volumes of bars.
+func Volumes(bars []Bar) []float64 {
+	res := make([]float64, len(bars))
+	for i, b := range bars {
+		res[i] = b.Volume
+	}
+	return res
+}
+
+// ATR is the simple average true range of the last n bars, 0 when there
+// are not enough.
+func ATR(bars []Bar, n int) float64 {
+	if n <= 0 || len(bars) <= n {
+		return 0
+	}
+	sum := 0.0
+	for i := len(bars) - n; i < len(bars); i++ {
+		b, prev := bars[i], bars[i-1].Close
+		sum += math.Max(b.High, prev) - math.Min(b.Low, prev)
+	}
+	return sum / float64(n)
+}
+
+// FromItems converts the "column"/"item" arrays of a xueqiu kline response
+// into bars, looking columns up by name instead of by position.
+func FromItems(column []string, items [][]interface{}) ([]Bar, error) {
+	idx := make(map[string]int, len(column))
+	for i, name := range column {
+		idx[name] = i
+	}
+	for _, name := range []string{"timestamp", "open", "high", "low", "close"} {
+		if _, ok := idx[name]; !ok {
+			return nil, fmt.Errorf("kline column %q missing", name)
+		}
+	}
+	value := func(item []interface{}, name string) float64 {
+		i, ok := idx[name]
+		if !ok || i >= len(item) {
+			return 0
+		}
+		v, _ := item[i].(float64)
+		return v
+	}
+
+	bars := make([]Bar, 0, len(items))
+	for _, item := range items {
+		bars = append(bars, Bar{
+			Timestamp:    int64(value(item, "timestamp")),
+			Open:         value(item, "open"),
+			High:         value(item, "high"),
+			Low:          value(item, "low"),
+			Close:        value(item, "close"),
+			Volume:       value(item, "volume"),
+			Amount:       value(item, "amount"),
+			TurnoverRate: value(item, "turnoverrate"),
+		})
+	}
+	return bars, nil
+}
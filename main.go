@@ -3,17 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"gopkg.in/gomail.v2"
+
+	"stock-backend/dedupe"
+	"stock-backend/downperiod"
+	"stock-backend/kline"
+	"stock-backend/scoring"
+	"stock-backend/screener"
+	"stock-backend/signals"
+	"stock-backend/strategy"
 )
 
 type Market struct {
@@ -136,47 +144,6 @@ type KLine struct {
 	Volume    int
 }
 
-type Point struct {
-	index   int
-	close   float64
-	low     float64
-	high    float64
-	trigger int
-	ts      int64
-}
-
-type DownPeriod struct {
-	ts         int
-	downClimb  int
-	downUpdate int
-	downTouch  int
-	downtimes  int
-	downline   float64
-	downRatio  float64
-	upLine     float64
-	enterLine  float64
-	avgVal     float64
-}
-
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -240,23 +207,17 @@ func calculateSMA(prices []float64) float64 {
 }
 
 func main() {
-	ticker := time.NewTicker(15 * time.Minute)
-
-	// 启动一个 goroutine 来执行定时任务
-	go func() {
-		index := 1
-		for {
-			select {
-			case <-ticker.C:
-				err := copyFile("running.txt", "destination"+strconv.Itoa(index)+".txt")
-				if err != nil {
-					fmt.Println("Error copying file:", err)
-				} else {
-					fmt.Println("File copied successfully at", time.Now().Format(time.RFC3339))
-				}
-			}
+	verbose := flag.Bool("v", false, "print every down-period event, not just the signals")
+	weightsFile := flag.String("weights", "", "YAML file with scoring weights, empty for the defaults")
+	flag.Parse()
+	weights := scoring.Default
+	if *weightsFile != "" {
+		var err error
+		weights, err = scoring.Load(*weightsFile)
+		if err != nil {
+			log.Fatalf("Failed to load weights: %v", err)
 		}
-	}()
+	}
 	// // 注册登陆二维码回调
 	// bot.UUIDCallback = openwechat.PrintlnQrcodeUrl
 
@@ -294,35 +255,31 @@ func main() {
 	}
 	defer conn.Close()
 
-	// 读取SQL脚本文件内容
-	sqlFile, err := ioutil.ReadFile("./script_weekly_pop.sql")
+	// 原来读的 script_weekly_pop.sql 已经不在了，它扫描的 6 列与 near-high 一致
+	screens, err := screener.Open(screener.DefaultDir)
 	if err != nil {
-		log.Fatalf("Failed to read SQL script file: %v", err)
+		log.Fatalf("Failed to load screens: %v", err)
 	}
-
-	// 将文件内容转换为字符串
-	sqlStatements := string(sqlFile)
-	printedSymbols := make(map[string]bool)
-	err = os.Remove("running.txt")
+	store, err := signals.Open(context.Background(), conn)
+	if err != nil {
+		log.Fatalf("Failed to open signals: %v", err)
+	}
+	// 最后一根15分钟K线还在走，每轮都可能再次触发，同一策略同一只股票15分钟内只记一次
+	alerts, err := dedupe.Open(context.Background(), conn, dedupe.Options{Cooldown: 15 * time.Minute})
 	if err != nil {
-		fmt.Println("删除文件出错")
+		log.Fatalf("Failed to open alerts: %v", err)
 	}
 	for {
-		file, err := os.OpenFile("running.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Println("Error opening file:", err)
-			return
-		}
-
-		rows, err := conn.Query(context.Background(), sqlStatements)
+		rows, err := screens.Query(context.Background(), conn, "near-high", screener.Args{"market": "us", "ratio": 0.46})
 		if err != nil {
 			log.Fatalf("Failed to execute query: %v", err)
 		}
 		defer rows.Close()
 		// 遍历查询结果
 		index := 0
+		// 最新一根K线上触发的股票，本轮结束后统一打分排序
+		var cands []scoring.Candidate
 		//symbols := []string{"NVDA", "VST", "AAPL", "META", "PDD", "MSFT", "DUOL", "TSLA", "LLY", "AMD", "NFLX", "BABA"}
-		downMap := make(map[string]*Point)
 		for rows.Next() {
 			index++
 			var (
@@ -385,321 +342,132 @@ func main() {
 				log.Fatal("No data available")
 			}
 
-			// var highest, lowest float64
-			// highest = math.Inf(-1)
-			// lowest = math.Inf(1)
-
-			var z, vols []float64
-			var avgVol float64
-
-			var lines []float64
-			var downDiff []float64
-			var downPrds []DownPeriod
-			var downDiffMax float64
-			// var start, end int
-
-			// for idx, item := range data {
-			// 	// timestamp := item[0].(float64)
-			// 	high := item[5].(float64)
-			// 	low := item[4].(float64)
-
-			// 	if high > highest {
-			// 		highest = high
-			// 		start = idx
-			// 	}
-			// 	if low < lowest {
-			// 		lowest = low
-			// 		end = idx
-			// 	}
-			// }
+			bars, err := kline.FromItems(response.Data.Column, data)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
 
 			str := ""
-			for _, item := range data {
-				// // 使用 Unix 函数将时间戳转换为 Time 对象
-
-				// // 输出时分秒格式的时间
-
-				// if idx == start {
-				// 	//fmt.Println("Unix时间戳转换后的正常时间:", normalTime.Format("2006-01-02 15:04:05 MST"))
-				// } else if idx == end {
-				// 	//fmt.Println("Unix时间戳转换后的正常时间:", normalTime.Format("2006-01-02 15:04:05 MST"))
-				// }
-
-				// value := (item[5].(float64) - lowest) * 10 / (highest - lowest)
-				// x = append(x, float64(idx))
-				// y = append(y, value)
-				z = append(z, item[5].(float64))
-				avgVol += item[1].(float64)
-				vols = append(vols, avgVol)
-			}
-			avgVol = avgVol / float64(len(data)-1)
-			//fmt.Println(symbol, max_high_60_days_ago, timestamp)
-			n8 := 5
-			n20 := 20
-			ema5 := calculateEMA(z, n8)
-			ema20 := calculateEMA(z, n20)
-			ma20 := calculateMA(z, n20)
-			up, down, downVol, upVol := 0.0, 0.0, 0.0, 0.0
-			// Compare EMA5 and EMA20 and print where EMA5 is greater than EMA20
-
-			// Compare EMA5 and EMA20 and print where EMA5 is greater than EMA20
-
-			upline, downline, previousClose := 0.0, 0.0, 0.0
-
-			uptimes, downtimes, previousTimes := 0, 0, 0
-			downUpdate, downTouch, downClimb, downDown, downTs := 0, 0, 0, 0, 0
-			downVal, downratio, enterVal := 0.0, 0.0, 0.0
-			downPrds = make([]DownPeriod, 0)
-
-			for i, item := range data {
-				if i < 21 {
-					continue
-				}
-				//"timestamp","volume","open","high","low","close","chg","percent","turnoverrate","amount","volume_post","amount_post"
-				ts := int64(item[0].(float64))
-				unixTimestamp := int64(item[0].(float64)) / 1000
-				normalTime := time.Unix(unixTimestamp, 0)
-				avgVol = vols[i] / float64(i+1)
-				if down > 0 {
-					downVol += item[1].(float64)
-					downVal += item[5].(float64)
-					downtimes++
-					//if downMap[symbol] != nil {
-					//lowDiff := math.Abs(downMap[symbol].low-item[3].(float64)) / item[5].(float64)
-					// if lowDiff < 0.005 && downtimes < 4 {
-					// 	downMap[symbol].trigger = downMap[symbol].trigger + 1
-					// }
-					// if downtimes == 4 && downMap[symbol].trigger >= 3 {
-					// 	diff := math.Abs(downMap[symbol].close - item[5].(float64))
-					// 	if diff < 0.005 {
-					// 		downratio := (vols[i] - vols[downMap[symbol].index]) / float64(i-index) / avgVol
-					// 		downZero = i
-					// 		str += "进入小波动买点 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-
-					// 		if i == len(data)-1 && unixMilli-ts < 1*60*1000 {
-					// 			SendEmail(symbol, str)
-					// 		}
-					// 		downMap[symbol].trigger = -1
-					// 	}
-
-					// } else if downMap[symbol].low > item[3].(float64) && downtimes > 4 && lowDiff >= 0.0095 && lowDiff < 0.0195 && downMap[symbol].trigger >= -1 {
-					// 	downOne = i
-					// 	downratio := (vols[i] - vols[downZero]) / float64(i-downZero) / avgVol
-					// 	str += "进入波动买点1 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					// 	downMap[symbol].trigger = -2
-					// } else if downMap[symbol].low > item[3].(float64) && downtimes > 4 && lowDiff >= 0.0195 && lowDiff < 0.0395 && downMap[symbol].trigger >= -2 {
-					// 	downTwo = i
-					// 	downratio := (vols[i] - vols[downOne]) / float64(i-downOne) / avgVol
-					// 	downMap[symbol].trigger = -3
-					// 	str += "进入波动买点2 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					// 	downMap[symbol].trigger = -3
-					// } else if downMap[symbol].low > item[3].(float64) && downtimes > 4 && lowDiff >= 0.0395 && lowDiff < 0.0795 && downMap[symbol].trigger >= -3 {
-					// 	downThree = i
-					// 	downMap[symbol].trigger = -4
-					// 	downratio := (vols[i] - vols[downTwo]) / float64(i-downTwo) / avgVol
-					// 	str += "进入波动买点3 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					// } else if downMap[symbol].low > item[3].(float64) && downtimes > 4 && lowDiff >= 0.0795 && lowDiff < 0.15395 && downMap[symbol].trigger >= -4 {
-					// 	downMap[symbol].trigger = -5
-					// 	downratio := (vols[i] - vols[downThree]) / float64(i-downThree) / avgVol
-					// 	str += "进入波动买点4 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					// }
-					//}
-
-					if previousClose < item[5].(float64) {
-						previousTimes++
-					} else {
-						previousTimes = 0
-					}
-					if previousTimes >= 3 {
-						previousTimes = 0
-						downratio = (vols[i] - vols[i-3]) / 3 / avgVol
-						str += "\t 下线转强" + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), downratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					}
-					if downline > item[4].(float64) {
-						downline = item[4].(float64)
-						downUpdate++
-						str += "\t 更新底部下线" + fmt.Sprintf("%d low price: %f, close price: %f", downtimes, item[4].(float64), item[5].(float64)) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-						downDiffMax = 0
-					} else {
-						diff := (downline - item[4].(float64)) / downline
-						diff = diff * diff * 10000
-						if diff < 0.0001 {
-							downTouch++
-							str += "\t 接触底部下线" + fmt.Sprintf("%d low price: %f, close price: %f", downtimes, item[4].(float64), item[5].(float64)) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-							downDiffMax = 0
-						} else if diff > downDiffMax {
-							downClimb++
-							downDiffMax = diff
-							str += "\t 增加底部上线" + fmt.Sprintf("%d low price: %f, close price: %f, maxdiff: %f", downtimes, item[4].(float64), item[5].(float64), downDiffMax) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-						} else {
-							downDown++
-							str += "\t 趋近底部下线" + fmt.Sprintf("%d low price: %f, close price: %f, maxdiff: %f", downtimes, item[4].(float64), item[5].(float64), downDiffMax) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+			machine := downperiod.New(downperiod.DefaultConfig)
+			for i, bar := range bars {
+				normalTime := time.Unix(bar.Timestamp/1000, 0)
+				for _, e := range machine.Push(bar) {
+					switch e.Kind {
+					case downperiod.DownStrength:
+						str += "\t 下线转强" + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", bar.Low, bar.Close, e.VolRatio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.NewLow:
+						str += "\t 更新底部下线" + fmt.Sprintf("%d low price: %f, close price: %f", e.Times, bar.Low, bar.Close) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.TouchLow:
+						str += "\t 接触底部下线" + fmt.Sprintf("%d low price: %f, close price: %f", e.Times, bar.Low, bar.Close) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.Climb:
+						str += "\t 增加底部上线" + fmt.Sprintf("%d low price: %f, close price: %f, maxdiff: %f", e.Times, bar.Low, bar.Close, e.MaxDiff) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.Drift:
+						str += "\t 趋近底部下线" + fmt.Sprintf("%d low price: %f, close price: %f, maxdiff: %f", e.Times, bar.Low, bar.Close, e.MaxDiff) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.UpStrength:
+						str += "\t 上线强 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", bar.Low, bar.Close, e.VolRatio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
+					case downperiod.CrossUp:
+						p := e.Period
+						var hits []string
+						if i > len(bars)-20 && e.Setup {
+							str += "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz\n"
+							hits = append(hits, "ema-down-setup")
 						}
-						downDiff = append(downDiff, diff)
-					}
-					// if i > len(data)-3 {
-					// 	str += fmt.Sprintf("更新根数: %d,触摸根数: %d,爬升根数: %d, 水下根数：%d， 平均量能：%f", downUpdate, downTouch, downClimb, downtimes, downVol/float64(downtimes)/avgVol) + "\n"
-					// }
-					if i == len(data)-1 && down > 0 {
-						update := 0.0
-						if downtimes > 0 && float64(downUpdate/downtimes) < 0.2 && downratio < 1 && downPrds[len(downPrds)-1].downRatio > 1 && downPrds[len(downPrds)-1].downtimes > 10 {
-							update = 999.0
+						str += "\t 下线：" + fmt.Sprintf("%.2f", p.DownLine) + "\n"
+						if p.Times > 5 && p.Times < 20 && p.VolRatio < 1.5 && p.VolRatio > 1.1 {
+							str += "@@@@@"
+							str += "\t MA20: " + fmt.Sprintf("%f ", e.MA)
+							hits = append(hits, "ema-down-period")
 						}
-						downPrds = append(downPrds, DownPeriod{int(ts), downClimb, downUpdate, downTouch, int(downtimes), downline, downratio, update, enterVal, downVal / float64(downtimes)})
-					}
-				} else {
-					uptimes++
-					upVol += item[1].(float64)
-					if previousClose < item[5].(float64) {
-						previousTimes++
-					} else {
-						previousTimes = 0
-					}
-					if previousTimes >= 3 {
-						previousTimes = 0
-						upratio := (vols[i] - vols[i-3]) / 3 / avgVol
-						str += "\t 上线强 " + fmt.Sprintf("low price: %f, close price: %f, vol ration: %f", item[4].(float64), item[5].(float64), upratio) + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					}
-					if upline < item[3].(float64) {
-						upline = item[3].(float64)
-					}
-				}
-				previousClose = item[5].(float64)
-				// i = 23 ema5[17] < ema20[]
-				if ema5[i-5] < ema20[i-20] && ema5[i-4] > ema20[i-19] {
-					if i > len(data)-20 && len(downPrds) > 0 && downtimes > 0 && float64(downUpdate/downtimes) < 0.2 && downratio < 1 && downPrds[len(downPrds)-1].downRatio > 1 && downPrds[len(downPrds)-1].downtimes > 10 {
-						str += "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz\n"
-					}
-					downratio = downVol / float64(downtimes) / avgVol
-					downPrds = append(downPrds, DownPeriod{int(downTs), downClimb, downUpdate, downTouch, int(downtimes), downline, downratio, 0, item[3].(float64), downVal / float64(downtimes)})
-
-					lines = append(lines, downline)
-
-					//gap := item[0].(float64) - up
-					up = item[0].(float64)
-					upVol = item[1].(float64)
-					upline = item[3].(float64)
-					previousTimes = 0
-					//fmt.Printf("Day %d: EMA5 = %.2f, EMA20 = %.2f (EMA5 < EMA20)\n", i+n20, ema5[i], ema20[i])
-					str += "\t 下线：" + fmt.Sprintf("%.2f", downline) + "\n"
-					// diff := math.Abs(downVal-downline) / item[4].(float64)
-
-					// if diff < 0.005 && downline > 0 && unixMilli-ts < 24*60*60*1000 {
-					// 	str = str + "yyyy"
-					// } else if diff < 0.005 && downline > 0 {
-					// 	str = str + "xxxx"
-					// }
-					// if unixMilli-ts < 2*60*60*1000 && upVol > 2*downVol && downVol != 0 {
-					// 	str = str + "###"F
-					// }
-					// if unixMilli-ts >= 2*60*60*1000 && upVol > 2*downVol && downVol != 0 {
-					// 	str = str + "!!!"
-					// }
-
-					// if downtimes < 16 && unixMilli-ts < 24*60*60*1000 {
-					// 	str = str + "$$$"
-					// } else if downtimes < 16 {
-					// 	str = str + "@@@"
-					// }
-					// diff := (downVal - downline) / downVal
-					if downtimes > 5 && downtimes < 20 && downVol/float64(downtimes)/avgVol < 1.5 && downVol/float64(downtimes)/avgVol > 1.1 {
-						str += "@@@@@"
-						str += "\t MA20: " + fmt.Sprintf("%f ", ma20[i-19])
-					}
-					if downtimes > 30 {
-						str += "ccccc"
-					}
-					str += "上穿: " + fmt.Sprintf("low price: %f, close price: %f, high price: %f", item[4].(float64), item[5].(float64), item[3].(float64)) + "  " + fmt.Sprintf("更新根数: %d,触摸根数: %d,爬升根数: %d, 水下根数：%d， 平均量能：%f", downUpdate, downTouch, downClimb, downtimes, downVol/float64(downtimes)/avgVol) + "  " + normalTime.Format("2006-01-02 15:04:05 MST")
-					downVol, downClimb, downTouch, downDown, downUpdate = 0, 0, 0, 0, 0
-					str = str + "\n"
-
-					down = 0
-					uptimes = 0
-					if !printedSymbols[symbol] && down > 1718553600000-4*24*60*60*1000 && up > down && upVol >= downVol*2 {
-						str1 := time.Now().Format("2006-01-02 15:04:05 MST") + " " + "http://xueqiu.com/s/" + symbol + " ema5上穿20: " + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-						fmt.Println(str1)
-						printedSymbols[symbol] = true
-					}
-					//str := "" + symbol + "于" + normalTime.Format("2006-01-02 15:04:05 MST") + "进入买点"
-					//self.SendTextToFriend(test.First(), str)
-					//playSound("./beiguozhichun.mp3")
-
-					// fmt.Printf("Day %d: EMA5 = %.2f, EMA20 = %.2f (EMA5 > EMA20)\n", i+n20, ema5[i], ema20[i])
-				}
-				if ema5[i-5] > ema20[i-20] && ema5[i+1-5] < ema20[i+1-20] {
-					if len(lines) > 1 {
-						temp := upline - lines[len(lines)-1]
-						if temp/upline > 0.03 {
+						if p.Times > 30 {
+							str += "ccccc"
+							hits = append(hits, "ema-long-down")
+						}
+						if i == len(bars)-1 && len(hits) > 0 {
+							cands = append(cands, scoring.Candidate{
+								Symbol:   symbol,
+								Strategy: strings.Join(hits, ","),
+								Bars:     bars,
+								Values:   map[string]float64{"ma": e.MA},
+								Periods:  machine.Periods(),
+							})
+						}
+						for _, name := range hits {
+							if i != len(bars)-1 {
+								continue
+							}
+							isNew, err := alerts.Allow(context.Background(), name, "us", symbol, time.Now())
+							if err != nil {
+								fmt.Println("查询提醒记录出错:", err)
+								continue
+							}
+							if !isNew {
+								continue
+							}
+							fmt.Printf("%s %s %s\n", name, symbol, normalTime.Format("2006-01-02 15:04:05 MST"))
+							err = store.Write(context.Background(), signals.Record{
+								Strategy:   name,
+								Symbol:     symbol,
+								Market:     "us",
+								BarTime:    bar.Timestamp,
+								DetectedAt: time.Now(),
+								Price:      bar.Close,
+								Direction:  strategy.Buy,
+								Payload: map[string]any{
+									"down_line": p.DownLine,
+									"times":     p.Times,
+									"vol_ratio": p.VolRatio,
+									"update":    p.Update,
+									"touch":     p.Touch,
+									"climb":     p.Climb,
+									"ma":        e.MA,
+								},
+							})
+							if err != nil {
+								fmt.Println("写入信号出错:", err)
+							}
+						}
+						str += "上穿: " + fmt.Sprintf("low price: %f, close price: %f, high price: %f", bar.Low, bar.Close, bar.High) + "  " + fmt.Sprintf("更新根数: %d,触摸根数: %d,爬升根数: %d, 水下根数：%d， 平均量能：%f", p.Update, p.Touch, p.Climb, p.Times, p.VolRatio) + "  " + normalTime.Format("2006-01-02 15:04:05 MST")
+						str = str + "\n"
+					case downperiod.CrossDown:
+						if e.Rise > 0.03 {
 							str += "+++++++++++++++++\n"
 						}
+						str += "\t 上线：" + fmt.Sprintf("%.2f", e.UpLine) + "\n"
+						if e.VolRatio > 3 {
+							str += "$$$$"
+						}
+						str += "下穿: " + strconv.FormatFloat(bar.Close, 'f', 2, 64) + "  " + fmt.Sprintf("%d %f", e.UpTimes, e.VolRatio) + "  " + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
 					}
-					if len(downPrds) > 1 {
-						downPrds[len(downPrds)-1].upLine = upline
-						downPrds[len(downPrds)-1].avgVal = downVal / float64(downtimes)
-					}
-					lines = append(lines, upline)
-					down = item[0].(float64)
-					downtimes = 1
-					downTs = int(ts)
-					downVal = item[5].(float64)
-					enterVal = item[5].(float64)
-					downline = item[4].(float64)
-					downVol = item[1].(float64)
-					downDiff = make([]float64, 0)
-					downDiffMax = 0
-					str += "\t 上线：" + fmt.Sprintf("%.2f", upline) + "\n"
-					//fmt.Println(upVol, uptimes, avgVol, upVol/float64(uptimes)/avgVol)
-					tempVol := upVol / float64(uptimes) / avgVol
-					if tempVol > 3 {
-						str += "$$$$"
-					}
-					str += "下穿: " + strconv.FormatFloat(item[5].(float64), 'f', 2, 64) + "  " + fmt.Sprintf("%d %f", uptimes, tempVol) + "  " + normalTime.Format("2006-01-02 15:04:05 MST") + "\n"
-					upVol = 0
-					up = 0
-					// if i == len(data)-1 && unixMilli-ts < 1*60*1000 {
-					// 	res := Point{int(ts), downVal, downline, item[3].(float64), 0}
-					// 	downMap[symbol] = &res
-					// }
-
-					res := Point{i, downVal, downline, item[3].(float64), 0, ts}
-					downMap[symbol] = &res
-					//fmt.Printf("Day %d: EMA5 = %.2f, EMA20 = %.2f (EMA5 < EMA20)\n", i+n20, ema5[i], ema20[i])
 				}
-				if i == len(data)-1 {
-					for _, item := range downPrds {
-						unixTimestamp := int64(item.ts) / 1000
-						normalTime := time.Unix(unixTimestamp, 0)
-						str += normalTime.Format("2006-01-02 15:04:05 MST") + " " + fmt.Sprintf("进入值：%f, 下线值：%f,  平均值: %f, 上线值：%f, 更新根数: %d,触摸根数: %d,爬升根数: %d, 水下根数：%d， 平均量能：%f", item.enterLine, item.downline, item.avgVal, item.upLine, item.downUpdate, item.downTouch, item.downClimb, item.downtimes, item.downRatio) + "\n"
+				if i == len(bars)-1 {
+					for _, item := range machine.History() {
+						normalTime := time.Unix(item.Timestamp/1000, 0)
+						upLine := item.UpLine
+						if item.Setup {
+							upLine = 999.0
+						}
+						str += normalTime.Format("2006-01-02 15:04:05 MST") + " " + fmt.Sprintf("进入值：%f, 下线值：%f,  平均值: %f, 上线值：%f, 更新根数: %d,触摸根数: %d,爬升根数: %d, 水下根数：%d， 平均量能：%f", item.EnterLine, item.DownLine, item.AvgClose, upLine, item.Update, item.Touch, item.Climb, item.Times, item.VolRatio) + "\n"
 					}
 				}
 			}
-
 			str += "====================" + symbol + "==================\n"
-			_, err = file.WriteString(str)
-			if err != nil {
-				fmt.Println("Error writing to file:", err)
-				return
+			if *verbose {
+				fmt.Print(str)
 			}
-			//if start < end {
-			//	slope := linearRegression(x[start:end+1], y[start:end+1])
-			//	slope2 := linearRegression(x[end+1:], y[end+1:])
-			//	fmt.Println("http://xueqiu.com/s/" + symbol)
-
-			//	fmt.Printf("%.5f, %.5f\n", slope, slope2)
-			//}
 
 			// 处理每一行的数据
 			//if response.Data.Quote.Current > max_high_60_days_ago {
 			//}
 		}
+		ranked, err := scoring.Rank(cands, weights)
+		if err != nil {
+			log.Fatalf("Failed to rank: %v", err)
+		}
+		fmt.Print(scoring.Format(ranked))
 		fmt.Println(index)
 		fmt.Println("............")
 		time.Sleep(1 * time.Minute)
-		file.Close()
-		err = os.Remove("running.txt")
-		if err != nil {
-			fmt.Println("删除文件出错")
-		}
 		//fmt.Printf("Column 1: %s, Column 2: %d\n", symbol, max_high_60_days_ago /* ... */)
 		//fmt.Printf("Quote Information:\n")
 		//fmt.Printf("Symbol: %s\n", response.Data.Quote.Symbol)
@@ -724,23 +492,3 @@ func SendEmail(symbol, context string) {
 		log.Println("send mail err:", err)
 	}
 }
-
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-
-	destinationFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destinationFile.Close()
-
-	_, err = io.Copy(destinationFile, sourceFile)
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,254 @@
+// Package montecarlo tests how much of a backtest's result could be luck.
+// It replays the run's trades in resampled sequences: drawn with
+// replacement, reshuffled, or with trades randomly skipped. It then
+// reports confidence intervals for the final return and max drawdown,
+// plus the risk of ruin.
+//
+// Each trade is taken as its profit over the equity before it was entered,
+// and the trades compound one after another. Trades that overlapped in the
+// run are treated as if they had come in sequence, so drawdowns read as a
+// sequence risk rather than the run's own mark-to-market drawdown.
+package montecarlo
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"text/tabwriter"
+
+	"stock-backend/backtest"
+)
+
+// Method is how a simulated trade sequence is drawn from the run's.
+type Method int
+
+const (
+	// Bootstrap draws as many trades as the run had, with replacement.
+	Bootstrap Method = iota
+	// Reshuffle takes every trade once in a random order. The final return
+	// is the run's every time; only the path, and so the drawdown, moves.
+	Reshuffle
+	// Skip keeps the run's order but drops each trade with probability
+	// Config.Skip, as missed fills and days off would.
+	Skip
+)
+
+// Methods are all the methods, in report order.
+var Methods = []Method{Bootstrap, Reshuffle, Skip}
+
+func (m Method) String() string {
+	switch m {
+	case Bootstrap:
+		return "bootstrap"
+	case Reshuffle:
+		return "reshuffle"
+	case Skip:
+		return "skip"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// Config sets up a simulation. Zero fields take the defaults.
+type Config struct {
+	// Runs is the number of sequences drawn per method, 10000 by default.
+	Runs int
+	// Seed seeds the draws, so the same trades and config always give the
+	// same result; 0 uses 1.
+	Seed int64
+	// Skip is the chance of dropping each trade for Skip, 0.1 by default.
+	Skip float64
+	// Ruin is the loss of starting equity counted as ruin, 0.5 by default.
+	// A sequence is ruined once its equity falls that far at any point.
+	Ruin float64
+	// Confidence is the width of the intervals, 0.9 by default for the
+	// 5th to 95th percentile.
+	Confidence float64
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Runs == 0 {
+		cfg.Runs = 10000
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = 1
+	}
+	if cfg.Skip == 0 {
+		cfg.Skip = 0.1
+	}
+	if cfg.Ruin == 0 {
+		cfg.Ruin = 0.5
+	}
+	if cfg.Confidence == 0 {
+		cfg.Confidence = 0.9
+	}
+	return cfg
+}
+
+// Interval is a confidence interval with its median.
+type Interval struct {
+	Low, Median, High float64
+}
+
+// Summary is the outcome of one method's sequences. Returns and drawdowns
+// are fractions of the starting equity.
+type Summary struct {
+	Method Method
+	Runs   int
+	// FinalReturn and MaxDrawdown are over the whole sequence, MeanPoints
+	// the mean return on cost, Trade.Return, of its trades.
+	FinalReturn Interval
+	MaxDrawdown Interval
+	MeanPoints  Interval
+	// LossChance is the share of sequences ending below the start, and
+	// RiskOfRuin the share that hit Config.Ruin.
+	LossChance float64
+	RiskOfRuin float64
+}
+
+// Sample is a run's trades in entry order. Equity is each trade's profit
+// over the equity before its entry, what it did to the account; Points is
+// its return on cost, Trade.Return.
+type Sample struct {
+	Equity []float64
+	Points []float64
+}
+
+// FromResult takes the trades of res as a sample.
+func FromResult(res *backtest.Result) Sample {
+	trades := append([]backtest.Trade(nil), res.Trades...)
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].EntryTime < trades[j].EntryTime })
+	s := Sample{Equity: make([]float64, len(trades)), Points: make([]float64, len(trades))}
+	for i, t := range trades {
+		equity := res.Config.Cash
+		// 最后一个早于买入时刻的权益点
+		if k := sort.Search(len(res.Equity), func(k int) bool { return res.Equity[k].Time >= t.EntryTime }) - 1; k >= 0 {
+			equity = res.Equity[k].Equity()
+		}
+		s.Equity[i], s.Points[i] = t.PnL()/equity, t.Return()
+	}
+	return s
+}
+
+// path is one sequence walked.
+type path struct {
+	final, drawdown, points float64
+	ruined                  bool
+}
+
+// walk plays the trades at indices seq of s in order.
+func (s Sample) walk(seq []int, ruin float64) path {
+	var p path
+	eq, peak := 1.0, 1.0
+	for _, i := range seq {
+		eq *= 1 + s.Equity[i]
+		peak = math.Max(peak, eq)
+		p.drawdown = math.Max(p.drawdown, 1-eq/peak)
+		if eq <= 1-ruin {
+			p.ruined = true
+		}
+		p.points += s.Points[i]
+	}
+	if len(seq) > 0 {
+		p.points /= float64(len(seq))
+	}
+	p.final = eq - 1
+	return p
+}
+
+// Simulate draws cfg.Runs sequences from s by m and summarises them.
+func Simulate(s Sample, m Method, cfg Config) Summary {
+	cfg = cfg.withDefaults()
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	n := len(s.Equity)
+	sum := Summary{Method: m, Runs: cfg.Runs}
+	finals := make([]float64, cfg.Runs)
+	drawdowns := make([]float64, cfg.Runs)
+	points := make([]float64, cfg.Runs)
+	seq := make([]int, 0, n)
+	for run := 0; run < cfg.Runs; run++ {
+		seq = seq[:0]
+		switch m {
+		case Bootstrap:
+			for range n {
+				seq = append(seq, rng.Intn(n))
+			}
+		case Reshuffle:
+			seq = append(seq, rng.Perm(n)...)
+		case Skip:
+			for i := range n {
+				if rng.Float64() >= cfg.Skip {
+					seq = append(seq, i)
+				}
+			}
+		}
+		p := s.walk(seq, cfg.Ruin)
+		finals[run], drawdowns[run], points[run] = p.final, p.drawdown, p.points
+		if p.final < 0 {
+			sum.LossChance++
+		}
+		if p.ruined {
+			sum.RiskOfRuin++
+		}
+	}
+	sum.LossChance /= float64(cfg.Runs)
+	sum.RiskOfRuin /= float64(cfg.Runs)
+	sum.FinalReturn = interval(finals, cfg.Confidence)
+	sum.MaxDrawdown = interval(drawdowns, cfg.Confidence)
+	sum.MeanPoints = interval(points, cfg.Confidence)
+	return sum
+}
+
+// Run simulates s by every method; nil without trades.
+func Run(s Sample, cfg Config) []Summary {
+	if len(s.Equity) == 0 {
+		return nil
+	}
+	sums := make([]Summary, len(Methods))
+	for i, m := range Methods {
+		sums[i] = Simulate(s, m, cfg)
+	}
+	return sums
+}
+
+// interval sorts v and takes the central confidence share of it.
+func interval(v []float64, confidence float64) Interval {
+	sort.Float64s(v)
+	tail := (1 - confidence) / 2
+	return Interval{quantile(v, tail), quantile(v, 0.5), quantile(v, 1-tail)}
+}
+
+// quantile interpolates the q quantile of sorted v.
+func quantile(v []float64, q float64) float64 {
+	if len(v) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(v)-1)
+	lo := int(math.Floor(pos))
+	hi := min(lo+1, len(v)-1)
+	return v[lo] + (v[hi]-v[lo])*(pos-float64(lo))
+}
+
+// WriteReport prints the summaries as a table under the run's own trade
+// sequence, walked the way the simulations are.
+func WriteReport(out io.Writer, s Sample, sums []Summary, cfg Config) error {
+	cfg = cfg.withDefaults()
+	seq := make([]int, len(s.Equity))
+	for i := range seq {
+		seq[i] = i
+	}
+	observed := s.walk(seq, cfg.Ruin)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	pct := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+	iv := func(i Interval) string {
+		return fmt.Sprintf("%s [%s, %s]", pct(i.Median), pct(i.Low), pct(i.High))
+	}
+	fmt.Fprintf(w, "monte carlo\truns\tfinal return\tmax drawdown\tmean points\tP(loss)\trisk of ruin (-%s)\n", pct(cfg.Ruin))
+	fmt.Fprintf(w, "observed\t1\t%s\t%s\t%s\t-\t-\n", pct(observed.final), pct(observed.drawdown), pct(observed.points))
+	for _, sum := range sums {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", sum.Method, sum.Runs, iv(sum.FinalReturn), iv(sum.MaxDrawdown), iv(sum.MeanPoints), pct(sum.LossChance), pct(sum.RiskOfRuin))
+	}
+	fmt.Fprintf(w, "\nintervals are median [%.0fth, %.0fth percentile]; skip drops %s of trades\n", (1-cfg.Confidence)/2*100, (1+cfg.Confidence)/2*100, pct(cfg.Skip))
+	return w.Flush()
+}
@@ -0,0 +1,104 @@
+package montecarlo
+
+import (
+	"math"
+	"testing"
+
+	"stock-backend/backtest"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestFromResult(t *testing.T) {
+	res := &backtest.Result{
+		Config: backtest.Config{Cash: 1000},
+		Equity: []backtest.EquityPoint{
+			{Time: 100, Cash: 1000},
+			{Time: 200, Cash: 1200},
+			{Time: 300, Cash: 1200},
+		},
+		Trades: []backtest.Trade{
+			// 按买入时间排序后才是第二笔
+			{EntryTime: 250, EntryPrice: 10, ExitPrice: 9, Qty: 60},
+			{EntryTime: 50, EntryPrice: 10, ExitPrice: 12, Qty: 100},
+		},
+	}
+	s := FromResult(res)
+	// 第一笔在首个权益点之前买入，按起始资金算
+	want := Sample{Equity: []float64{0.2, -0.05}, Points: []float64{0.2, -0.1}}
+	for i := range want.Equity {
+		if !near(s.Equity[i], want.Equity[i]) || !near(s.Points[i], want.Points[i]) {
+			t.Fatalf("sample %+v, want %+v", s, want)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	mixed := Sample{
+		Equity: []float64{0.1, -0.05, 0.2, -0.1, 0.05},
+		Points: []float64{0.1, -0.05, 0.2, -0.1, 0.05},
+	}
+	all := 1.0
+	for _, r := range mixed.Equity {
+		all *= 1 + r
+	}
+	cfg := Config{Runs: 2000, Seed: 7}
+
+	re := Simulate(mixed, Reshuffle, cfg)
+	for _, v := range []float64{re.FinalReturn.Low, re.FinalReturn.Median, re.FinalReturn.High} {
+		if !near(v, all-1) {
+			t.Errorf("reshuffled final return %+v, want %v every run", re.FinalReturn, all-1)
+		}
+	}
+	if !near(re.MeanPoints.Low, 0.04) || !near(re.MeanPoints.High, 0.04) {
+		t.Errorf("reshuffled mean points %+v, want 0.04", re.MeanPoints)
+	}
+	if re.MaxDrawdown.Low >= re.MaxDrawdown.High {
+		t.Errorf("reshuffled drawdown %+v did not move with the order", re.MaxDrawdown)
+	}
+
+	boot := Simulate(mixed, Bootstrap, cfg)
+	if boot.FinalReturn.Low >= all-1 || boot.FinalReturn.High <= all-1 {
+		t.Errorf("bootstrap final return %+v does not straddle %v", boot.FinalReturn, all-1)
+	}
+	if again := Simulate(mixed, Bootstrap, cfg); again != boot {
+		t.Errorf("same seed gave %+v then %+v", boot, again)
+	}
+
+	// 每笔都赚 10%，跳过的笔数决定结果
+	wins := Sample{Equity: []float64{0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1}, Points: make([]float64, 10)}
+	skip := Simulate(wins, Skip, Config{Runs: 2000, Seed: 7, Skip: 0.5})
+	if want := math.Pow(1.1, 5) - 1; !near(skip.FinalReturn.Median, want) {
+		t.Errorf("skipping half: median %v, want %v", skip.FinalReturn.Median, want)
+	}
+	if skip.FinalReturn.High > math.Pow(1.1, 10)-1 || skip.LossChance != 0 || skip.MaxDrawdown.High != 0 {
+		t.Errorf("skipping winners: %+v", skip)
+	}
+}
+
+func TestRuin(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     Method
+		trades     []float64
+		ruin, loss float64
+	}{
+		// 先亏 60% 就跌到一半以下，先翻倍再亏只剩 0.8
+		{"order decides", Reshuffle, []float64{1, -0.6}, 0.5, 1},
+		{"always ruined", Reshuffle, []float64{-0.3, -0.3}, 1, 1},
+		{"never ruined", Reshuffle, []float64{0.1, -0.2, 0.1}, 0, 1},
+		{"drawn twice", Bootstrap, []float64{-0.6, 0.1}, 0.75, 0.75},
+	}
+	for _, tt := range tests {
+		s := Sample{Equity: tt.trades, Points: tt.trades}
+		sum := Simulate(s, tt.method, Config{Runs: 4000, Seed: 3})
+		if math.Abs(sum.RiskOfRuin-tt.ruin) > 0.03 || math.Abs(sum.LossChance-tt.loss) > 0.03 {
+			t.Errorf("%s: risk of ruin %v loss chance %v, want %v %v", tt.name, sum.RiskOfRuin, sum.LossChance, tt.ruin, tt.loss)
+		}
+	}
+	if Run(Sample{}, Config{}) != nil {
+		t.Error("Run without trades gave summaries")
+	}
+}
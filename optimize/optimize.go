@@ -0,0 +1,155 @@
+// Package optimize searches strategy params with the backtest engine: a
+// grid or random sweep run in parallel, an in-sample/out-of-sample split,
+// and rolling walk-forward windows.
+package optimize
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stock-backend/backtest"
+	"stock-backend/strategy"
+)
+
+// Builder makes the strategy under test from one set of params.
+type Builder func(p strategy.Params) (strategy.Strategy, error)
+
+// Objective scores a run, higher is better.
+type Objective struct {
+	Name  string
+	Score func(m backtest.Metrics) float64
+}
+
+// Objectives are the objectives by name.
+var Objectives = map[string]Objective{
+	"sharpe":        {"sharpe", func(m backtest.Metrics) float64 { return m.Sharpe }},
+	"sortino":       {"sortino", func(m backtest.Metrics) float64 { return m.Sortino }},
+	"cagr":          {"cagr", func(m backtest.Metrics) float64 { return m.CAGR }},
+	"return":        {"return", func(m backtest.Metrics) float64 { return m.TotalReturn }},
+	"profit_factor": {"profit_factor", func(m backtest.Metrics) float64 { return math.Min(m.ProfitFactor, 100) }},
+	"expectancy":    {"expectancy", func(m backtest.Metrics) float64 { return m.ExpectedReturn }},
+	"calmar": {"calmar", func(m backtest.Metrics) float64 {
+		if m.MaxDrawdown == 0 {
+			return m.CAGR
+		}
+		return m.CAGR / m.MaxDrawdown
+	}},
+}
+
+// GetObjective returns the objective called name.
+func GetObjective(name string) (Objective, error) {
+	o, ok := Objectives[name]
+	if !ok {
+		names := make([]string, 0, len(Objectives))
+		for n := range Objectives {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Objective{}, fmt.Errorf("unknown objective %q, want one of %s", name, strings.Join(names, ", "))
+	}
+	return o, nil
+}
+
+// Window is a span to trade in, [From, To) in unix milliseconds; To 0 means
+// the end of the data.
+type Window struct {
+	From, To int64
+}
+
+func (w Window) String() string {
+	to := "end"
+	if w.To > 0 {
+		to = time.UnixMilli(w.To).Format("2006-01-02")
+	}
+	return time.UnixMilli(w.From).Format("2006-01-02") + "~" + to
+}
+
+// Eval is one set of params run over one window.
+type Eval struct {
+	Params  strategy.Params
+	Window  Window
+	Metrics backtest.Metrics
+	Score   float64
+	// Err is set when the params did not build or the run failed; Score is
+	// then -Inf.
+	Err error
+}
+
+// Optimizer holds what every run of a search shares.
+type Optimizer struct {
+	Data backtest.Data
+	// Base is the run config; Strategy, Start and End are set per run, and
+	// Workers to one since the runs themselves go in parallel.
+	Base      backtest.Config
+	Build     Builder
+	Objective Objective
+	// Workers is how many runs go at once, at least one.
+	Workers int
+}
+
+// Sweep runs every point over w, in parallel, and returns the evals in the
+// order of points. Runs share the data read-only and build their own
+// strategy, so the result does not depend on Workers.
+func (o *Optimizer) Sweep(points []strategy.Params, w Window) []Eval {
+	res := make([]Eval, len(points))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := o.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res[i] = o.eval(points[i], w)
+			}
+		}()
+	}
+	for i := range points {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return res
+}
+
+func (o *Optimizer) eval(p strategy.Params, w Window) Eval {
+	ev := Eval{Params: p, Window: w, Score: math.Inf(-1)}
+	s, err := o.Build(p)
+	if err != nil {
+		ev.Err = err
+		return ev
+	}
+	cfg := o.Base
+	cfg.Strategy, cfg.Start, cfg.End = s, w.From, w.To
+	// 参数组之间已经并行了，每次回测里就不再分开跑
+	cfg.Workers = 1
+	r, err := backtest.Run(o.Data, cfg)
+	if err != nil {
+		ev.Err = err
+		return ev
+	}
+	ev.Metrics = r.Metrics()
+	ev.Score = o.Objective.Score(ev.Metrics)
+	if math.IsNaN(ev.Score) {
+		ev.Score = math.Inf(-1)
+	}
+	return ev
+}
+
+// best is the index of the highest score, the earliest point on ties.
+func best(evals []Eval) int {
+	b := 0
+	for i, ev := range evals {
+		if ev.Score > evals[b].Score {
+			b = i
+		}
+	}
+	return b
+}
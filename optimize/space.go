@@ -0,0 +1,155 @@
+package optimize
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"stock-backend/strategy"
+)
+
+// Dim is one param to vary from Min to Max in steps of Step.
+type Dim struct {
+	Name           string
+	Min, Max, Step float64
+}
+
+// Values lists the dimension's values, Min first.
+func (d Dim) Values() []float64 {
+	if d.Step <= 0 || d.Max <= d.Min {
+		return []float64{d.Min}
+	}
+	n := int(math.Floor((d.Max-d.Min)/d.Step+1e-9)) + 1
+	res := make([]float64, n)
+	for i := range res {
+		// 用乘法避免累加误差
+		res[i] = math.Round((d.Min+float64(i)*d.Step)*1e9) / 1e9
+	}
+	return res
+}
+
+// ParseDim reads name=min:max:step, or name=value for a fixed param.
+func ParseDim(s string) (Dim, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return Dim{}, fmt.Errorf("param %q: want name=min:max:step", s)
+	}
+	parts := strings.Split(spec, ":")
+	nums := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return Dim{}, fmt.Errorf("param %q: %w", s, err)
+		}
+		nums[i] = v
+	}
+	switch len(nums) {
+	case 1:
+		return Dim{Name: name, Min: nums[0], Max: nums[0]}, nil
+	case 3:
+		if nums[2] <= 0 || nums[1] < nums[0] {
+			return Dim{}, fmt.Errorf("param %q: want min <= max and a positive step", s)
+		}
+		return Dim{Name: name, Min: nums[0], Max: nums[1], Step: nums[2]}, nil
+	}
+	return Dim{}, fmt.Errorf("param %q: want name=min:max:step", s)
+}
+
+// unique drops all but the last dimension of each name, the one whose
+// values a point would end up with.
+func unique(dims []Dim) []Dim {
+	last := make(map[string]int, len(dims))
+	for i, d := range dims {
+		last[d.Name] = i
+	}
+	res := make([]Dim, 0, len(last))
+	for i, d := range dims {
+		if last[d.Name] == i {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// Grid is every combination of the dimensions' values. A name given twice
+// takes its last dimension.
+func Grid(dims []Dim) []strategy.Params {
+	dims = unique(dims)
+	res := []strategy.Params{{}}
+	for _, d := range dims {
+		var next []strategy.Params
+		for _, p := range res {
+			for _, v := range d.Values() {
+				q := make(strategy.Params, len(p)+1)
+				for k, x := range p {
+					q[k] = x
+				}
+				q[d.Name] = v
+				next = append(next, q)
+			}
+		}
+		res = next
+	}
+	return res
+}
+
+// Random draws up to n distinct points of the grid, the same ones for the
+// same seed.
+func Random(dims []Dim, n int, seed int64) []strategy.Params {
+	dims = unique(dims)
+	size := 1
+	for _, d := range dims {
+		size *= len(d.Values())
+	}
+	if n >= size {
+		return Grid(dims)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	seen := make(map[string]bool)
+	var res []strategy.Params
+	for len(res) < n {
+		p := make(strategy.Params, len(dims))
+		for _, d := range dims {
+			vals := d.Values()
+			p[d.Name] = vals[rng.Intn(len(vals))]
+		}
+		if key := p.String(); !seen[key] {
+			seen[key] = true
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// neighbors returns, for each point, the indices of the points one step
+// away along a single dimension.
+func neighbors(points []strategy.Params, dims []Dim) [][]int {
+	dims = unique(dims)
+	index := make(map[string]int, len(points))
+	for i, p := range points {
+		index[p.String()] = i
+	}
+	res := make([][]int, len(points))
+	for i, p := range points {
+		for _, d := range dims {
+			if d.Step <= 0 {
+				continue
+			}
+			for _, delta := range []float64{-d.Step, d.Step} {
+				q := make(strategy.Params, len(p))
+				for k, v := range p {
+					q[k] = v
+				}
+				q[d.Name] = math.Round((p[d.Name]+delta)*1e9) / 1e9
+				if j, ok := index[q.String()]; ok {
+					res[i] = append(res[i], j)
+				}
+			}
+		}
+		sort.Ints(res[i])
+	}
+	return res
+}
@@ -0,0 +1,228 @@
+package optimize
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"stock-backend/strategy"
+)
+
+// Row is one set of params in a ranked table.
+type Row struct {
+	Params strategy.Params
+	// IS is the run on the in-sample window the table is ranked by, OOS the
+	// run on the out-of-sample window; OOS is zero without a split.
+	IS  Eval
+	OOS *Eval
+	// Neighbors is the mean in-sample score of the grid points one step
+	// away, NaN when none were run. A score far above its neighbors is a
+	// spike rather than a plateau.
+	Neighbors float64
+	// Folds are the scores on each walk-forward training window, with
+	// their mean, standard deviation and the share above zero.
+	Folds    []float64
+	FoldMean float64
+	FoldStd  float64
+	Positive float64
+}
+
+// Split sweeps points over [from, to), holding the last oos fraction of the
+// span out of sample, and returns them ranked by in-sample score.
+func (o *Optimizer) Split(points []strategy.Params, dims []Dim, from, to int64, oos float64) ([]Row, error) {
+	if oos < 0 || oos >= 1 {
+		return nil, fmt.Errorf("out-of-sample fraction %g not in [0, 1)", oos)
+	}
+	if oos > 0 && to == 0 {
+		return nil, fmt.Errorf("an out-of-sample split needs an end")
+	}
+	is := Window{From: from, To: to}
+	var out []Eval
+	if oos > 0 {
+		cut := to - int64(float64(to-from)*oos)
+		is.To = cut
+		out = o.Sweep(points, Window{From: cut, To: to})
+	}
+	in := o.Sweep(points, is)
+	near := neighbors(points, dims)
+	rows := make([]Row, len(points))
+	for i, p := range points {
+		rows[i] = Row{Params: p, IS: in[i], Neighbors: math.NaN()}
+		if out != nil {
+			rows[i].OOS = &out[i]
+		}
+		if len(near[i]) > 0 {
+			sum := 0.0
+			for _, j := range near[i] {
+				sum += finite(in[j].Score)
+			}
+			rows[i].Neighbors = sum / float64(len(near[i]))
+		}
+	}
+	rank(rows)
+	return rows, nil
+}
+
+// Fold is one walk-forward step: params are picked on Train and judged on
+// Test.
+type Fold struct {
+	Train, Test Window
+	// Best is the pick on Train, Result its run on Test.
+	Best   Eval
+	Result Eval
+}
+
+// Folds cuts [from, to) into rolling windows of train then test, moving by
+// step. The last test window may not run past to.
+func Folds(from, to int64, train, test, step time.Duration) ([]Fold, error) {
+	if train <= 0 || test <= 0 || step <= 0 {
+		return nil, fmt.Errorf("walk-forward train %s, test %s and step %s must all be positive", train, test, step)
+	}
+	var res []Fold
+	for start := from; ; start += step.Milliseconds() {
+		cut := start + train.Milliseconds()
+		end := cut + test.Milliseconds()
+		if end > to {
+			break
+		}
+		res = append(res, Fold{Train: Window{start, cut}, Test: Window{cut, end}})
+	}
+	return res, nil
+}
+
+// Walk is the outcome of a walk-forward run.
+type Walk struct {
+	Folds []Fold
+	// Rows rank every point by its mean training score across folds.
+	Rows []Row
+	// Efficiency is the mean test score over the mean training score of the
+	// picks; near one means the picks held up out of sample.
+	Efficiency float64
+}
+
+// WalkForward sweeps points over each fold's training window, picks the
+// best and runs it over the test window that follows.
+func (o *Optimizer) WalkForward(points []strategy.Params, folds []Fold) (*Walk, error) {
+	if len(folds) == 0 {
+		return nil, fmt.Errorf("no walk-forward windows fit the range")
+	}
+	w := &Walk{Folds: folds, Rows: make([]Row, len(points))}
+	for i, p := range points {
+		w.Rows[i] = Row{Params: p, Neighbors: math.NaN()}
+	}
+	trainSum, testSum := 0.0, 0.0
+	for f := range w.Folds {
+		fold := &w.Folds[f]
+		evals := o.Sweep(points, fold.Train)
+		for i, ev := range evals {
+			w.Rows[i].Folds = append(w.Rows[i].Folds, ev.Score)
+			if f == len(w.Folds)-1 {
+				// 按最后一个训练窗口的结果排序展示
+				w.Rows[i].IS = ev
+			}
+		}
+		fold.Best = evals[best(evals)]
+		fold.Result = o.Sweep([]strategy.Params{fold.Best.Params}, fold.Test)[0]
+		trainSum += finite(fold.Best.Score)
+		testSum += finite(fold.Result.Score)
+	}
+	for i := range w.Rows {
+		r := &w.Rows[i]
+		scores := make([]float64, len(r.Folds))
+		pos := 0
+		for j, s := range r.Folds {
+			scores[j] = finite(s)
+			if s > 0 {
+				pos++
+			}
+		}
+		r.FoldMean, r.FoldStd = meanStd(scores)
+		r.Positive = float64(pos) / float64(len(scores))
+	}
+	sort.SliceStable(w.Rows, func(i, j int) bool { return w.Rows[i].FoldMean > w.Rows[j].FoldMean })
+	if trainSum != 0 {
+		w.Efficiency = testSum / trainSum
+	}
+	return w, nil
+}
+
+// rank sorts rows by in-sample score, best first, keeping sweep order on
+// ties.
+func rank(rows []Row) {
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].IS.Score > rows[j].IS.Score })
+}
+
+// finite maps failed runs' -Inf to zero for averaging.
+func finite(v float64) float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+func meanStd(v []float64) (mean, std float64) {
+	if len(v) == 0 {
+		return 0, 0
+	}
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	if len(v) < 2 {
+		return mean, 0
+	}
+	for _, x := range v {
+		std += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(v)-1))
+}
+
+// WriteTable prints the top rows, all of them when top is 0.
+func WriteTable(w io.Writer, rows []Row, top int) error {
+	if top > 0 && len(rows) > top {
+		rows = rows[:top]
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tparams\tscore\ttrades\treturn\tmaxdd\tneighbors\toos\toos-return\tfolds\tfold-std\tpositive")
+	for i, r := range rows {
+		if r.IS.Err != nil {
+			fmt.Fprintf(tw, "%d\t%s\terror: %v\n", i+1, r.Params, r.IS.Err)
+			continue
+		}
+		m := r.IS.Metrics
+		fmt.Fprintf(tw, "%d\t%s\t%.3f\t%d\t%.2f%%\t%.2f%%\t%s", i+1, r.Params, r.IS.Score, m.Trades, m.TotalReturn*100, m.MaxDrawdown*100, num(r.Neighbors))
+		if r.OOS != nil {
+			fmt.Fprintf(tw, "\t%.3f\t%.2f%%", r.OOS.Score, r.OOS.Metrics.TotalReturn*100)
+		} else {
+			fmt.Fprint(tw, "\t-\t-")
+		}
+		if len(r.Folds) > 0 {
+			fmt.Fprintf(tw, "\t%.3f\t%.3f\t%.0f%%\n", r.FoldMean, r.FoldStd, r.Positive*100)
+		} else {
+			fmt.Fprint(tw, "\t-\t-\t-\n")
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteFolds prints each walk-forward fold's pick and how it did.
+func (w *Walk) WriteFolds(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "train\ttest\tparams\ttrain-score\ttest-score\ttest-return\ttrades")
+	for _, f := range w.Folds {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.3f\t%.3f\t%.2f%%\t%d\n", f.Train, f.Test, f.Best.Params,
+			f.Best.Score, f.Result.Score, f.Result.Metrics.TotalReturn*100, f.Result.Metrics.Trades)
+	}
+	fmt.Fprintf(tw, "efficiency\t%.2f\n", w.Efficiency)
+	return tw.Flush()
+}
+
+func num(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", v)
+}
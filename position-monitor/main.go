@@ -0,0 +1,171 @@
+// position-monitor checks open positions against exit rules on their
+// latest bar and records the exits that fire in the signals table, the way
+// the checkers record entries. Positions are listed in a YAML file:
+//
+//	positions:
+//	  - symbol: SH600519
+//	    market: cn
+//	    entry: 2024-05-06
+//	    price: 1650
+//	    values: {gap_open: 1620}
+//	    exit: stop:0.05,gap
+//
+// entry is the trading day the position was bought on, or for intraday
+// bars the time, such as 2024-05-06 10:15, in the market's time zone; a day
+// alone on intraday bars takes that day's last bar. values are the entry
+// signal's, for the gap exit; exit overrides -exit for one position.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"gopkg.in/yaml.v3"
+
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/signals"
+	"stock-backend/strategy"
+)
+
+// holding is one position of the positions file.
+type holding struct {
+	Symbol string             `yaml:"symbol"`
+	Market string             `yaml:"market"`
+	Entry  string             `yaml:"entry"`
+	Price  float64            `yaml:"price"`
+	Values map[string]float64 `yaml:"values"`
+	Exit   string             `yaml:"exit"`
+}
+
+func loadHoldings(path string) ([]holding, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Positions []holding `yaml:"positions"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Positions, nil
+}
+
+// entryBar finds the timestamp of the bar a holding was bought on: the bar
+// holding the entry time, or for a day alone the last bar of that trading
+// day, or with weekly bars the week's bar.
+func entryBar(bars []kline.Bar, cal *calendar.Market, p kline.Period, entry string) (int64, error) {
+	at, err := time.ParseInLocation("2006-01-02 15:04", entry, cal.Location)
+	intraday := err == nil
+	if !intraday {
+		if at, err = time.ParseInLocation("2006-01-02", entry, cal.Location); err != nil {
+			return 0, fmt.Errorf("entry %q: want 2006-01-02 or 2006-01-02 15:04", entry)
+		}
+	}
+	session := cal.SessionDate(at)
+	found := -1
+	for i, b := range bars {
+		if cal.SessionDate(b.Time()).After(session) || intraday && b.Time().After(at) {
+			break
+		}
+		found = i
+	}
+	if found < 0 || p != kline.Week && !cal.SessionDate(bars[found].Time()).Equal(session) {
+		return 0, fmt.Errorf("no %s bar on %s", p, entry)
+	}
+	return bars[found].Timestamp, nil
+}
+
+func main() {
+	file := flag.String("positions", "positions.yaml", "YAML file listing the open positions")
+	rules := flag.String("exit", "stop:0.05,gap", "exit rules for positions without their own: stop:<pct>, target:<pct>, trail:<multiple>[:<period>], ma:<n>, gap[:<key>], time:<bars>, comma-separated")
+	period := flag.String("period", string(kline.Day), "bar period: day, week or 15m")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	record := flag.Bool("record", true, "write the exits to the signals table")
+	flag.Parse()
+
+	def, err := strategy.ParseExit(*rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	holdings, err := loadHoldings(*file)
+	if err != nil {
+		log.Fatalf("Failed to load positions: %v", err)
+	}
+	p := kline.Period(*period)
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	var store *signals.Store
+	if *record {
+		store, err = signals.Open(ctx, conn)
+		if err != nil {
+			log.Fatalf("Failed to open signals table: %v", err)
+		}
+	}
+	now := time.Now()
+	hits := 0
+	for _, h := range holdings {
+		if h.Market == "" {
+			h.Market = "cn"
+		}
+		rule := def
+		if h.Exit != "" {
+			if rule, err = strategy.ParseExit(h.Exit); err != nil {
+				log.Fatalf("Bad exit for %s: %v", h.Symbol, err)
+			}
+		}
+		cal, err := calendar.Get(h.Market)
+		if err != nil {
+			log.Fatal(err)
+		}
+		entry, err := time.ParseInLocation("2006-01-02", h.Entry[:min(len(h.Entry), 10)], cal.Location)
+		if err != nil {
+			log.Fatalf("Bad entry date for %s: %v", h.Symbol, err)
+		}
+		// 从买入前留出规则回看需要的历史
+		warmup := p.Warmup(h.Market, rule.Lookback())
+		bars, err := kline.NewClickHouseSource(conn, h.Market).Bars(ctx, h.Symbol, p, entry.Add(-warmup).UnixMilli(), 0)
+		if err != nil {
+			log.Fatalf("Failed to load bars: %v", err)
+		}
+		entryTime, err := entryBar(bars, cal, p, h.Entry)
+		if err != nil {
+			fmt.Printf("%s: %v，检查买入日期\n", h.Symbol, err)
+			continue
+		}
+		pos := strategy.Position{Symbol: h.Symbol, EntryTime: entryTime, EntryPrice: h.Price, Values: h.Values}
+		x, ok, err := strategy.ExitAt(rule, pos, bars, len(bars)-1)
+		if err != nil {
+			log.Fatalf("Failed to check %s: %v", h.Symbol, err)
+		}
+		if !ok {
+			continue
+		}
+		hits++
+		fmt.Printf("%s  %s  %s 卖出 %.3f (%s)  买入 %.3f, 盈亏 %.2f%%  %v\n",
+			h.Symbol, x.Bar.Time().Format("2006-01-02 15:04"), x.Rule, x.Price, x.Phase,
+			h.Price, (x.Price/h.Price-1)*100, x.Values)
+		if store != nil {
+			if err := store.Write(ctx, signals.FromSignal(x.Signal(), h.Market, now)); err != nil {
+				log.Fatalf("Failed to record exit: %v", err)
+			}
+		}
+	}
+	fmt.Printf("%d 个持仓, %d 个触发退出\n", len(holdings), hits)
+}
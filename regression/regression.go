@@ -0,0 +1,163 @@
+package regression
+
+import (
+	"errors"
+	"math"
+)
+
+// Fit is an ordinary least squares line y = Intercept + Slope*x together with
+// how well it describes the data.
+type Fit struct {
+	Slope     float64
+	Intercept float64
+	// R2 is the coefficient of determination, 0 for no fit and 1 for a
+	// perfect line.
+	R2 float64
+	// ResidualStd is the standard deviation of y minus the fitted line.
+	ResidualStd float64
+	N           int
+	// Log is set when the fit was made on log prices; Slope is then roughly
+	// the per-bar return and At returns prices again.
+	Log bool
+	// Mean is the average of the fitted y values, used to normalise Slope.
+	Mean float64
+}
+
+// Channel is a fitted line with bands above and below it, as many residual
+// standard deviations away as the width passed to Fit.Channel.
+type Channel struct {
+	Mid   []float64
+	Upper []float64
+	Lower []float64
+}
+
+// Linear fits y against x.
+func Linear(x, y []float64) (Fit, error) {
+	if len(x) != len(y) {
+		return Fit{}, errors.New("x and y must have the same length")
+	}
+	n := float64(len(x))
+	if len(x) < 2 {
+		return Fit{}, errors.New("need at least two points")
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+		sumXY += x[i] * y[i]
+		sumXX += x[i] * x[i]
+	}
+	den := n*sumXX - sumX*sumX
+	if den == 0 {
+		return Fit{}, errors.New("x has no variance")
+	}
+	f := Fit{N: len(x), Mean: sumY / n}
+	f.Slope = (n*sumXY - sumX*sumY) / den
+	f.Intercept = (sumY - f.Slope*sumX) / n
+
+	var ssRes, ssTot float64
+	for i := range x {
+		r := y[i] - (f.Intercept + f.Slope*x[i])
+		d := y[i] - f.Mean
+		ssRes += r * r
+		ssTot += d * d
+	}
+	if ssTot > 0 {
+		f.R2 = 1 - ssRes/ssTot
+	} else {
+		f.R2 = 1
+	}
+	if len(x) > 2 {
+		f.ResidualStd = math.Sqrt(ssRes / (n - 2))
+	}
+	return f, nil
+}
+
+// Prices fits prices against their bar index. With log set the fit is done on
+// ln(price), which keeps the slope comparable between cheap and expensive
+// symbols.
+func Prices(prices []float64, log bool) (Fit, error) {
+	x := make([]float64, len(prices))
+	y := make([]float64, len(prices))
+	for i, p := range prices {
+		x[i] = float64(i)
+		y[i] = p
+		if log {
+			if p <= 0 {
+				return Fit{}, errors.New("log fit needs positive prices")
+			}
+			y[i] = math.Log(p)
+		}
+	}
+	f, err := Linear(x, y)
+	f.Log = log
+	return f, err
+}
+
+// Rolling fits every trailing window of prices. Entry i covers
+// prices[i-window+1 : i+1]; entries before the first full window, or whose
+// window could not be fitted, are zero Fits with N == 0.
+func Rolling(prices []float64, window int, log bool) []Fit {
+	res := make([]Fit, len(prices))
+	if window < 2 {
+		return res
+	}
+	for i := window - 1; i < len(prices); i++ {
+		f, err := Prices(prices[i-window+1:i+1], log)
+		if err != nil {
+			continue
+		}
+		res[i] = f
+	}
+	return res
+}
+
+// At is the fitted price at x, undoing the log transform if needed.
+func (f Fit) At(x float64) float64 {
+	v := f.Intercept + f.Slope*x
+	if f.Log {
+		return math.Exp(v)
+	}
+	return v
+}
+
+// Channel returns the fitted line and its bands over x = 0..N-1. The bands
+// sit width residual standard deviations away from the line.
+func (f Fit) Channel(width float64) Channel {
+	c := Channel{
+		Mid:   make([]float64, f.N),
+		Upper: make([]float64, f.N),
+		Lower: make([]float64, f.N),
+	}
+	for i := 0; i < f.N; i++ {
+		v := f.Intercept + f.Slope*float64(i)
+		up, lo := v+width*f.ResidualStd, v-width*f.ResidualStd
+		if f.Log {
+			v, up, lo = math.Exp(v), math.Exp(up), math.Exp(lo)
+		}
+		c.Mid[i], c.Upper[i], c.Lower[i] = v, up, lo
+	}
+	return c
+}
+
+// NormSlope is the slope per bar as a fraction of the price level, so that
+// fits on different symbols can be compared.
+func (f Fit) NormSlope() float64 {
+	if f.Log {
+		return f.Slope
+	}
+	if f.Mean == 0 {
+		return 0
+	}
+	return f.Slope / f.Mean
+}
+
+// Quality scores how clean a trend is: the normalised slope weighted by how
+// much of the movement the line explains. A steep but noisy run scores lower
+// than a steady one.
+func (f Fit) Quality() float64 {
+	if f.N == 0 {
+		return 0
+	}
+	return f.NormSlope() * math.Max(f.R2, 0)
+}
@@ -0,0 +1,115 @@
+package regression
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestLinear(t *testing.T) {
+	tests := []struct {
+		name             string
+		x, y             []float64
+		slope, intercept float64
+		r2, residualStd  float64
+	}{
+		{"perfect line", []float64{0, 1, 2, 3, 4}, []float64{1, 3, 5, 7, 9}, 2, 1, 1, 0},
+		{"falling line", []float64{1, 2, 3}, []float64{10, 7, 4}, -3, 13, 1, 0},
+		// 残差 -1/3, 2/3, -1/3：ssRes 2/3，ssTot 8/3
+		{"noisy", []float64{0, 1, 2}, []float64{0, 2, 2}, 1, 1.0 / 3, 0.75, math.Sqrt(2.0 / 3)},
+		{"flat", []float64{0, 1, 2}, []float64{5, 5, 5}, 0, 5, 1, 0},
+	}
+	for _, tt := range tests {
+		f, err := Linear(tt.x, tt.y)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !near(f.Slope, tt.slope) || !near(f.Intercept, tt.intercept) || !near(f.R2, tt.r2) || !near(f.ResidualStd, tt.residualStd) {
+			t.Errorf("%s: got slope %v intercept %v r2 %v std %v; want %v %v %v %v",
+				tt.name, f.Slope, f.Intercept, f.R2, f.ResidualStd, tt.slope, tt.intercept, tt.r2, tt.residualStd)
+		}
+	}
+	for _, bad := range [][2][]float64{
+		{{1}, {1}},
+		{{1, 2}, {1}},
+		{{3, 3, 3}, {1, 2, 3}},
+	} {
+		if _, err := Linear(bad[0], bad[1]); err == nil {
+			t.Errorf("Linear(%v, %v) fitted", bad[0], bad[1])
+		}
+	}
+}
+
+func TestLogPrices(t *testing.T) {
+	// 每根涨 1%，对数价格是一条斜率 ln(1.01) 的直线
+	prices := make([]float64, 30)
+	for i := range prices {
+		prices[i] = 20 * math.Pow(1.01, float64(i))
+	}
+	f, err := Prices(prices, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(f.Slope, math.Log(1.01)) || !near(f.R2, 1) || !near(f.NormSlope(), math.Log(1.01)) {
+		t.Errorf("slope %v r2 %v norm %v, want %v, 1", f.Slope, f.R2, f.NormSlope(), math.Log(1.01))
+	}
+	if !near(f.At(10), prices[10]) {
+		t.Errorf("At(10) = %v, want %v", f.At(10), prices[10])
+	}
+	c := f.Channel(2)
+	for i, p := range prices {
+		if !near(c.Mid[i], p) || !near(c.Upper[i], p) || !near(c.Lower[i], p) {
+			t.Fatalf("channel at %d = %v %v %v, want all %v", i, c.Lower[i], c.Mid[i], c.Upper[i], p)
+		}
+	}
+	// 线性拟合的斜率按均价归一
+	lin, err := Prices(prices, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(lin.NormSlope(), lin.Slope/lin.Mean) || lin.R2 >= 1 || lin.R2 < 0.99 {
+		t.Errorf("linear fit on compounding prices: norm %v r2 %v", lin.NormSlope(), lin.R2)
+	}
+	if _, err := Prices([]float64{1, 0, 2}, true); err == nil {
+		t.Error("log fit took a zero price")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	f := Fit{Slope: 1, Intercept: 10, ResidualStd: 0.5, N: 3}
+	c := f.Channel(2)
+	for i, want := range []float64{10, 11, 12} {
+		if !near(c.Mid[i], want) || !near(c.Upper[i], want+1) || !near(c.Lower[i], want-1) {
+			t.Errorf("bar %d: %v %v %v, want %v ± 1", i, c.Lower[i], c.Mid[i], c.Upper[i], want)
+		}
+	}
+}
+
+func TestRolling(t *testing.T) {
+	prices := []float64{1, 2, 3, 5, 8}
+	fits := Rolling(prices, 3, false)
+	for i, f := range fits[:2] {
+		if f.N != 0 {
+			t.Errorf("fit %d before the first full window: %+v", i, f)
+		}
+	}
+	for i, slope := range map[int]float64{2: 1, 3: 1.5, 4: 2.5} {
+		if fits[i].N != 3 || !near(fits[i].Slope, slope) {
+			t.Errorf("fit %d = %+v, want slope %v", i, fits[i], slope)
+		}
+	}
+}
+
+func TestQuality(t *testing.T) {
+	steady := Fit{Slope: 0.01, R2: 0.9, N: 20, Log: true}
+	noisy := Fit{Slope: 0.02, R2: 0.3, N: 20, Log: true}
+	if steady.Quality() <= noisy.Quality() {
+		t.Errorf("steady %v scored under noisy %v", steady.Quality(), noisy.Quality())
+	}
+	if (Fit{Slope: 1, R2: -0.5, N: 5, Log: true}).Quality() != 0 {
+		t.Error("negative r2 gave a score")
+	}
+}
@@ -0,0 +1,246 @@
+package report
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+
+	"stock-backend/backtest"
+	"stock-backend/chart"
+	"stock-backend/strategy"
+)
+
+// MaxTradeCharts caps the trades drawn with a mini chart, the first ones
+// by entry; the rest are listed without. Each chart adds a few KB.
+const MaxTradeCharts = 300
+
+// Bars around a trade shown in its mini chart.
+const (
+	barsBefore = 30
+	barsAfter  = 10
+)
+
+//go:embed report.tmpl
+var pageSource string
+
+var page = template.Must(template.New("report").Parse(pageSource))
+
+// view is what the template renders.
+type view struct {
+	*Report
+	Performance template.URL
+	Heatmap     heatmap
+	Trades      []tradeRow
+	Charted     int
+	Comparison  []comparisonRow
+	Changed     []settingChange
+}
+
+type tradeRow struct {
+	backtest.Trade
+	Entry, Exit string
+	Return, PnL string
+	Win         bool
+	Chart       template.URL
+}
+
+type comparisonRow struct {
+	Name, This, Previous, Change string
+}
+
+type settingChange struct {
+	Name, This, Previous string
+}
+
+// WriteHTML renders the run as a single HTML page with its charts inlined.
+func (r *Report) WriteHTML(w io.Writer) error {
+	if r.res == nil {
+		return fmt.Errorf("run %s: no result to report", r.ID)
+	}
+	perf, err := pngURL(chart.Width, 14*vg.Centimeter, chart.Performance(r.res)...)
+	if err != nil {
+		return fmt.Errorf("equity chart: %w", err)
+	}
+	v := view{Report: r, Performance: perf, Heatmap: newHeatmap(r.res.Metrics())}
+	for i, t := range r.res.Trades {
+		row := tradeRow{
+			Trade:  t,
+			Entry:  time.UnixMilli(t.EntryTime).Format("2006-01-02 15:04"),
+			Exit:   time.UnixMilli(t.ExitTime).Format("2006-01-02 15:04"),
+			Return: format(t.Return(), "pct", false),
+			PnL:    format(t.PnL(), "cash", true),
+			Win:    t.Win(),
+		}
+		if i < MaxTradeCharts {
+			if row.Chart, err = r.tradeChart(t); err != nil {
+				return fmt.Errorf("trade chart %s: %w", t.Symbol, err)
+			}
+			v.Charted++
+		}
+		v.Trades = append(v.Trades, row)
+	}
+	if p := r.Previous; p != nil {
+		v.Comparison = compare(r.Figures, p.Figures)
+		v.Changed = changed(r.Settings, p.Settings)
+	}
+	return page.Execute(w, v)
+}
+
+// tradeChart draws the bars around t with its entry and exit marked, or
+// nothing when the data does not hold them.
+func (r *Report) tradeChart(t backtest.Trade) (template.URL, error) {
+	bars := r.data[t.Symbol]
+	at := func(ts int64) int {
+		return sort.Search(len(bars), func(i int) bool { return bars[i].Timestamp >= ts })
+	}
+	entry, exit := at(t.EntryTime), at(t.ExitTime)
+	if entry >= len(bars) || exit >= len(bars) {
+		return "", nil
+	}
+	lo, hi := max(0, entry-barsBefore), min(len(bars), exit+barsAfter+1)
+	k := chart.KLine{
+		Bars: bars[lo:hi],
+		Markers: []chart.Marker{
+			{Index: entry - lo, Price: t.EntryPrice, Direction: strategy.Buy},
+			{Index: exit - lo, Price: t.ExitPrice, Direction: strategy.Sell},
+		},
+	}
+	// 均线用完整的历史算，图的开头才不会空着
+	for _, n := range []int{5, 20} {
+		ma := chart.MA(bars[:hi], n)
+		ma.Values = ma.Values[lo:]
+		k.Overlays = append(k.Overlays, ma)
+	}
+	// 小图不要图例，只留价格面板
+	price := k.Panels()[0]
+	price.Plot.Legend = plot.NewLegend()
+	price.Plot.Y.Label.Text = ""
+	return pngURL(10*vg.Centimeter, 5*vg.Centimeter, price)
+}
+
+// pngURL renders panels as a PNG data URL.
+func pngURL(width, height vg.Length, panels ...chart.Panel) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := chart.WriteTo(&buf, "png", width, height, panels...); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// compare lines up this run's figures with the previous run's by name.
+func compare(this, prev []Figure) []comparisonRow {
+	before := make(map[string]Figure, len(prev))
+	for _, f := range prev {
+		before[f.Name] = f
+	}
+	var res []comparisonRow
+	for _, f := range this {
+		row := comparisonRow{Name: f.Name, This: f.String(), Previous: "-", Change: "-"}
+		if p, ok := before[f.Name]; ok {
+			row.Previous = p.String()
+			if d := float64(f.Value - p.Value); !math.IsNaN(d) && !math.IsInf(d, 0) {
+				row.Change = format(d, f.Format, true)
+			}
+		}
+		res = append(res, row)
+	}
+	return res
+}
+
+// changed lists the settings that differ between two runs.
+func changed(this, prev []Setting) []settingChange {
+	before := make(map[string]string, len(prev))
+	for _, s := range prev {
+		before[s.Name] = s.Value
+	}
+	var res []settingChange
+	for _, s := range this {
+		if p, ok := before[s.Name]; !ok || p != s.Value {
+			res = append(res, settingChange{Name: s.Name, This: s.Value, Previous: p})
+		}
+	}
+	return res
+}
+
+// heatmap is the monthly returns as a year by month grid.
+type heatmap struct {
+	Rows []heatmapRow
+}
+
+type heatmapRow struct {
+	Year   string
+	Months [12]heatmapCell
+	Total  heatmapCell
+}
+
+type heatmapCell struct {
+	Text  string
+	Color template.CSS
+}
+
+func newHeatmap(m backtest.Metrics) heatmap {
+	// 颜色深浅按最大的收益绝对值归一，月和年分开算
+	scale, yearScale := 0.0, 0.0
+	for _, g := range m.Months {
+		scale = math.Max(scale, math.Abs(g.Return))
+	}
+	for _, g := range m.Years {
+		yearScale = math.Max(yearScale, math.Abs(g.Return))
+	}
+	cell := func(ret, scale float64) heatmapCell {
+		return heatmapCell{Text: format(ret, "pct", false), Color: cellColor(ret, scale)}
+	}
+	h := heatmap{Rows: make([]heatmapRow, len(m.Years))}
+	rows := make(map[string]*heatmapRow, len(m.Years))
+	for i, y := range m.Years {
+		h.Rows[i] = heatmapRow{Year: y.Key, Total: cell(y.Return, yearScale)}
+		rows[y.Key] = &h.Rows[i]
+	}
+	for _, g := range m.Months {
+		year, month, _ := strings.Cut(g.Key, "-")
+		n, err := strconv.Atoi(month)
+		if row := rows[year]; row != nil && err == nil && n >= 1 && n <= 12 {
+			row.Months[n-1] = cell(g.Return, scale)
+		}
+	}
+	return h
+}
+
+// cellColor shades a return red for a gain and green for a loss, the way
+// the candles are colored, deeper the nearer it is to scale.
+func cellColor(ret, scale float64) template.CSS {
+	if scale == 0 || ret == 0 {
+		return ""
+	}
+	c := chart.Up
+	if ret < 0 {
+		c = chart.Down
+	}
+	alpha := 0.15 + 0.75*math.Min(1, math.Abs(ret)/scale)
+	return template.CSS(fmt.Sprintf("background-color: %s", rgba(c, alpha)))
+}
+
+func rgba(c color.RGBA, alpha float64) string {
+	return fmt.Sprintf("rgba(%d,%d,%d,%.2f)", c.R, c.G, c.B, alpha)
+}
+
+// Months names the heatmap's columns.
+func (heatmap) Months() []string {
+	res := make([]string, 12)
+	for i := range res {
+		res[i] = time.Month(i + 1).String()[:3]
+	}
+	return res
+}
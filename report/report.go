@@ -0,0 +1,250 @@
+// Package report files backtest runs under a run ID and renders each as a
+// self-contained HTML page: the run's settings, its metrics, equity and
+// drawdown charts, a monthly returns heatmap, the trades with a small chart
+// of each, and a comparison with an earlier run.
+//
+// A run lives in <dir>/<id>/: run.json is the record later runs compare
+// against, report.html the page and equity.csv the equity curve.
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"stock-backend/backtest"
+)
+
+// Setting is one input of a run, such as a command-line flag.
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Figure is one metric of a run. Format is how Value reads: "pct",
+// "ratio", "count", "cash" or "days".
+type Figure struct {
+	Name   string
+	Value  number
+	Format string
+}
+
+// Report is one backtest run.
+type Report struct {
+	ID       string
+	Strategy string
+	Created  time.Time
+	Settings []Setting
+	Figures  []Figure
+	// Months are the monthly returns, for comparing runs month by month.
+	Months []backtest.Group
+
+	// Previous is the run this one is compared with; nil for none.
+	Previous *Report `json:"-"`
+
+	res  *backtest.Result
+	data backtest.Data
+}
+
+// NewID names a run after its strategy and start time, e.g.
+// gap-pop-20240102-150405.
+func NewID(strategy string, t time.Time) string {
+	return strategy + "-" + t.Format("20060102-150405")
+}
+
+// New records res, run on data with settings, as run id. The data is only
+// kept for drawing the trade charts.
+func New(id string, settings []Setting, res *backtest.Result, data backtest.Data) *Report {
+	m := res.Metrics()
+	return &Report{
+		ID:       id,
+		Strategy: res.Config.Strategy.Name(),
+		Created:  time.Now(),
+		Settings: settings,
+		Figures:  figures(m),
+		Months:   m.Months,
+		res:      res,
+		data:     data,
+	}
+}
+
+// Save writes the run to dir/ID and returns the path of its HTML report.
+func (r *Report) Save(dir string) (string, error) {
+	if r.res == nil {
+		return "", fmt.Errorf("run %s: no result to report", r.ID)
+	}
+	runDir := filepath.Join(dir, r.ID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return "", err
+	}
+	record, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("run %s: %w", r.ID, err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "run.json"), record, 0o644); err != nil {
+		return "", err
+	}
+	if err := writeFile(filepath.Join(runDir, "equity.csv"), r.res.WriteEquity); err != nil {
+		return "", err
+	}
+	page := filepath.Join(runDir, "report.html")
+	if err := writeFile(page, r.WriteHTML); err != nil {
+		return "", err
+	}
+	return page, nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Load reads the record of run id from dir.
+func Load(dir, id string) (*Report, error) {
+	b, err := os.ReadFile(filepath.Join(dir, id, "run.json"))
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("run %s: %w", id, err)
+	}
+	return &r, nil
+}
+
+// Latest is the most recent run of strategy in dir created before t, or
+// nil when there is none.
+func Latest(dir, strategy string, t time.Time) (*Report, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var latest *Report
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		r, err := Load(dir, e.Name())
+		if errors.Is(err, os.ErrNotExist) {
+			// 不是回测目录
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Strategy != strategy || !r.Created.Before(t) {
+			continue
+		}
+		if latest == nil || r.Created.After(latest.Created) {
+			latest = r
+		}
+	}
+	return latest, nil
+}
+
+// figures lists the metrics shown and compared, in report order.
+func figures(m backtest.Metrics) []Figure {
+	days := func(d time.Duration) number { return number(d.Hours() / 24) }
+	res := []Figure{
+		{"start equity", number(m.StartEquity), "cash"},
+		{"end equity", number(m.EndEquity), "cash"},
+		{"total return", number(m.TotalReturn), "pct"},
+		{"CAGR", number(m.CAGR), "pct"},
+		{"volatility", number(m.Volatility), "pct"},
+		{"Sharpe", number(m.Sharpe), "ratio"},
+		{"Sortino", number(m.Sortino), "ratio"},
+		{"max drawdown", number(m.MaxDrawdown), "pct"},
+		{"longest drawdown", days(m.DrawdownDuration), "days"},
+		{"trades", number(m.Trades), "count"},
+		{"win rate", number(m.WinRate), "pct"},
+		{"profit factor", number(m.ProfitFactor), "ratio"},
+		{"expectancy", number(m.Expectancy), "cash"},
+		{"expected return", number(m.ExpectedReturn), "pct"},
+		{"avg win", number(m.AvgWin), "cash"},
+		{"avg loss", number(m.AvgLoss), "cash"},
+		{"avg holding", days(m.AvgHolding), "days"},
+		{"exposure", number(m.Exposure), "pct"},
+	}
+	if b := m.Benchmark; b != nil {
+		res = append(res,
+			Figure{"benchmark return", number(b.Return), "pct"},
+			Figure{"excess return", number(b.Excess), "pct"},
+			Figure{"alpha", number(b.Alpha), "pct"},
+			Figure{"beta", number(b.Beta), "ratio"},
+			Figure{"correlation", number(b.Correlation), "ratio"},
+			Figure{"tracking error", number(b.TrackingError), "pct"},
+			Figure{"information ratio", number(b.InformationRatio), "ratio"},
+		)
+	}
+	return res
+}
+
+// String formats the figure's value.
+func (f Figure) String() string {
+	return format(float64(f.Value), f.Format, false)
+}
+
+// format writes v as kind reads. signed is for changes, which carry their
+// sign and read in percentage points for "pct".
+func format(v float64, kind string, signed bool) string {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	sign := ""
+	if signed && v > 0 {
+		sign = "+"
+	}
+	switch kind {
+	case "pct":
+		if signed {
+			return fmt.Sprintf("%s%.2fpp", sign, v*100)
+		}
+		return fmt.Sprintf("%.2f%%", v*100)
+	case "count":
+		return fmt.Sprintf("%s%.0f", sign, v)
+	case "days":
+		return fmt.Sprintf("%s%.1fd", sign, v)
+	}
+	return fmt.Sprintf("%s%.2f", sign, v)
+}
+
+// number is a float64 that survives JSON as ±Inf and NaN, which a profit
+// factor without losses is.
+type number float64
+
+func (n number) MarshalJSON() ([]byte, error) {
+	v := float64(n)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return json.Marshal(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return json.Marshal(v)
+}
+
+func (n *number) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := strconv.ParseFloat(s, 64)
+		*n = number(v)
+		return err
+	}
+	var v float64
+	err := json.Unmarshal(b, &v)
+	*n = number(v)
+	return err
+}
@@ -0,0 +1,213 @@
+// Package schedule runs jobs on market session events: before the open, at
+// the open, every few minutes while the market trades, at the close and
+// after it. Times come from the market's calendar, so holidays, early
+// closes, the CN lunch break and the US DST switches are all taken care of
+// without the jobs knowing.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"stock-backend/calendar"
+)
+
+// Event is the session event a job fires on.
+type Event int
+
+const (
+	// PreOpen fires Offset before the day's first open.
+	PreOpen Event = iota
+	// Open fires Offset after the day's first open.
+	Open
+	// Intraday fires every Every from Offset after each session's open
+	// until that session closes, skipping the lunch break.
+	Intraday
+	// Close fires Offset before the day's last close, early or not, for
+	// jobs that must act while the market still trades.
+	Close
+	// PostClose fires Offset after the last close, for jobs that wait for
+	// the day's data to settle.
+	PostClose
+)
+
+func (e Event) String() string {
+	switch e {
+	case PreOpen:
+		return "pre-open"
+	case Open:
+		return "open"
+	case Intraday:
+		return "intraday"
+	case Close:
+		return "close"
+	case PostClose:
+		return "post-close"
+	}
+	return fmt.Sprintf("Event(%d)", int(e))
+}
+
+// searchDays is how far ahead Next looks for a trading day, past the
+// longest holidays.
+const searchDays = 30
+
+// Job is work tied to one market's sessions.
+type Job struct {
+	Name   string
+	Market *calendar.Market
+	Event  Event
+	Offset time.Duration
+	// Every is the interval of an Intraday job.
+	Every time.Duration
+	Run   func(ctx context.Context, at time.Time)
+}
+
+// after is the job's first fire time on d's date that is after t.
+func (j Job) after(d, t time.Time) (time.Time, bool) {
+	m := j.Market
+	sessions := m.SessionsOn(d)
+	if len(sessions) == 0 {
+		return time.Time{}, false
+	}
+	first, last := sessions[0], sessions[len(sessions)-1]
+	var at time.Time
+	switch j.Event {
+	case PreOpen:
+		at = m.At(d, first.Open).Add(-j.Offset)
+	case Open:
+		at = m.At(d, first.Open).Add(j.Offset)
+	case Close:
+		at = m.At(d, last.Close).Add(-j.Offset)
+	case PostClose:
+		at = m.At(d, last.Close).Add(j.Offset)
+	case Intraday:
+		for _, s := range sessions {
+			at := m.At(d, s.Open).Add(j.Offset)
+			if !at.After(t) {
+				// 直接跳到 t 之后的那一拍，不用逐个列出
+				at = at.Add((t.Sub(at)/j.Every + 1) * j.Every)
+			}
+			if at.Before(m.At(d, s.Close)) {
+				return at, true
+			}
+		}
+		return time.Time{}, false
+	default:
+		return time.Time{}, false
+	}
+	return at, at.After(t)
+}
+
+// Next is the job's first fire time after t; false when the market does
+// not trade in the next searchDays days.
+func (j Job) Next(t time.Time) (time.Time, bool) {
+	local := t.In(j.Market.Location)
+	// 从前一天查起，盘前任务可能落在前一个自然日
+	d := time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, j.Market.Location)
+	for range searchDays {
+		if at, ok := j.after(d, t); ok {
+			return at, true
+		}
+		d = d.AddDate(0, 0, 1)
+	}
+	return time.Time{}, false
+}
+
+// Scheduler runs registered jobs one at a time. A job that runs past later
+// fire times skips them rather than queueing them up.
+type Scheduler struct {
+	jobs []Job
+	// Now and After stand in for the clock.
+	Now   func() time.Time
+	After func(d time.Duration) <-chan time.Time
+	// Logf reports what is next, fmt.Printf style; nil for silence.
+	Logf func(format string, args ...any)
+}
+
+// New makes a scheduler on the wall clock.
+func New() *Scheduler {
+	return &Scheduler{Now: time.Now, After: time.After}
+}
+
+// Add registers j.
+func (s *Scheduler) Add(j Job) error {
+	if j.Market == nil || j.Run == nil {
+		return fmt.Errorf("job %q: need a market and a run func", j.Name)
+	}
+	if j.Event == Intraday && j.Every <= 0 {
+		return fmt.Errorf("job %q: intraday needs an interval", j.Name)
+	}
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// Every registers fn to run every interval while m trades, starting offset
+// after each session opens.
+func (s *Scheduler) Every(m *calendar.Market, name string, offset, interval time.Duration, fn func(context.Context, time.Time)) error {
+	return s.Add(Job{Name: name, Market: m, Event: Intraday, Offset: offset, Every: interval, Run: fn})
+}
+
+// On registers fn on a session event of m.
+func (s *Scheduler) On(m *calendar.Market, e Event, name string, offset time.Duration, fn func(context.Context, time.Time)) error {
+	return s.Add(Job{Name: name, Market: m, Event: e, Offset: offset, Run: fn})
+}
+
+// Run fires the jobs until ctx is done. Jobs due at the same time run in
+// the order they were added.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if len(s.jobs) == 0 {
+		return fmt.Errorf("no jobs")
+	}
+	last := s.Now()
+	for {
+		next, due := s.next(last)
+		if len(due) == 0 {
+			return fmt.Errorf("no trading days in the next %d days", searchDays)
+		}
+		if s.Logf != nil {
+			names := make([]string, len(due))
+			for i, k := range due {
+				names[i] = s.jobs[k].Name
+			}
+			s.Logf("下次运行时间：%s %v\n", next.Format("2006-01-02 15:04:05 MST"), names)
+		}
+		if wait := next.Sub(s.Now()); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.After(wait):
+			}
+		}
+		for _, k := range due {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.jobs[k].Run(ctx, next)
+		}
+		// 跑得久的任务错过的时间点不补
+		last = next
+		if now := s.Now(); now.After(last) {
+			last = now
+		}
+	}
+}
+
+// next is the earliest fire time after t and the jobs due then.
+func (s *Scheduler) next(t time.Time) (time.Time, []int) {
+	var (
+		at  time.Time
+		due []int
+	)
+	for k, j := range s.jobs {
+		n, ok := j.Next(t)
+		switch {
+		case !ok:
+		case len(due) == 0 || n.Before(at):
+			at, due = n, []int{k}
+		case n.Equal(at):
+			due = append(due, k)
+		}
+	}
+	return at, due
+}
@@ -0,0 +1,164 @@
+package scoring
+
+import (
+	"math"
+
+	"stock-backend/downperiod"
+	"stock-backend/indicator"
+	"stock-backend/kline"
+	"stock-backend/regression"
+)
+
+const (
+	volumeBars = 5
+	maBars     = 20
+	gapHighs   = 5
+	trendBars  = 20
+)
+
+func init() {
+	register(Factor{
+		Name:  "volume_ratio",
+		Doc:   "xueqiu's volume ratio, or the last volume against the average of the 5 bars before",
+		Value: volumeRatio,
+	})
+	register(Factor{
+		Name:  "turnover",
+		Doc:   "turnover rate in percent, from the quote or the last bar",
+		Value: turnover,
+	})
+	register(Factor{
+		Name:  "ma_distance",
+		Doc:   "last close against its MA20, as a fraction",
+		Value: maDistance,
+	})
+	register(Factor{
+		Name:  "trend_quality",
+		Doc:   "slope of the log closes over the last 20 bars, weighted by r², see regression.Fit.Quality",
+		Value: trendQuality,
+	})
+	register(Factor{
+		Name:  "gap_size",
+		Doc:   "how far the gap opened above the 5 highs before it, as a fraction",
+		Value: gapSize,
+	})
+	register(Factor{
+		Name: "market_cap",
+		Doc:  "market capital",
+		Value: func(c Candidate) (float64, bool) {
+			return c.Quote.MarketCapital, c.Quote.MarketCapital > 0
+		},
+	})
+	register(Factor{
+		Name: "net_inflow",
+		Doc:  "main capital net inflow as a fraction of market capital",
+		Value: func(c Candidate) (float64, bool) {
+			if c.Quote.NetInflow == 0 || c.Quote.MarketCapital <= 0 {
+				return 0, false
+			}
+			return c.Quote.NetInflow / c.Quote.MarketCapital, true
+		},
+	})
+	register(Factor{
+		Name: "down_times",
+		Doc:  "bars under water in the last finished EMA5/EMA20 down period",
+		Value: func(c Candidate) (float64, bool) {
+			if len(c.Periods) == 0 {
+				return 0, false
+			}
+			return float64(c.Periods[len(c.Periods)-1].Times), true
+		},
+	})
+	register(Factor{
+		Name: "down_vol_ratio",
+		Doc:  "volume ratio of the last finished down period",
+		Value: func(c Candidate) (float64, bool) {
+			if len(c.Periods) == 0 {
+				return 0, false
+			}
+			return c.Periods[len(c.Periods)-1].VolRatio, true
+		},
+	})
+}
+
+func volumeRatio(c Candidate) (float64, bool) {
+	if c.Quote.VolumeRatio > 0 {
+		return c.Quote.VolumeRatio, true
+	}
+	n := len(c.Bars)
+	if n <= volumeBars {
+		return 0, false
+	}
+	avg := indicator.SMA(kline.Volumes(c.Bars[n-1-volumeBars : n-1]))
+	if avg <= 0 {
+		return 0, false
+	}
+	return c.Bars[n-1].Volume / avg, true
+}
+
+func turnover(c Candidate) (float64, bool) {
+	if c.Quote.TurnoverRate > 0 {
+		return c.Quote.TurnoverRate, true
+	}
+	bar, ok := c.last()
+	return bar.TurnoverRate, ok && bar.TurnoverRate > 0
+}
+
+func maDistance(c Candidate) (float64, bool) {
+	if len(c.Bars) < maBars {
+		return 0, false
+	}
+	ma := indicator.MA(kline.Closes(c.Bars), maBars)
+	last := ma[len(ma)-1]
+	if !(last > 0) {
+		return 0, false
+	}
+	return c.Bars[len(c.Bars)-1].Close/last - 1, true
+}
+
+func trendQuality(c Candidate) (float64, bool) {
+	if len(c.Bars) < trendBars {
+		return 0, false
+	}
+	fit, err := regression.Prices(kline.Closes(c.Bars[len(c.Bars)-trendBars:]), true)
+	if err != nil {
+		return 0, false
+	}
+	return fit.Quality(), true
+}
+
+// gapSize needs gap_open and either gap_ts, to find the highs before the
+// gap bar in Bars, or prev_high directly.
+func gapSize(c Candidate) (float64, bool) {
+	open, ok := c.Values["gap_open"]
+	if !ok {
+		return 0, false
+	}
+	if high, ok := c.Values["prev_high"]; ok && high > 0 {
+		return open/high - 1, true
+	}
+	ts, ok := c.Values["gap_ts"]
+	if !ok {
+		return 0, false
+	}
+	for j := len(c.Bars) - 1; j > 0; j-- {
+		if c.Bars[j].Timestamp != int64(ts) {
+			continue
+		}
+		high := math.Inf(-1)
+		for _, b := range c.Bars[max(0, j-gapHighs):j] {
+			high = math.Max(high, b.High)
+		}
+		return open/high - 1, high > 0
+	}
+	return 0, false
+}
+
+// DownPeriods runs the EMA5/EMA20 machine over bars, for Candidate.Periods.
+func DownPeriods(bars []kline.Bar) []downperiod.DownPeriod {
+	m := downperiod.New(downperiod.DefaultConfig)
+	for _, b := range bars {
+		m.Push(b)
+	}
+	return m.Periods()
+}
@@ -0,0 +1,247 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"stock-backend/downperiod"
+	"stock-backend/kline"
+)
+
+// Quote is the live data a checker fetched for a symbol. Zero fields are
+// treated as unknown.
+type Quote struct {
+	Name          string
+	MarketCapital float64
+	TurnoverRate  float64
+	VolumeRatio   float64
+	// NetInflow is the main capital net inflow of the day.
+	NetInflow float64
+}
+
+// Candidate is one hit to be ranked, with everything the factors look at.
+type Candidate struct {
+	Symbol   string
+	Strategy string
+	// Bars is the history up to and including the bar that triggered.
+	Bars []kline.Bar
+	// Values are the signal's own numbers, see strategy.Signal.Values.
+	// gap_open and gap_ts feed the gap_size factor.
+	Values map[string]float64
+	Quote  Quote
+	// Periods are the finished EMA5/EMA20 down periods, oldest first.
+	Periods []downperiod.DownPeriod
+}
+
+func (c Candidate) last() (kline.Bar, bool) {
+	if len(c.Bars) == 0 {
+		return kline.Bar{}, false
+	}
+	return c.Bars[len(c.Bars)-1], true
+}
+
+// Factor computes one raw number for a candidate. ok is false when the
+// candidate lacks the data.
+type Factor struct {
+	Name  string
+	Doc   string
+	Value func(c Candidate) (v float64, ok bool)
+}
+
+// Factors are the known factors by name.
+var Factors = map[string]Factor{}
+
+func register(f Factor) {
+	Factors[f.Name] = f
+}
+
+// FactorNames lists the known factors.
+func FactorNames() []string {
+	res := make([]string, 0, len(Factors))
+	for name := range Factors {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Config is the weight of each factor. A negative weight prefers low
+// values, e.g. a small distance from the MA.
+type Config struct {
+	Weights map[string]float64 `yaml:"weights"`
+}
+
+// Default replaces the old markers: heavy volume ($$$$), a quiet down period
+// of 5 to 20 bars (@@@@@) and market cap, which daily-check sorted by.
+var Default = Config{Weights: map[string]float64{
+	"volume_ratio":   1,
+	"turnover":       0.5,
+	"ma_distance":    -0.5,
+	"trend_quality":  0.5,
+	"gap_size":       1,
+	"market_cap":     1,
+	"net_inflow":     1,
+	"down_times":     0.5,
+	"down_vol_ratio": 0.5,
+}}
+
+// Load reads a config from a YAML file such as
+//
+//	weights:
+//	  volume_ratio: 1
+//	  ma_distance: -0.5
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.Check(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Check reports unknown factors and a config that weighs nothing.
+func (cfg Config) Check() error {
+	if len(cfg.Weights) == 0 {
+		return fmt.Errorf("no weights")
+	}
+	for name := range cfg.Weights {
+		if _, ok := Factors[name]; !ok {
+			return fmt.Errorf("unknown factor %q, known: %s", name, strings.Join(FactorNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Part is one factor's share of a score.
+type Part struct {
+	Factor string
+	Raw    float64
+	// Norm is the candidate's percentile among those ranked together, 0 for
+	// the lowest raw value and 1 for the highest. A missing value is 0.5.
+	Norm    float64
+	Missing bool
+	Weight  float64
+	// Points is what the factor added to the score.
+	Points float64
+}
+
+// Result is a candidate with its score, best first from Rank.
+type Result struct {
+	Candidate
+	Score float64
+	Parts []Part
+}
+
+// Rank scores candidates against each other and sorts them best first.
+// Raw values are turned into percentiles within the batch so factors on
+// very different scales, market cap against a volume ratio, weigh what
+// their weights say. A weight w contributes w*norm for positive weights and
+// |w|*(1-norm) for negative ones, so the score runs from 0 to the sum of
+// absolute weights.
+func Rank(cands []Candidate, cfg Config) ([]Result, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Weights))
+	for name := range cfg.Weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]Result, len(cands))
+	for i, c := range cands {
+		res[i] = Result{Candidate: c, Parts: make([]Part, len(names))}
+	}
+	for k, name := range names {
+		f, w := Factors[name], cfg.Weights[name]
+		raw := make([]float64, len(cands))
+		ok := make([]bool, len(cands))
+		for i, c := range cands {
+			raw[i], ok[i] = f.Value(c)
+			if ok[i] && (math.IsNaN(raw[i]) || math.IsInf(raw[i], 0)) {
+				ok[i] = false
+			}
+		}
+		norm := percentiles(raw, ok)
+		for i := range cands {
+			p := Part{Factor: name, Raw: raw[i], Norm: norm[i], Missing: !ok[i], Weight: w}
+			if w >= 0 {
+				p.Points = w * p.Norm
+			} else {
+				p.Points = -w * (1 - p.Norm)
+			}
+			res[i].Parts[k] = p
+			res[i].Score += p.Points
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Symbol < res[j].Symbol
+	})
+	return res, nil
+}
+
+// percentiles maps each present value to its average rank in [0, 1]. Ties
+// share a rank; a lone value gets 0.5, as do missing ones.
+func percentiles(raw []float64, ok []bool) []float64 {
+	var idx []int
+	for i := range raw {
+		if ok[i] {
+			idx = append(idx, i)
+		}
+	}
+	sort.Slice(idx, func(a, b int) bool { return raw[idx[a]] < raw[idx[b]] })
+	res := make([]float64, len(raw))
+	for i := range res {
+		res[i] = 0.5
+	}
+	if len(idx) < 2 {
+		return res
+	}
+	for lo := 0; lo < len(idx); {
+		hi := lo
+		for hi+1 < len(idx) && raw[idx[hi+1]] == raw[idx[lo]] {
+			hi++
+		}
+		rank := float64(lo+hi) / 2 / float64(len(idx)-1)
+		for k := lo; k <= hi; k++ {
+			res[idx[k]] = rank
+		}
+		lo = hi + 1
+	}
+	return res
+}
+
+// Format writes the ranked list with each factor's raw value and points,
+// one candidate per line.
+func Format(results []Result) string {
+	var sb strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&sb, "%3d %-10s %-8s %6.3f", i+1, r.Symbol, r.Quote.Name, r.Score)
+		if r.Strategy != "" {
+			fmt.Fprintf(&sb, "  [%s]", r.Strategy)
+		}
+		for _, p := range r.Parts {
+			if p.Missing {
+				fmt.Fprintf(&sb, "  %s=- (%.2f)", p.Factor, p.Points)
+				continue
+			}
+			fmt.Fprintf(&sb, "  %s=%.4g (%.2f)", p.Factor, p.Raw, p.Points)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/screener"
+)
+
+// argList collects repeated -arg name=value flags.
+type argList screener.Args
+
+func (a argList) String() string {
+	return fmt.Sprint(map[string]any(a))
+}
+
+func (a argList) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	a[name] = value
+	return nil
+}
+
+func main() {
+	dir := flag.String("dir", screener.DefaultDir, "directory holding the screen SQL files")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	list := flag.Bool("list", false, "list the screens and exit")
+	show := flag.Bool("sql", false, "print the bound SQL instead of running it")
+	limit := flag.Int("limit", 0, "stop after this many rows, 0 for all")
+	args := argList{}
+	flag.Var(args, "arg", "screen parameter as name=value, repeatable")
+	flag.Parse()
+
+	reg, err := screener.Open(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load screens: %v", err)
+	}
+	if *list {
+		for _, q := range reg.List() {
+			fmt.Printf("%-20s v%d  %s\n", q.Name, q.Version, q.Description)
+			for _, p := range q.Params {
+				def := "required"
+				if p.Default != "" {
+					def = "default " + p.Default
+				}
+				fmt.Printf("    %-16s %-7s %-16s %s\n", p.Name, p.Kind, def, p.Doc)
+			}
+		}
+		return
+	}
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: screen-runner [flags] <name[@version]>")
+	}
+	ref := flag.Arg(0)
+
+	if *show {
+		q, err := reg.Get(ref)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sql, bound, err := q.Bind(screener.Args(args))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(sql)
+		for _, b := range bound {
+			nv := b.(driver.NamedValue)
+			fmt.Printf("-- @%s = %#v\n", nv.Name, nv.Value)
+		}
+		return
+	}
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	rows, err := reg.Query(context.Background(), conn, ref, screener.Args(args))
+	if err != nil {
+		log.Fatalf("Failed to execute query: %v", err)
+	}
+	defer rows.Close()
+
+	types := rows.ColumnTypes()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(rows.Columns(), "\t"))
+	count := 0
+	for rows.Next() {
+		dest := make([]any, len(types))
+		for i, t := range types {
+			dest[i] = reflect.New(t.ScanType()).Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Fatalf("Failed to scan row: %v", err)
+		}
+		cells := make([]string, len(dest))
+		for i, d := range dest {
+			cells[i] = fmt.Sprint(reflect.ValueOf(d).Elem().Interface())
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+		count++
+		if *limit > 0 && count >= *limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Failed to read rows: %v", err)
+	}
+	w.Flush()
+	fmt.Printf("共 %d 行, 耗时：%s\n", count, time.Since(start))
+}
@@ -0,0 +1,155 @@
+package screener
+
+// DefaultDir is where the query files live relative to the repository root.
+const DefaultDir = "screens"
+
+var (
+	market = Param{Name: "market", Kind: Market, Doc: "cn or us"}
+	// asOf runs a screen on the rows before a time, so a backtest picks its
+	// symbols from what was known when it starts. The v2 screens take it.
+	asOf = Param{Name: "as_of", Kind: Int, Default: "0", Doc: "unix milliseconds to screen as of, 0 for now"}
+)
+
+// Builtin is every screen the tools in this repository run. Bump Version and
+// point at a new file when a change would alter results; keep the old entry
+// so earlier runs can be reproduced.
+var Builtin = []Query{
+	{
+		Name:        "near-high",
+		Version:     1,
+		Description: "close above ratio times the high from window_days to skip_days ago",
+		File:        "near-high.sql",
+		Params: []Param{
+			market,
+			{Name: "window_days", Kind: Int, Default: "120"},
+			{Name: "skip_days", Kind: Int, Default: "5"},
+			{Name: "ratio", Kind: Float, Default: "0.8", Doc: "0.8 for cn, 0.46 was used for us"},
+		},
+	},
+	{
+		Name:        "near-high",
+		Version:     2,
+		Description: "close above ratio times the high from window_days to skip_days ago, as of as_of",
+		File:        "near-high-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "window_days", Kind: Int, Default: "120"},
+			{Name: "skip_days", Kind: Int, Default: "5"},
+			{Name: "ratio", Kind: Float, Default: "0.8", Doc: "0.8 for cn, 0.46 was used for us"},
+		},
+	},
+	{
+		Name:        "recent-high",
+		Version:     1,
+		Description: "highest high per symbol over the last days",
+		File:        "recent-high.sql",
+		Params: []Param{
+			market,
+			{Name: "days", Kind: Int, Default: "8"},
+		},
+	},
+	{
+		Name:        "recent-high",
+		Version:     2,
+		Description: "highest high per symbol over the last days, as of as_of",
+		File:        "recent-high-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "days", Kind: Int, Default: "8"},
+		},
+	},
+	{
+		Name:        "weekly-inside",
+		Version:     1,
+		Description: "weekly bars in the last weeks whose high stayed under the previous week's open",
+		File:        "weekly-inside.sql",
+		Params: []Param{
+			market,
+			{Name: "weeks", Kind: Int, Default: "3"},
+		},
+	},
+	{
+		Name:        "weekly-inside",
+		Version:     2,
+		Description: "weekly bars in the last weeks whose high stayed under the previous week's open, as of as_of",
+		File:        "weekly-inside-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "weeks", Kind: Int, Default: "3"},
+		},
+	},
+	{
+		Name:        "gap-records",
+		Version:     1,
+		Description: "latest gap per symbol between from_days and to_days ago",
+		File:        "gap-records.sql",
+		Params: []Param{
+			market,
+			{Name: "from_days", Kind: Int, Default: "5"},
+			{Name: "to_days", Kind: Int, Default: "12"},
+			{Name: "latest_only", Kind: Int, Default: "1", Doc: "1 for symbols with a bar on the latest day, 0 for every symbol"},
+			{Name: "min_market_cap", Kind: Float, Default: "0", Doc: "with latest_only, market cap the latest bar must exceed; 0 for any"},
+		},
+	},
+	{
+		Name:        "gap-records",
+		Version:     2,
+		Description: "latest gap per symbol between from_days and to_days ago, as of as_of",
+		File:        "gap-records-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "from_days", Kind: Int, Default: "5"},
+			{Name: "to_days", Kind: Int, Default: "12"},
+			{Name: "latest_only", Kind: Int, Default: "1", Doc: "1 for symbols with a bar on the latest day, 0 for every symbol"},
+			{Name: "min_market_cap", Kind: Float, Default: "0", Doc: "with latest_only, market cap the latest bar must exceed; 0 for any"},
+		},
+	},
+	{
+		Name:        "recent-gaps",
+		Version:     1,
+		Description: "symbols that gapped above their 5-day high within the last within_days",
+		File:        "recent-gaps.sql",
+		Params: []Param{
+			market,
+			{Name: "lookback_days", Kind: Int, Default: "20"},
+			{Name: "within_days", Kind: Int, Default: "10"},
+		},
+	},
+	{
+		Name:        "recent-gaps",
+		Version:     2,
+		Description: "symbols that gapped above their 5-day high within the last within_days, as of as_of",
+		File:        "recent-gaps-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "lookback_days", Kind: Int, Default: "20"},
+			{Name: "within_days", Kind: Int, Default: "10"},
+		},
+	},
+	{
+		Name:        "latest-symbols",
+		Version:     1,
+		Description: "symbols with a bar on the latest trading day",
+		File:        "latest-symbols.sql",
+		Params: []Param{
+			market,
+			{Name: "min_market_cap", Kind: Float, Default: "0"},
+		},
+	},
+	{
+		Name:        "latest-symbols",
+		Version:     2,
+		Description: "symbols with a bar on the latest trading day, as of as_of",
+		File:        "latest-symbols-v2.sql",
+		Params: []Param{
+			market,
+			asOf,
+			{Name: "min_market_cap", Kind: Float, Default: "0"},
+		},
+	},
+}
@@ -0,0 +1,312 @@
+package screener
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Kind is the type of a query parameter.
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+	String
+	// Market is cn or us. It is the only kind that goes into the SQL text,
+	// as {{name}}, because it picks the table; everything else is bound.
+	Market
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case String:
+		return "string"
+	case Market:
+		return "market"
+	}
+	return "unknown"
+}
+
+// Param is one typed query parameter. A param without a Default is required.
+type Param struct {
+	Name    string
+	Kind    Kind
+	Default string
+	Doc     string
+}
+
+// Query is one named, versioned screen. The SQL lives in File under the
+// registry's directory and refers to params as @name, or {{name}} for
+// Market params.
+type Query struct {
+	Name        string
+	Version     int
+	Description string
+	File        string
+	Params      []Param
+
+	sql string
+}
+
+// Ref is name@version.
+func (q *Query) Ref() string {
+	return fmt.Sprintf("%s@%d", q.Name, q.Version)
+}
+
+// SQL is the query text as read from File.
+func (q *Query) SQL() string {
+	return q.sql
+}
+
+var (
+	namedRe  = regexp.MustCompile(`@([a-zA-Z0-9_]+)`)
+	marketRe = regexp.MustCompile(`\{\{([a-zA-Z0-9_]+)\}\}`)
+)
+
+// Registry holds the queries by name, every version of each.
+type Registry struct {
+	dir     string
+	queries map[string][]*Query
+}
+
+// NewRegistry reads every query's file from dir and checks its params
+// against the SQL, so a missing or mismatched file fails at startup instead
+// of on the first run.
+func NewRegistry(dir string, queries ...Query) (*Registry, error) {
+	r := &Registry{dir: dir, queries: make(map[string][]*Query)}
+	var problems []string
+	for i := range queries {
+		q := queries[i]
+		if err := r.add(&q); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("screener: %s", strings.Join(problems, "; "))
+	}
+	for _, versions := range r.queries {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return r, nil
+}
+
+// Open is NewRegistry with the built-in queries.
+func Open(dir string) (*Registry, error) {
+	return NewRegistry(dir, Builtin...)
+}
+
+func (r *Registry) add(q *Query) error {
+	if q.Name == "" || q.Version <= 0 {
+		return fmt.Errorf("query %q needs a name and a positive version", q.Name)
+	}
+	for _, v := range r.queries[q.Name] {
+		if v.Version == q.Version {
+			return fmt.Errorf("%s registered twice", q.Ref())
+		}
+	}
+	path := filepath.Join(r.dir, q.File)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", q.Ref(), err)
+	}
+	q.sql = string(b)
+
+	declared := make(map[string]Kind, len(q.Params))
+	for _, p := range q.Params {
+		declared[p.Name] = p.Kind
+	}
+	used := make(map[string]bool)
+	for _, m := range namedRe.FindAllStringSubmatch(q.sql, -1) {
+		kind, ok := declared[m[1]]
+		if !ok || kind == Market {
+			return fmt.Errorf("%s: %s uses @%s which is not a bound param", q.Ref(), path, m[1])
+		}
+		used[m[1]] = true
+	}
+	for _, m := range marketRe.FindAllStringSubmatch(q.sql, -1) {
+		if kind, ok := declared[m[1]]; !ok || kind != Market {
+			return fmt.Errorf("%s: %s uses {{%s}} which is not a market param", q.Ref(), path, m[1])
+		}
+		used[m[1]] = true
+	}
+	for _, p := range q.Params {
+		if !used[p.Name] {
+			return fmt.Errorf("%s: param %s is not used in %s", q.Ref(), p.Name, path)
+		}
+		if p.Default != "" {
+			if _, err := p.parse(p.Default); err != nil {
+				return fmt.Errorf("%s: default of %s: %w", q.Ref(), p.Name, err)
+			}
+		}
+	}
+	r.queries[q.Name] = append(r.queries[q.Name], q)
+	return nil
+}
+
+// Get looks a query up by name, which picks the latest version, or by
+// name@version.
+func (r *Registry) Get(ref string) (*Query, error) {
+	name, version := ref, 0
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		v, err := strconv.Atoi(ref[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("bad query reference %q", ref)
+		}
+		name, version = ref[:i], v
+	}
+	versions := r.queries[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("unknown query %q", name)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, q := range versions {
+		if q.Version == version {
+			return q, nil
+		}
+	}
+	return nil, fmt.Errorf("query %s has no version %d", name, version)
+}
+
+// List returns the latest version of every query, sorted by name.
+func (r *Registry) List() []*Query {
+	res := make([]*Query, 0, len(r.queries))
+	for _, versions := range r.queries {
+		res = append(res, versions[len(versions)-1])
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Args are param values by name. A value may be a string, as from the
+// command line, or a Go value of the param's kind.
+type Args map[string]any
+
+// Bind checks args against the params, fills in defaults, and returns the
+// SQL with market params substituted plus the bound values for the rest.
+func (q *Query) Bind(args Args) (string, []any, error) {
+	declared := make(map[string]bool, len(q.Params))
+	for _, p := range q.Params {
+		declared[p.Name] = true
+	}
+	for name := range args {
+		if !declared[name] {
+			return "", nil, fmt.Errorf("%s: unknown param %s", q.Ref(), name)
+		}
+	}
+
+	sql := q.sql
+	var bound []any
+	for _, p := range q.Params {
+		raw, ok := args[p.Name]
+		if !ok {
+			if p.Default == "" {
+				return "", nil, fmt.Errorf("%s: param %s is required", q.Ref(), p.Name)
+			}
+			raw = p.Default
+		}
+		v, err := p.value(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: param %s: %w", q.Ref(), p.Name, err)
+		}
+		if p.Kind == Market {
+			sql = strings.ReplaceAll(sql, "{{"+p.Name+"}}", v.(string))
+			continue
+		}
+		bound = append(bound, clickhouse.Named(p.Name, v))
+	}
+	return sql, bound, nil
+}
+
+func (p Param) value(raw any) (any, error) {
+	switch v := raw.(type) {
+	case string:
+		return p.parse(v)
+	case int:
+		if p.Kind == Int {
+			return int64(v), nil
+		}
+		if p.Kind == Float {
+			return float64(v), nil
+		}
+	case int64:
+		if p.Kind == Int {
+			return v, nil
+		}
+		if p.Kind == Float {
+			return float64(v), nil
+		}
+	case float64:
+		if p.Kind == Float {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %v (%T) as %s", raw, raw, p.Kind)
+}
+
+func (p Param) parse(s string) (any, error) {
+	switch p.Kind {
+	case Int:
+		return strconv.ParseInt(s, 10, 64)
+	case Float:
+		return strconv.ParseFloat(s, 64)
+	case String:
+		return s, nil
+	case Market:
+		if s != "cn" && s != "us" {
+			return nil, fmt.Errorf("market must be cn or us, got %q", s)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown kind %d", p.Kind)
+}
+
+// Query runs ref with args.
+func (r *Registry) Query(ctx context.Context, conn driver.Conn, ref string, args Args) (driver.Rows, error) {
+	q, err := r.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	sql, bound, err := q.Bind(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, bound...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", q.Ref(), err)
+	}
+	return rows, nil
+}
+
+// Symbols runs ref, which must select the symbol column only, and collects
+// the symbols.
+func (r *Registry) Symbols(ctx context.Context, conn driver.Conn, ref string, args Args) ([]string, error) {
+	rows, err := r.Query(ctx, conn, ref, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, fmt.Errorf("%s: %w", ref, err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
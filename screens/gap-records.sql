@@ -0,0 +1,18 @@
+-- 每个标的在时间窗口内最近的一次缺口
+-- latest_only = 1 只看最新交易日有数据的标的，min_market_cap 大于 0 时这些标的还要市值超过它；
+-- latest_only = 0 不筛标的，和原来 us-daily-check 的查询一样
+WITH RankedSymbols AS (
+    SELECT *,
+           ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
+    FROM {{market}}_gap_records
+    WHERE (@latest_only = 0 OR symbol IN (
+        SELECT DISTINCT symbol FROM {{market}}_stock_daily
+        WHERE timestamp = (SELECT max(timestamp) FROM {{market}}_stock_daily)
+        AND (@min_market_cap = 0 OR market_capital > @min_market_cap)
+    ))
+    AND `timestamp` >= toUnixTimestamp(now()) * 1000 - @to_days * 24 * 3600 * 1000
+    AND `timestamp` <= toUnixTimestamp(now()) * 1000 - @from_days * 24 * 3600 * 1000
+)
+SELECT symbol, open, close, timestamp
+FROM RankedSymbols
+WHERE rn = 1
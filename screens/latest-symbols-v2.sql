@@ -0,0 +1,6 @@
+-- as_of 前最后一个交易日有数据且市值达标的标的
+SELECT DISTINCT symbol
+FROM {{market}}_stock_daily
+WHERE timestamp = (SELECT max(timestamp) FROM {{market}}_stock_daily WHERE timestamp < if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000))
+AND ifNull(market_capital, 0) >= @min_market_cap
+ORDER BY symbol
@@ -0,0 +1,6 @@
+-- 最新交易日有数据且市值达标的标的
+SELECT DISTINCT symbol
+FROM {{market}}_stock_daily
+WHERE timestamp = (SELECT max(timestamp) FROM {{market}}_stock_daily)
+AND ifNull(market_capital, 0) >= @min_market_cap
+ORDER BY symbol
@@ -0,0 +1,27 @@
+-- 收盘价高于一段时间内最高价的一定比例（原 script_120.sql / script copy.sql）
+WITH window_max AS (
+   SELECT
+       symbol,
+       MAX(high) AS max_high
+   FROM
+       {{market}}_stock_daily
+   WHERE
+       `timestamp` >= toUnixTimestamp(now()) * 1000 - @window_days * 24 * 3600 * 1000
+       AND `timestamp` <= toUnixTimestamp(now()) * 1000 - @skip_days * 24 * 3600 * 1000
+   GROUP BY
+       symbol
+)
+SELECT
+   d.symbol,
+   d.high,
+   d.`open`,
+   d.volume,
+   d.timestamp,
+   window_max.max_high
+FROM
+   {{market}}_stock_daily d
+LEFT JOIN
+   window_max ON d.symbol = window_max.symbol
+WHERE
+   `timestamp` = (SELECT MAX(`timestamp`) FROM {{market}}_stock_daily)
+   AND d.`close` > window_max.max_high * @ratio
@@ -0,0 +1,27 @@
+-- 最近出现过缺口（开盘价高于前 5 根最高价）的标的（原 script_30_days_gap_exists.sql）
+WITH ranked_data AS (
+    SELECT
+        symbol,
+        timestamp,
+        open,
+        MAX(high) OVER (
+            PARTITION BY symbol
+            ORDER BY timestamp
+            ROWS BETWEEN 5 PRECEDING AND 1 PRECEDING
+        ) AS max_past_5_days
+    FROM
+        {{market}}_stock_daily
+    WHERE
+        timestamp >= if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000) - @lookback_days * 24 * 3600 * 1000
+        AND timestamp < if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000)
+)
+SELECT
+    DISTINCT symbol
+FROM
+    ranked_data
+WHERE
+    open > max_past_5_days
+    AND max_past_5_days != 0
+    AND timestamp >= if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000) - @within_days * 24 * 3600 * 1000
+ORDER BY
+    symbol
@@ -0,0 +1,11 @@
+-- 最近几天的最高价（原 script_5_days_high.sql）
+SELECT
+    symbol,
+    MAX(high) AS max_high
+FROM
+    {{market}}_stock_daily
+WHERE
+    `timestamp` > if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000) - @days * 24 * 3600 * 1000
+    AND `timestamp` < if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000)
+GROUP BY
+    symbol
@@ -0,0 +1,10 @@
+-- 最近几天的最高价（原 script_5_days_high.sql）
+SELECT
+    symbol,
+    MAX(high) AS max_high
+FROM
+    {{market}}_stock_daily
+WHERE
+    `timestamp` > toUnixTimestamp(now()) * 1000 - @days * 24 * 3600 * 1000
+GROUP BY
+    symbol
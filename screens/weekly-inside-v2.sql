@@ -0,0 +1,25 @@
+-- 最近几周内出现最高价低于上一周开盘价的周线（原 script_weekly_5.sql）
+WITH LatestStocks AS (
+    SELECT
+        symbol,
+        open,
+        high,
+        volume,
+        ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
+    FROM
+        {{market}}_stock_weekly
+    WHERE
+        `timestamp` < if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000)
+)
+SELECT
+    l.symbol,
+    l.high AS latest_high,
+    l_prev.open AS prev_open,
+    l.rn
+FROM
+    LatestStocks l
+JOIN
+    LatestStocks l_prev ON l.symbol = l_prev.symbol AND l.rn = l_prev.rn + 1
+WHERE
+    l.high < l_prev.open AND l.rn <= @weeks
+ORDER BY l.volume DESC
@@ -1,12 +1,13 @@
+-- 最近几周内出现最高价低于上一周开盘价的周线（原 script_weekly_5.sql）
 WITH LatestStocks AS (
     SELECT
         symbol,
         open,
         high,
-        volume, 
+        volume,
         ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
     FROM
-        cn_stock_weekly
+        {{market}}_stock_weekly
 )
 SELECT
     l.symbol,
@@ -18,4 +19,5 @@ FROM
 JOIN
     LatestStocks l_prev ON l.symbol = l_prev.symbol AND l.rn = l_prev.rn + 1
 WHERE
-    l.high < l_prev.open and l.rn < 4 ORDER BY l.volume desc;
\ No newline at end of file
+    l.high < l_prev.open AND l.rn <= @weeks
+ORDER BY l.volume DESC
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/signals"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	day := flag.String("day", time.Now().Format("2006-01-02"), "detection day, YYYY-MM-DD in local time")
+	days := flag.Int("days", 1, "number of days ending at -day")
+	all := flag.Bool("all", false, "ignore -day and list every day")
+	name := flag.String("strategy", "", "only this strategy")
+	symbol := flag.String("symbol", "", "only this symbol")
+	market := flag.String("market", "", "only this market, cn or us")
+	limit := flag.Int("limit", 0, "at most this many rows, 0 for all")
+	asJSON := flag.Bool("json", false, "print one JSON object per line")
+	flag.Parse()
+
+	f := signals.Filter{
+		Strategy: *name,
+		Symbol:   *symbol,
+		Market:   *market,
+		Limit:    *limit,
+	}
+	if !*all {
+		t, err := time.ParseInLocation("2006-01-02", *day, time.Local)
+		if err != nil {
+			log.Fatalf("Bad -day: %v", err)
+		}
+		d := signals.Day(t)
+		f.From, f.To = d.From.AddDate(0, 0, 1-*days), d.To
+	}
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	store, err := signals.Open(ctx, conn)
+	if err != nil {
+		log.Fatalf("Failed to open signals: %v", err)
+	}
+	records, err := store.List(ctx, f)
+	if err != nil {
+		log.Fatalf("Failed to list signals: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				log.Fatalf("Failed to encode signal: %v", err)
+			}
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "detected\tstrategy\tmarket\tsymbol\tbar\tdirection\tprice\tpayload")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.3f\t%s\n",
+			r.DetectedAt.Local().Format("2006-01-02 15:04:05"),
+			r.Strategy, r.Market, r.Symbol,
+			time.UnixMilli(r.BarTime).Format("2006-01-02 15:04"),
+			r.Direction, r.Price, formatPayload(r.Payload))
+	}
+	w.Flush()
+	fmt.Printf("共 %d 条\n", len(records))
+}
+
+func formatPayload(payload map[string]any) string {
+	keys := make([]string, 0, len(payload))
+	for k := range payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		f, ok := payload[k].(float64)
+		if ok && strings.HasSuffix(k, "_ts") {
+			parts = append(parts, fmt.Sprintf("%s=%s", k, time.UnixMilli(int64(f)).Format("2006-01-02 15:04")))
+			continue
+		}
+		if ok {
+			parts = append(parts, fmt.Sprintf("%s=%.4g", k, f))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", k, payload[k]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,180 @@
+package signals
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/strategy"
+)
+
+// Table is the ClickHouse table the checkers write their hits to, in place
+// of the running*.txt files that were deleted on every loop.
+const Table = "signals"
+
+const createTable = `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+	strategy    LowCardinality(String),
+	symbol      String,
+	market      LowCardinality(String),
+	bar_ts      Int64,
+	detected_at DateTime64(3),
+	price       Float64,
+	direction   LowCardinality(String),
+	payload     String
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(detected_at)
+ORDER BY (strategy, detected_at, symbol)`
+
+// Record is one row of the signals table.
+type Record struct {
+	Strategy string
+	Symbol   string
+	Market   string
+	// BarTime is the timestamp of the bar that triggered, unix milliseconds
+	// like the kline tables.
+	BarTime    int64
+	DetectedAt time.Time
+	Price      float64
+	Direction  strategy.Direction
+	// Payload is whatever the strategy computed, stored as JSON.
+	Payload map[string]any
+}
+
+// FromSignal turns a strategy hit into a record detected at at.
+func FromSignal(sig strategy.Signal, market string, at time.Time) Record {
+	payload := make(map[string]any, len(sig.Values))
+	for k, v := range sig.Values {
+		payload[k] = v
+	}
+	return Record{
+		Strategy:   sig.Strategy,
+		Symbol:     sig.Symbol,
+		Market:     market,
+		BarTime:    sig.Bar.Timestamp,
+		DetectedAt: at,
+		Price:      sig.Price,
+		Direction:  sig.Direction,
+		Payload:    payload,
+	}
+}
+
+// Store reads and writes the signals table.
+type Store struct {
+	Conn driver.Conn
+}
+
+// Open returns a store on conn, creating the table if it is missing.
+func Open(ctx context.Context, conn driver.Conn) (*Store, error) {
+	if err := conn.Exec(ctx, createTable); err != nil {
+		return nil, fmt.Errorf("create %s: %w", Table, err)
+	}
+	return &Store{Conn: conn}, nil
+}
+
+// Write inserts records in one batch.
+func (s *Store) Write(ctx context.Context, records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	batch, err := s.Conn.PrepareBatch(ctx, `INSERT INTO `+Table+` (strategy, symbol, market, bar_ts, detected_at, price, direction, payload)`)
+	if err != nil {
+		return fmt.Errorf("prepare %s insert: %w", Table, err)
+	}
+	for _, r := range records {
+		payload, err := json.Marshal(r.Payload)
+		if err != nil {
+			return fmt.Errorf("payload of %s %s: %w", r.Strategy, r.Symbol, err)
+		}
+		if err := batch.Append(r.Strategy, r.Symbol, r.Market, r.BarTime, r.DetectedAt, r.Price, r.Direction.String(), string(payload)); err != nil {
+			return fmt.Errorf("append %s %s: %w", r.Strategy, r.Symbol, err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("insert into %s: %w", Table, err)
+	}
+	return nil
+}
+
+// Filter narrows List. Zero fields match everything.
+type Filter struct {
+	Strategy string
+	Symbol   string
+	Market   string
+	// From and To bound the detection time, [From, To).
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Day is a filter for everything detected on t's calendar day in t's
+// location.
+func Day(t time.Time) Filter {
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return Filter{From: from, To: from.AddDate(0, 0, 1)}
+}
+
+// List returns matching records, oldest detection first.
+func (s *Store) List(ctx context.Context, f Filter) ([]Record, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+	if f.Strategy != "" {
+		add("strategy = ?", f.Strategy)
+	}
+	if f.Symbol != "" {
+		add("symbol = ?", f.Symbol)
+	}
+	if f.Market != "" {
+		add("market = ?", f.Market)
+	}
+	if !f.From.IsZero() {
+		add("detected_at >= fromUnixTimestamp64Milli(?)", f.From.UnixMilli())
+	}
+	if !f.To.IsZero() {
+		add("detected_at < fromUnixTimestamp64Milli(?)", f.To.UnixMilli())
+	}
+	query := `SELECT strategy, symbol, market, bar_ts, detected_at, price, direction, payload FROM ` + Table
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY detected_at, strategy, symbol`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.Conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", Table, err)
+	}
+	defer rows.Close()
+	var res []Record
+	for rows.Next() {
+		var (
+			r         Record
+			direction string
+			payload   string
+		)
+		if err := rows.Scan(&r.Strategy, &r.Symbol, &r.Market, &r.BarTime, &r.DetectedAt, &r.Price, &direction, &payload); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", Table, err)
+		}
+		r.Direction, err = strategy.ParseDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &r.Payload); err != nil {
+			return nil, fmt.Errorf("payload of %s %s: %w", r.Strategy, r.Symbol, err)
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,55 @@
+// Package stocknames reads the <market>_stock_names table, the daily name
+// snapshots csv-gen exports from the feed's list.json, so backtests know on
+// which days a stock traded under risk warning.
+package stocknames
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/backtest"
+	"stock-backend/calendar"
+)
+
+// LoadST returns the days from from to to each symbol had an ST name; to 0
+// means no end. Days before the names were first imported have no rows and
+// count as not ST.
+func LoadST(ctx context.Context, conn driver.Conn, market string, from, to int64) (backtest.ST, error) {
+	cal, err := calendar.Get(market)
+	if err != nil {
+		return nil, err
+	}
+	table := market + "_stock_names"
+	// 日期按市场所在时区算，和回测引擎查 ST 时一样；多出来的最后一天不碍事
+	day := func(ms int64) string { return time.UnixMilli(ms).In(cal.Location).Format("2006-01-02") }
+	until := "2100-01-01"
+	if to > 0 {
+		until = day(to)
+	}
+	query := `SELECT symbol, toString(date), name
+		FROM ` + table + `
+		WHERE date >= toDate(?) AND date <= toDate(?) AND name LIKE '%ST%'`
+	rows, err := conn.Query(ctx, query, day(from), until)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", table, err)
+	}
+	defer rows.Close()
+	res := make(backtest.ST)
+	for rows.Next() {
+		var symbol, date, name string
+		if err := rows.Scan(&symbol, &date, &name); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", table, err)
+		}
+		if !backtest.IsST(name) {
+			continue
+		}
+		if res[symbol] == nil {
+			res[symbol] = make(map[string]bool)
+		}
+		res[symbol][date] = true
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/backtest"
+	"stock-backend/calendar"
+	"stock-backend/kline"
+	"stock-backend/optimize"
+	"stock-backend/screener"
+	"stock-backend/stocknames"
+	"stock-backend/strategy"
+	"stock-backend/strategyconf"
+	"stock-backend/universe"
+)
+
+// dimList collects repeated -param name=min:max:step flags.
+type dimList []optimize.Dim
+
+func (d *dimList) String() string {
+	return fmt.Sprint(*d)
+}
+
+func (d *dimList) Set(s string) error {
+	dim, err := optimize.ParseDim(s)
+	if err != nil {
+		return err
+	}
+	for _, have := range *d {
+		if have.Name == dim.Name {
+			return fmt.Errorf("param %s given twice", dim.Name)
+		}
+	}
+	*d = append(*d, dim)
+	return nil
+}
+
+// condList collects repeated -filter field<op>value flags.
+type condList []universe.Condition
+
+func (c *condList) String() string {
+	return fmt.Sprint(*c)
+}
+
+func (c *condList) Set(s string) error {
+	cond, err := universe.ParseCondition(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, cond)
+	return nil
+}
+
+func parseDay(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		log.Fatalf("Bad date %q: %v", s, err)
+	}
+	return t
+}
+
+func main() {
+	name := flag.String("strategy", "", "strategy family to tune: "+strings.Join(strategy.FactoryNames(), ", "))
+	file := flag.String("yaml", "", "YAML strategy file to tune instead of -strategy; its market, period and universe are used")
+	var dims dimList
+	flag.Var(&dims, "param", "param to vary as name=min:max:step, or name=value to fix it, repeatable")
+	random := flag.Int("random", 0, "try this many random grid points instead of the whole grid")
+	seed := flag.Int64("seed", 1, "seed for -random")
+	market := flag.String("market", "cn", "cn or us")
+	period := flag.String("period", string(kline.Day), "bar period: day, week or 15m")
+	from := flag.String("from", time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "first day to trade, YYYY-MM-DD")
+	to := flag.String("to", time.Now().Format("2006-01-02"), "stop before this day, YYYY-MM-DD")
+	screens := flag.String("screens", screener.DefaultDir, "directory holding the screen SQL files")
+	screen := flag.String("universe", "latest-symbols", "screen that returns the symbols to test with -strategy, run as of -from")
+	pit := flag.Bool("pit", false, "with -strategy, use each day's universe from -filter instead of the -universe screen's latest list")
+	var filters condList
+	flag.Var(&filters, "filter", "point-in-time universe condition on the daily row, e.g. market_capital>=1e10, repeatable")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	oos := flag.Float64("oos", 0.3, "fraction of the range held out of sample, 0 for none")
+	train := flag.Int("train", 0, "walk-forward training window in calendar days, 0 for a single split")
+	test := flag.Int("test", 60, "walk-forward test window in calendar days")
+	step := flag.Int("step", 0, "days between walk-forward windows, 0 for -test")
+	objective := flag.String("objective", "sharpe", "what to maximise: sharpe, sortino, cagr, return, calmar, profit_factor or expectancy")
+	workers := flag.Int("workers", runtime.NumCPU(), "backtests run at once")
+	cash := flag.Float64("cash", backtest.DefaultCash, "starting cash")
+	hold := flag.Int("hold", 1, "sell at the open this many bars after entry, 0 to hold until a sell signal or exit rule")
+	exitRules := flag.String("exit", "", "exit rules: stop:<pct>, target:<pct>, trail:<multiple>[:<period>], ma:<n>, gap[:<key>], time:<bars>, comma-separated, first hit wins; empty for none")
+	costs := flag.Bool("costs", true, "charge the market's fees and apply its lot, T+1 and price limit rules")
+	slippage := flag.String("slippage", "", "slippage model: fixed:<per share>, pct:<fraction> or volume:<impact>, empty for none")
+	top := flag.Int("top", 20, "show this many rows, 0 for all")
+	flag.Parse()
+
+	if len(dims) == 0 {
+		log.Fatal("No -param to vary")
+	}
+	obj, err := optimize.GetObjective(*objective)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slip, err := backtest.ParseSlippage(*slippage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var exit strategy.Exit
+	if *exitRules != "" {
+		exit, err = strategy.ParseExit(*exitRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	start, end := parseDay(*from), parseDay(*to)
+	var (
+		build    optimize.Builder
+		symbols  []string
+		pool     backtest.Universe
+		lookback int
+		p        = kline.Period(*period)
+	)
+	switch {
+	case *file != "":
+		conf, err := strategyconf.Load(*file)
+		if err != nil {
+			log.Fatalf("Failed to load strategy: %v", err)
+		}
+		*market, p, lookback = conf.Market, conf.Period, conf.Bars
+		build = func(params strategy.Params) (strategy.Strategy, error) {
+			c, err := conf.WithParams(params)
+			if err != nil {
+				return nil, err
+			}
+			return c.AsStrategy(), nil
+		}
+		// YAML 策略的股票池按每天当时的数据筛
+		h, err := conf.History(ctx, conn, start.UnixMilli(), end.UnixMilli())
+		if err != nil {
+			log.Fatalf("Failed to load universe: %v", err)
+		}
+		symbols, pool = h.Symbols(), h
+	case *name != "":
+		f, err := strategy.GetFactory(*name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		build = func(params strategy.Params) (strategy.Strategy, error) {
+			return strategy.Build(f.Name, params)
+		}
+		// 回看按参数网格里最长的窗口算
+		for _, params := range optimize.Grid(dims) {
+			s, err := build(params)
+			if err == nil && s.Lookback() > lookback {
+				lookback = s.Lookback()
+			}
+		}
+		if *pit {
+			h, err := universe.Load(ctx, conn, *market, filters, start.UnixMilli(), end.UnixMilli())
+			if err != nil {
+				log.Fatalf("Failed to load universe: %v", err)
+			}
+			symbols, pool = h.Symbols(), h
+			break
+		}
+		reg, err := screener.Open(*screens)
+		if err != nil {
+			log.Fatalf("Failed to load screens: %v", err)
+		}
+		// 股票池按开始那天之前的数据筛，不用后来才知道的名单
+		symbols, err = reg.Symbols(ctx, conn, *screen, screener.Args{"market": *market, "as_of": start.UnixMilli()})
+		if err != nil {
+			log.Fatalf("Failed to load universe: %v", err)
+		}
+	default:
+		log.Fatal("Need -strategy or -yaml")
+	}
+	if _, err := p.Table(*market); err != nil {
+		log.Fatal(err)
+	}
+	var cal *calendar.Market
+	if p.Duration() < 24*time.Hour {
+		// 日内K线按交易日归属，美股的交易时段跨了本地午夜
+		if cal, err = calendar.Get(*market); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var rules *backtest.Market
+	if *costs {
+		rules, err = backtest.MarketFor(*market)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// 留出策略回看需要的历史
+	warmup := p.Warmup(*market, lookback)
+	began := time.Now()
+	data, err := backtest.Load(ctx, kline.NewClickHouseSource(conn, *market), symbols, p, start.Add(-warmup).UnixMilli(), end.UnixMilli())
+	if err != nil {
+		log.Fatalf("Failed to load bars: %v", err)
+	}
+
+	// ST 股的涨跌停窄，按每天导入的股票名称认出来；没导入名称就都按普通股票算
+	var st backtest.ST
+	if rules != nil && rules.PriceLimits {
+		st, err = stocknames.LoadST(ctx, conn, *market, start.UnixMilli(), end.UnixMilli())
+		if err != nil {
+			fmt.Println("读取股票名称失败，ST 股按普通涨跌停算:", err)
+		}
+	}
+
+	points := optimize.Grid(dims)
+	if *random > 0 {
+		points = optimize.Random(dims, *random, *seed)
+	}
+	o := &optimize.Optimizer{
+		Data: data,
+		Base: backtest.Config{
+			Cash:     *cash,
+			HoldBars: *hold,
+			Exit:     exit,
+			Market:   rules,
+			ST:       st,
+			Slippage: slip,
+			Universe: pool,
+			Calendar: cal,
+		},
+		Build:     build,
+		Objective: obj,
+		Workers:   *workers,
+	}
+	fmt.Printf("%d 个标的, %d 组参数, 目标 %s\n", len(data), len(points), obj.Name)
+
+	if *train > 0 {
+		day := 24 * time.Hour
+		if *step == 0 {
+			*step = *test
+		}
+		folds, err := optimize.Folds(start.UnixMilli(), end.UnixMilli(), time.Duration(*train)*day, time.Duration(*test)*day, time.Duration(*step)*day)
+		if err != nil {
+			log.Fatal(err)
+		}
+		walk, err := o.WalkForward(points, folds)
+		if err != nil {
+			log.Fatalf("Failed to walk forward: %v", err)
+		}
+		if err := walk.WriteFolds(os.Stdout); err != nil {
+			log.Fatalf("Failed to write folds: %v", err)
+		}
+		fmt.Println()
+		if err := optimize.WriteTable(os.Stdout, walk.Rows, *top); err != nil {
+			log.Fatalf("Failed to write table: %v", err)
+		}
+	} else {
+		rows, err := o.Split(points, dims, start.UnixMilli(), end.UnixMilli(), *oos)
+		if err != nil {
+			log.Fatalf("Failed to run sweep: %v", err)
+		}
+		if err := optimize.WriteTable(os.Stdout, rows, *top); err != nil {
+			log.Fatalf("Failed to write table: %v", err)
+		}
+	}
+	fmt.Printf("耗时：%s\n", time.Since(began))
+}
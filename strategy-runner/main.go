@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/kline"
+	"stock-backend/strategyconf"
+)
+
+func main() {
+	dir := flag.String("dir", "./strategies", "directory holding the strategy YAML files")
+	name := flag.String("name", "", "only run the strategy with this name")
+	addr := flag.String("addr", "localhost:19000", "ClickHouse address")
+	list := flag.Bool("list", false, "list the strategies and exit")
+	flag.Parse()
+
+	strategies, err := strategyconf.LoadDir(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load strategies: %v", err)
+	}
+	if *list {
+		for _, s := range strategies {
+			fmt.Printf("%-24s %s %-4s %s\n", s.Name, s.Market, s.Period, s.Description)
+		}
+		return
+	}
+
+	// 配置ClickHouse连接参数
+	options := &clickhouse.Options{
+		Addr: []string{*addr},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	ran := 0
+	for _, s := range strategies {
+		if *name != "" && s.Name != *name {
+			continue
+		}
+		ran++
+		start := time.Now()
+		symbols, err := s.Symbols(ctx, conn, 0)
+		if err != nil {
+			log.Fatalf("Failed to load universe: %v", err)
+		}
+		src := kline.NewClickHouseSource(conn, s.Market)
+		fmt.Printf("==================== %s (%d symbols) ====================\n", s.Name, len(symbols))
+		hits := 0
+		for _, symbol := range symbols {
+			bars, err := src.Latest(ctx, symbol, s.Period, s.Bars)
+			if err != nil {
+				log.Fatalf("Failed to load bars: %v", err)
+			}
+			if len(bars) == 0 {
+				continue
+			}
+			last := len(bars) - 1
+			ok, values := s.Evaluate(bars, last)
+			if !ok {
+				continue
+			}
+			hits++
+			fmt.Printf("%s  %s  close %.2f  %s\n", symbol, bars[last].Time().Format("2006-01-02 15:04:05"), bars[last].Close, formatValues(values))
+		}
+		fmt.Printf("命中 %d, 耗时：%s\n", hits, time.Since(start))
+	}
+	if *name != "" && ran == 0 {
+		log.Fatalf("No strategy named %q in %s", *name, *dir)
+	}
+}
+
+func formatValues(values map[string]float64) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%.4f", k, values[k]))
+	}
+	return strings.Join(parts, " ")
+}
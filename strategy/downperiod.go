@@ -0,0 +1,151 @@
+package strategy
+
+import (
+	"fmt"
+
+	"stock-backend/downperiod"
+)
+
+// DownPeriodWindow is how many bars main.go fetches per symbol and runs the
+// down-period machine over.
+const DownPeriodWindow = 300
+
+// DownPeriodCross is main.go's 15-minute EMA rule: buy the close of the bar
+// the fast EMA crosses back over the slow one when the down period it ends
+// qualifies, and sell the close of the bar it crosses under again.
+//
+// main.go starts a fresh machine on the latest Window bars at every poll,
+// so the down line, counts and volume ratio depend on where the window
+// begins. Check replays the same window ending at bar i, which makes a
+// backtest see what the checker would have seen then. That costs Window
+// machine steps per bar, so a backtest over N bars does N*Window: about
+// 1.2 million steps for a year of 15m A-share bars at the default 300.
+// There is nothing to cache, every bar's window starts one bar later.
+type DownPeriodCross struct {
+	// Label is the strategy name, the one main.go records the hit under.
+	Label  string
+	Config downperiod.Config
+	// Window is the bars replayed, DownPeriodWindow when zero.
+	Window int
+	// The period must have spent more than MinTimes and fewer than MaxTimes
+	// bars under water, with a volume ratio above MinRatio and below
+	// MaxRatio; a zero bound is not checked.
+	MinTimes int
+	MaxTimes int
+	MinRatio float64
+	MaxRatio float64
+	// Setup buys only crosses that end a quiet period right after a long,
+	// heavy one, the "zzzz" marker.
+	Setup bool
+}
+
+func (s DownPeriodCross) Name() string { return s.Label }
+
+func (s DownPeriodCross) window() int {
+	if s.Window <= 0 {
+		return DownPeriodWindow
+	}
+	return s.Window
+}
+
+func (s DownPeriodCross) Lookback() int { return s.window() - 1 }
+
+func (s DownPeriodCross) qualifies(e downperiod.Event) bool {
+	p := e.Period
+	switch {
+	case s.Setup && !e.Setup:
+		return false
+	case s.MinTimes > 0 && !(p.Times > s.MinTimes):
+		return false
+	case s.MaxTimes > 0 && !(p.Times < s.MaxTimes):
+		return false
+	case s.MinRatio > 0 && !(p.VolRatio > s.MinRatio):
+		return false
+	case s.MaxRatio > 0 && !(p.VolRatio < s.MaxRatio):
+		return false
+	}
+	return true
+}
+
+func (s DownPeriodCross) Check(v View) (Signal, bool) {
+	bars, i := v.Known(), v.Index()
+	m := downperiod.New(s.Config)
+	var events []downperiod.Event
+	for _, b := range bars[max(0, i+1-s.window()) : i+1] {
+		events = m.Push(b)
+	}
+	cur := bars[i]
+	for _, e := range events {
+		switch e.Kind {
+		case downperiod.CrossUp:
+			if !s.qualifies(e) {
+				continue
+			}
+			p := e.Period
+			return Signal{
+				Direction: Buy,
+				Price:     cur.Close,
+				Values: map[string]float64{
+					"down_line": p.DownLine,
+					"times":     float64(p.Times),
+					"vol_ratio": p.VolRatio,
+					"update":    float64(p.Update),
+					"touch":     float64(p.Touch),
+					"climb":     float64(p.Climb),
+					"ma":        e.MA,
+				},
+			}, true
+		case downperiod.CrossDown:
+			return Signal{
+				Direction: Sell,
+				Price:     cur.Close,
+				Values: map[string]float64{
+					"up_line":   e.UpLine,
+					"up_times":  float64(e.UpTimes),
+					"vol_ratio": e.VolRatio,
+				},
+			}, true
+		}
+	}
+	return Signal{}, false
+}
+
+// The main.go hits, with its thresholds.
+var (
+	EMADownPeriod = DownPeriodCross{Label: "ema-down-period", Config: downperiod.DefaultConfig, MinTimes: 5, MaxTimes: 20, MinRatio: 1.1, MaxRatio: 1.5}
+	EMALongDown   = DownPeriodCross{Label: "ema-long-down", Config: downperiod.DefaultConfig, MinTimes: 30}
+	EMADownSetup  = DownPeriodCross{Label: "ema-down-setup", Config: downperiod.DefaultConfig, Setup: true}
+)
+
+func init() {
+	for _, s := range []DownPeriodCross{EMADownPeriod, EMALongDown, EMADownSetup} {
+		Register(s)
+		RegisterFactory(downPeriodFactory(s))
+	}
+}
+
+// downPeriodFactory tunes s's bounds, EMAs and window.
+func downPeriodFactory(s DownPeriodCross) Factory {
+	return Factory{
+		Name: s.Label,
+		Defaults: Params{
+			"fast": float64(s.Config.Fast), "slow": float64(s.Config.Slow), "window": DownPeriodWindow,
+			"min_times": float64(s.MinTimes), "max_times": float64(s.MaxTimes),
+			"min_ratio": s.MinRatio, "max_ratio": s.MaxRatio,
+		},
+		Build: func(p Params) (Strategy, error) {
+			b := s
+			b.Config = downperiod.Config{Fast: int(p["fast"]), Slow: int(p["slow"]), Warmup: int(p["slow"]) + 1}
+			b.Window = int(p["window"])
+			b.MinTimes, b.MaxTimes = int(p["min_times"]), int(p["max_times"])
+			b.MinRatio, b.MaxRatio = p["min_ratio"], p["max_ratio"]
+			if b.Config.Fast < 1 || b.Config.Slow <= b.Config.Fast {
+				return nil, fmt.Errorf("bad emas %d/%d", b.Config.Fast, b.Config.Slow)
+			}
+			if b.Window <= b.Config.Warmup {
+				return nil, fmt.Errorf("window %d too short for ema %d", b.Window, b.Config.Slow)
+			}
+			return b, nil
+		},
+	}
+}
@@ -0,0 +1,395 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"stock-backend/kline"
+)
+
+// Phase is when within a bar an exit fills. Of several exits on one bar
+// the earliest phase happened first.
+type Phase int
+
+const (
+	// AtOpen fills at the bar's open, for time exits and for levels the bar
+	// gapped through.
+	AtOpen Phase = iota
+	// Intrabar fills at a level the bar traded through.
+	Intrabar
+	// AtClose fills at the close, for rules judged on the close.
+	AtClose
+)
+
+func (p Phase) String() string {
+	switch p {
+	case AtOpen:
+		return "open"
+	case Intrabar:
+		return "intrabar"
+	case AtClose:
+		return "close"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// Position is an open position as the exit rules see it.
+type Position struct {
+	Symbol     string
+	EntryTime  int64
+	EntryPrice float64
+	// Values are the entry signal's values; GapExit reads its level there.
+	Values map[string]float64
+}
+
+// ExitSignal is an exit rule firing on one bar.
+type ExitSignal struct {
+	// Rule names the rule that fired, e.g. "stop"; it becomes the trade's
+	// exit reason.
+	Rule   string
+	Symbol string
+	Phase  Phase
+	Price  float64
+	// Index is the position of Bar in the slice that was checked.
+	Index int
+	Bar   kline.Bar
+	// Values holds what the decision was based on, such as the stop level.
+	Values map[string]float64
+}
+
+// Signal is the exit as a sell signal from strategy "exit-<rule>", for
+// the signals table and alerts.
+func (x ExitSignal) Signal() Signal {
+	return Signal{
+		Strategy:  "exit-" + x.Rule,
+		Symbol:    x.Symbol,
+		Direction: Sell,
+		Index:     x.Index,
+		Bar:       x.Bar,
+		Price:     x.Price,
+		Values:    x.Values,
+	}
+}
+
+// Exit decides whether to close a position on one bar. Like a Strategy's
+// Check, Check sees the View's current bar, possibly still forming in live
+// use, and nothing later; entry is the index of the bar the position was
+// opened on, always before the current one. Exits are stateless, so a
+// backtest walking forward and a monitor looking at the last bar agree.
+type Exit interface {
+	Name() string
+	// Lookback is how many bars before the current one Check needs.
+	Lookback() int
+	Check(p Position, v View, entry int) (ExitSignal, bool)
+}
+
+// ExitAt checks bar i of bars for p, filling in the signal's symbol and
+// bar. bars must hold the entry bar; it is false on the entry bar itself,
+// before it, or with too little history. Like At, it fails with
+// ErrLookahead when the rule asked for a bar after i.
+func ExitAt(x Exit, p Position, bars []kline.Bar, i int) (ExitSignal, bool, error) {
+	entry := sort.Search(len(bars), func(k int) bool { return bars[k].Timestamp >= p.EntryTime })
+	if entry >= len(bars) || bars[entry].Timestamp != p.EntryTime || i <= entry || i >= len(bars) || i < x.Lookback() {
+		return ExitSignal{}, false, nil
+	}
+	v := NewView(bars, i)
+	sig, ok := x.Check(p, v, entry)
+	if err := v.Err(); err != nil {
+		return ExitSignal{}, false, fmt.Errorf("exit %s on %s: %w", x.Name(), p.Symbol, err)
+	}
+	if !ok {
+		return ExitSignal{}, false, nil
+	}
+	sig.Symbol = p.Symbol
+	sig.Index = i
+	sig.Bar = bars[i]
+	return sig, true, nil
+}
+
+// downTo exits when bar trades down to level: at the open when it opened
+// there, else at the level.
+func downTo(bar kline.Bar, level float64) (Phase, float64, bool) {
+	switch {
+	case bar.Open <= level:
+		return AtOpen, bar.Open, true
+	case bar.Low <= level:
+		return Intrabar, level, true
+	}
+	return 0, 0, false
+}
+
+// upTo exits when bar trades up to level.
+func upTo(bar kline.Bar, level float64) (Phase, float64, bool) {
+	switch {
+	case bar.Open >= level:
+		return AtOpen, bar.Open, true
+	case bar.High >= level:
+		return Intrabar, level, true
+	}
+	return 0, 0, false
+}
+
+// StopLoss sells once the price falls Pct below the entry.
+type StopLoss struct {
+	Pct float64
+}
+
+func (s StopLoss) Name() string { return "stop" }
+
+func (s StopLoss) Lookback() int { return 0 }
+
+func (s StopLoss) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	level := p.EntryPrice * (1 - s.Pct)
+	phase, price, ok := downTo(bars[i], level)
+	if !ok {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: s.Name(), Phase: phase, Price: price, Values: map[string]float64{"stop": level}}, true
+}
+
+// TakeProfit sells once the price rises Pct above the entry.
+type TakeProfit struct {
+	Pct float64
+}
+
+func (t TakeProfit) Name() string { return "target" }
+
+func (t TakeProfit) Lookback() int { return 0 }
+
+func (t TakeProfit) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	level := p.EntryPrice * (1 + t.Pct)
+	phase, price, ok := upTo(bars[i], level)
+	if !ok {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: t.Name(), Phase: phase, Price: price, Values: map[string]float64{"target": level}}, true
+}
+
+// ATRTrail is a chandelier stop: Multiple ATRs of Period bars under the
+// highest high since entry, both taken as of the bar before the current
+// one.
+type ATRTrail struct {
+	Multiple float64
+	Period   int
+}
+
+func (t ATRTrail) Name() string { return "trail" }
+
+func (t ATRTrail) Lookback() int { return t.Period + 1 }
+
+func (t ATRTrail) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	atr := kline.ATR(bars[:i], t.Period)
+	if atr == 0 {
+		return ExitSignal{}, false
+	}
+	high := math.Inf(-1)
+	for _, b := range bars[entry:i] {
+		high = math.Max(high, b.High)
+	}
+	level := high - t.Multiple*atr
+	phase, price, ok := downTo(bars[i], level)
+	if !ok {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: t.Name(), Phase: phase, Price: price, Values: map[string]float64{"stop": level, "high": high, "atr": atr}}, true
+}
+
+// BelowMA sells when a bar closes under its MA-bar moving average.
+type BelowMA struct {
+	MA int
+}
+
+func (b BelowMA) Name() string { return "ma" }
+
+func (b BelowMA) Lookback() int { return b.MA - 1 }
+
+func (b BelowMA) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	ma := maAt(bars, i, b.MA)
+	if !(bars[i].Close < ma) {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: b.Name(), Phase: AtClose, Price: bars[i].Close, Values: map[string]float64{"ma": ma}}, true
+}
+
+// GapExit sells when a bar closes back under the gap the position was
+// bought on, the entry signal's Key value, "gap_open" when empty. It never
+// fires for an entry without that value.
+type GapExit struct {
+	Key string
+}
+
+func (g GapExit) Name() string { return "gap" }
+
+func (g GapExit) Lookback() int { return 0 }
+
+func (g GapExit) key() string {
+	if g.Key == "" {
+		return "gap_open"
+	}
+	return g.Key
+}
+
+func (g GapExit) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	level, ok := p.Values[g.key()]
+	if !ok || !(bars[i].Close < level) {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: g.Name(), Phase: AtClose, Price: bars[i].Close, Values: map[string]float64{"gap": level}}, true
+}
+
+// TimeExit sells at the open Bars bars after entry, what backtest's
+// HoldBars does.
+type TimeExit struct {
+	Bars int
+}
+
+func (t TimeExit) Name() string { return "time" }
+
+func (t TimeExit) Lookback() int { return 0 }
+
+func (t TimeExit) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	bars, i := v.Known(), v.Index()
+	if i-entry < t.Bars {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: t.Name(), Phase: AtOpen, Price: bars[i].Open}, true
+}
+
+// AnyExit combines rules, the first to be hit winning: the one with the
+// earliest phase, ties going to the rule listed first. Listing the stop
+// before the target makes a bar that touched both count as stopped out.
+type AnyExit []Exit
+
+func (a AnyExit) Name() string {
+	names := make([]string, len(a))
+	for i, x := range a {
+		names[i] = x.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (a AnyExit) Lookback() int {
+	n := 0
+	for _, x := range a {
+		n = max(n, x.Lookback())
+	}
+	return n
+}
+
+func (a AnyExit) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	var best ExitSignal
+	found := false
+	for _, x := range a {
+		if v.Index() < x.Lookback() {
+			continue
+		}
+		sig, ok := x.Check(p, v, entry)
+		if ok && (!found || sig.Phase < best.Phase) {
+			best, found = sig, true
+		}
+	}
+	return best, found
+}
+
+// ParseExit reads exit rules written as a comma-separated list, combined
+// with AnyExit when there are several: stop:<pct>, target:<pct>,
+// trail:<multiple>[:<period>], ma:<n>, gap[:<key>] and time:<bars>, e.g.
+// "stop:0.05,target:0.1,time:5".
+func ParseExit(s string) (Exit, error) {
+	var rules AnyExit
+	for _, part := range strings.Split(s, ",") {
+		x, err := parseRule(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("exit %q: %w", s, err)
+		}
+		rules = append(rules, x)
+	}
+	if len(rules) == 1 {
+		return rules[0], nil
+	}
+	return rules, nil
+}
+
+func parseRule(s string) (Exit, error) {
+	parts := strings.Split(s, ":")
+	if parts[0] == "gap" {
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("want gap[:<key>], got %q", s)
+		}
+		if len(parts) == 2 {
+			return GapExit{Key: parts[1]}, nil
+		}
+		return GapExit{}, nil
+	}
+	nums := make([]float64, len(parts)-1)
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = v
+	}
+	if len(nums) == 0 {
+		return nil, fmt.Errorf("want kind:value, got %q", s)
+	}
+	want := map[string]int{"stop": 1, "target": 1, "trail": 2, "ma": 1, "time": 1}[parts[0]]
+	if want == 0 {
+		return nil, fmt.Errorf("unknown exit rule %q", parts[0])
+	}
+	if len(nums) > want {
+		return nil, fmt.Errorf("%s takes at most %d values, got %q", parts[0], want, s)
+	}
+	// 比例要在 0 和 1 之间，窗口和根数要是正整数
+	pct := func(v float64) (float64, error) {
+		if !(v > 0 && v < 1) {
+			return 0, fmt.Errorf("%s: %v is not a fraction between 0 and 1", parts[0], v)
+		}
+		return v, nil
+	}
+	bars := func(v float64) (int, error) {
+		if v < 1 || v != math.Trunc(v) {
+			return 0, fmt.Errorf("%s: %v is not a positive whole number of bars", parts[0], v)
+		}
+		return int(v), nil
+	}
+	switch parts[0] {
+	case "stop", "target":
+		v, err := pct(nums[0])
+		if err != nil {
+			return nil, err
+		}
+		if parts[0] == "stop" {
+			return StopLoss{Pct: v}, nil
+		}
+		return TakeProfit{Pct: v}, nil
+	case "trail":
+		if !(nums[0] > 0) {
+			return nil, fmt.Errorf("trail: multiple %v must be positive", nums[0])
+		}
+		period := 14
+		if len(nums) > 1 {
+			n, err := bars(nums[1])
+			if err != nil {
+				return nil, err
+			}
+			period = n
+		}
+		return ATRTrail{Multiple: nums[0], Period: period}, nil
+	}
+	n, err := bars(nums[0])
+	if err != nil {
+		return nil, err
+	}
+	if parts[0] == "ma" {
+		return BelowMA{MA: n}, nil
+	}
+	return TimeExit{Bars: n}, nil
+}
@@ -0,0 +1,42 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExit(t *testing.T) {
+	good := []struct {
+		in   string
+		want Exit
+	}{
+		{"stop:0.05", StopLoss{Pct: 0.05}},
+		{"target:0.2", TakeProfit{Pct: 0.2}},
+		{"trail:2", ATRTrail{Multiple: 2, Period: 14}},
+		{"trail:2.5:10", ATRTrail{Multiple: 2.5, Period: 10}},
+		{"ma:20", BelowMA{MA: 20}},
+		{"time:5", TimeExit{Bars: 5}},
+		{"gap", GapExit{}},
+		{"stop:0.05, time:5", AnyExit{StopLoss{Pct: 0.05}, TimeExit{Bars: 5}}},
+	}
+	for _, tt := range good {
+		got, err := ParseExit(tt.in)
+		if err != nil {
+			t.Errorf("ParseExit(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseExit(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{
+		"ma:-3", "ma:0", "ma:2.5", "time:-1", "time:0",
+		"stop:-0.05", "stop:0", "stop:1.5", "target:0", "target:2",
+		"trail:0", "trail:-1", "trail:2:0", "trail:2:-5",
+		"stop:0.05:1", "trail:2:14:1", "stop", "stop:x", "exit:3",
+	} {
+		if _, err := ParseExit(in); err == nil {
+			t.Errorf("ParseExit(%q) accepted", in)
+		}
+	}
+}
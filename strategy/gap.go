@@ -0,0 +1,211 @@
+package strategy
+
+import (
+	"math"
+
+	"stock-backend/kline"
+	"stock-backend/volprofile"
+)
+
+// The gap-reclaim family. A gap bar is one that opens above the highs of
+// the five bars before it, the rule generate_cn_gaptable.py uses to fill
+// <market>_gap_records. Each variant looks for the latest gap between
+// MinDays and MaxDays calendar days before the current bar and then tests
+// the current bar against the gap's open.
+
+const gapHighs = 5
+
+const dayMillis = 24 * 3600 * 1000
+
+// GapWindow is how old, in calendar days, the gap may be.
+type GapWindow struct {
+	MinDays int
+	MaxDays int
+	// Highs is how many bars' highs the gap must open above, 5 when zero.
+	Highs int
+}
+
+func (w GapWindow) highs() int {
+	if w.Highs <= 0 {
+		return gapHighs
+	}
+	return w.Highs
+}
+
+// Find returns the index of the latest gap bar in the window before bar i.
+func (w GapWindow) Find(bars []kline.Bar, i int) (int, bool) {
+	for j := i - 1; j >= 0; j-- {
+		age := (bars[i].Timestamp - bars[j].Timestamp) / dayMillis
+		if age < int64(w.MinDays) {
+			continue
+		}
+		if age > int64(w.MaxDays) {
+			break
+		}
+		if isGap(bars, j, w.highs()) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// lookback is enough bars to reach MaxDays back, since there is at most one
+// bar per calendar day, plus the highs before the gap.
+func (w GapWindow) lookback() int {
+	return w.MaxDays + w.highs()
+}
+
+func isGap(bars []kline.Bar, j, n int) bool {
+	if j == 0 {
+		return false
+	}
+	high := math.Inf(-1)
+	for k := max(0, j-n); k < j; k++ {
+		high = math.Max(high, bars[k].High)
+	}
+	return bars[j].Open > high
+}
+
+// profileBars is how many bars before the current one the volume profile
+// of a gap signal covers.
+const profileBars = 60
+
+// addVolume records where a gap signal stands in the volume traded before
+// bar i: "zone" is the volprofile.Zone of the gap open, and "ahead" the
+// share of that volume between price and the window's high, the supply a
+// reclaim still has to trade through. Nothing is added when the bars carry
+// no volume.
+func addVolume(values map[string]float64, bars []kline.Bar, i int, gapOpen, price float64) {
+	p, err := volprofile.Build(bars[max(0, i-profileBars):i], volprofile.Options{Buckets: 50})
+	if err != nil {
+		return
+	}
+	values["zone"] = float64(p.Zone(gapOpen))
+	values["ahead"] = 0
+	if top := p.Low + float64(len(p.Volume))*p.Step; price < top {
+		values["ahead"] = p.Ahead(price, top)
+	}
+}
+
+// maAt is the simple moving average of the n closes ending at bar i.
+func maAt(bars []kline.Bar, i, n int) float64 {
+	if i+1 < n {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, b := range bars[i+1-n : i+1] {
+		sum += b.Close
+	}
+	return sum / float64(n)
+}
+
+// GapAboveMA is cn-daily-check's rule: with the previous close at or above
+// its MA, the current bar trades below the gap open and is back above it.
+type GapAboveMA struct {
+	GapWindow
+	MA int
+}
+
+func (s GapAboveMA) Name() string { return "gap-above-ma" }
+
+func (s GapAboveMA) Lookback() int { return max(s.lookback(), s.MA) }
+
+func (s GapAboveMA) Check(v View) (Signal, bool) {
+	bars, i := v.Known(), v.Index()
+	g, ok := s.Find(bars, i)
+	if !ok {
+		return Signal{}, false
+	}
+	prevMA := maAt(bars, i-1, s.MA)
+	if !(bars[i-1].Close >= prevMA) {
+		return Signal{}, false
+	}
+	cur, gap := bars[i], bars[g]
+	if !(cur.Low < gap.Open && cur.Close > gap.Open) {
+		return Signal{}, false
+	}
+	values := map[string]float64{
+		"gap_open": gap.Open,
+		"gap_ts":   float64(gap.Timestamp),
+		"ma":       maAt(bars, i, s.MA),
+		"prev_ma":  prevMA,
+	}
+	addVolume(values, bars, i, gap.Open, cur.Close)
+	return Signal{Direction: Buy, Price: cur.Close, Values: values}, true
+}
+
+// GapOpenReclaim is us-daily-check's rule: the current bar opens below the
+// gap open and is trading back above it.
+type GapOpenReclaim struct {
+	GapWindow
+}
+
+func (s GapOpenReclaim) Name() string { return "gap-open-reclaim" }
+
+func (s GapOpenReclaim) Lookback() int { return s.lookback() }
+
+func (s GapOpenReclaim) Check(v View) (Signal, bool) {
+	bars, i := v.Known(), v.Index()
+	g, ok := s.Find(bars, i)
+	if !ok {
+		return Signal{}, false
+	}
+	cur, gap := bars[i], bars[g]
+	if !(cur.Open < gap.Open && cur.Close > gap.Open) {
+		return Signal{}, false
+	}
+	values := map[string]float64{
+		"gap_open": gap.Open,
+		"gap_ts":   float64(gap.Timestamp),
+	}
+	addVolume(values, bars, i, gap.Open, cur.Close)
+	return Signal{Direction: Buy, Price: cur.Close, Values: values}, true
+}
+
+// GapPop is daily-pop-analysis's rule: the current bar's range spans its
+// MA and the gap open, with the MA below the gap (low < MA < gap open <
+// high). It buys at the gap open, or at the open if the bar opened above it.
+type GapPop struct {
+	GapWindow
+	MA int
+}
+
+func (s GapPop) Name() string { return "gap-pop" }
+
+func (s GapPop) Lookback() int { return max(s.lookback(), s.MA-1) }
+
+func (s GapPop) Check(v View) (Signal, bool) {
+	bars, i := v.Known(), v.Index()
+	g, ok := s.Find(bars, i)
+	if !ok {
+		return Signal{}, false
+	}
+	cur, gap := bars[i], bars[g]
+	ma := maAt(bars, i, s.MA)
+	if !(cur.Low < ma && gap.Open > ma && gap.Open < cur.High) {
+		return Signal{}, false
+	}
+	price := math.Max(cur.Open, gap.Open)
+	values := map[string]float64{
+		"gap_open":  gap.Open,
+		"gap_close": gap.Close,
+		"gap_ts":    float64(gap.Timestamp),
+		"ma":        ma,
+	}
+	addVolume(values, bars, i, gap.Open, price)
+	return Signal{Direction: Buy, Price: price, Values: values}, true
+}
+
+// The variants as the tools have always run them. cn-daily-check runs
+// GapAboveMA10 on both its A-share and its US pools.
+var (
+	GapAboveMA10 = GapAboveMA{GapWindow: GapWindow{MinDays: 5, MaxDays: 12}, MA: 10}
+	USGapReclaim = GapOpenReclaim{GapWindow: GapWindow{MinDays: 3, MaxDays: 10}}
+	DailyGapPop  = GapPop{GapWindow: GapWindow{MinDays: 5, MaxDays: 12}, MA: 10}
+)
+
+func init() {
+	Register(GapAboveMA10)
+	Register(USGapReclaim)
+	Register(DailyGapPop)
+}
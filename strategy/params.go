@@ -0,0 +1,145 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Params are a strategy's tunable numbers by name.
+type Params map[string]float64
+
+// String lists the params as name=value in name order.
+func (p Params) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%g", name, p[name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Factory builds a strategy family from params, so the optimizer can try
+// other windows than the ones the tools run with.
+type Factory struct {
+	Name string
+	// Defaults are the params of the registered strategy, and the full set
+	// Build accepts.
+	Defaults Params
+	Build    func(p Params) (Strategy, error)
+}
+
+var factories = make(map[string]Factory)
+
+// RegisterFactory makes f available to Build.
+func RegisterFactory(f Factory) {
+	if _, ok := factories[f.Name]; ok {
+		panic("strategy: duplicate factory " + f.Name)
+	}
+	factories[f.Name] = f
+}
+
+// GetFactory returns the factory called name.
+func GetFactory(name string) (Factory, error) {
+	f, ok := factories[name]
+	if !ok {
+		return Factory{}, fmt.Errorf("no factory for strategy %q", name)
+	}
+	return f, nil
+}
+
+// FactoryNames lists the strategies Build can make, sorted.
+func FactoryNames() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build makes the named strategy with p laid over its defaults.
+func Build(name string, p Params) (Strategy, error) {
+	f, err := GetFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(Params, len(f.Defaults))
+	for k, v := range f.Defaults {
+		merged[k] = v
+	}
+	for k, v := range p {
+		if _, ok := f.Defaults[k]; !ok {
+			return nil, fmt.Errorf("strategy %q has no param %q", name, k)
+		}
+		merged[k] = v
+	}
+	return f.Build(merged)
+}
+
+func gapWindow(p Params) (GapWindow, error) {
+	w := GapWindow{MinDays: int(p["min_days"]), MaxDays: int(p["max_days"]), Highs: int(p["highs"])}
+	if w.MinDays < 1 || w.MaxDays < w.MinDays {
+		return w, fmt.Errorf("bad gap window %d-%d days", w.MinDays, w.MaxDays)
+	}
+	if w.Highs < 1 {
+		return w, fmt.Errorf("bad gap highs %d", w.Highs)
+	}
+	return w, nil
+}
+
+func maParam(p Params) (int, error) {
+	n := int(p["ma"])
+	if n < 1 {
+		return 0, fmt.Errorf("bad ma %d", n)
+	}
+	return n, nil
+}
+
+func init() {
+	RegisterFactory(Factory{
+		Name:     GapAboveMA10.Name(),
+		Defaults: Params{"min_days": 5, "max_days": 12, "highs": 5, "ma": 10},
+		Build: func(p Params) (Strategy, error) {
+			w, err := gapWindow(p)
+			if err != nil {
+				return nil, err
+			}
+			ma, err := maParam(p)
+			if err != nil {
+				return nil, err
+			}
+			return GapAboveMA{GapWindow: w, MA: ma}, nil
+		},
+	})
+	RegisterFactory(Factory{
+		Name:     USGapReclaim.Name(),
+		Defaults: Params{"min_days": 3, "max_days": 10, "highs": 5},
+		Build: func(p Params) (Strategy, error) {
+			w, err := gapWindow(p)
+			if err != nil {
+				return nil, err
+			}
+			return GapOpenReclaim{GapWindow: w}, nil
+		},
+	})
+	RegisterFactory(Factory{
+		Name:     DailyGapPop.Name(),
+		Defaults: Params{"min_days": 5, "max_days": 12, "highs": 5, "ma": 10},
+		Build: func(p Params) (Strategy, error) {
+			w, err := gapWindow(p)
+			if err != nil {
+				return nil, err
+			}
+			ma, err := maParam(p)
+			if err != nil {
+				return nil, err
+			}
+			return GapPop{GapWindow: w, MA: ma}, nil
+		},
+	})
+}
@@ -0,0 +1,139 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+
+	"stock-backend/kline"
+)
+
+// Direction is which way a signal trades.
+type Direction int
+
+const (
+	Buy Direction = iota
+	Sell
+)
+
+func (d Direction) String() string {
+	if d == Sell {
+		return "sell"
+	}
+	return "buy"
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// ParseDirection is the inverse of Direction.String.
+func ParseDirection(s string) (Direction, error) {
+	switch s {
+	case "buy":
+		return Buy, nil
+	case "sell":
+		return Sell, nil
+	}
+	return Buy, fmt.Errorf("unknown direction %q", s)
+}
+
+// Signal is one strategy hit on one bar.
+type Signal struct {
+	Strategy  string
+	Symbol    string
+	Direction Direction
+	// Index is the position of Bar in the slice that was checked.
+	Index int
+	Bar   kline.Bar
+	// Price is where the strategy would trade: the live price for checkers,
+	// the fill for backtests.
+	Price float64
+	// Values holds what the decision was based on, for reports and alerts.
+	Values map[string]float64
+}
+
+// Strategy decides on one bar at a time. Check sees the View's current
+// bar, possibly still forming in live use, and the bars before it as
+// history; it gets nothing later, so a backtest walking forward and a
+// checker looking at the last bar get the same answers.
+type Strategy interface {
+	Name() string
+	// Lookback is how many bars before the current one Check needs.
+	Lookback() int
+	Check(v View) (Signal, bool)
+}
+
+// Latest checks the last bar, the way the live checkers use a strategy.
+// There is nothing after the last bar, so a rule asking for more only
+// gets no signal.
+func Latest(s Strategy, symbol string, bars []kline.Bar) (Signal, bool) {
+	sig, ok, err := At(s, symbol, bars, len(bars)-1)
+	return sig, ok && err == nil
+}
+
+// Scan checks every bar with enough history, the way a backtest does.
+func Scan(s Strategy, symbol string, bars []kline.Bar) ([]Signal, error) {
+	var res []Signal
+	for i := s.Lookback(); i < len(bars); i++ {
+		sig, ok, err := At(s, symbol, bars, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, sig)
+		}
+	}
+	return res, nil
+}
+
+// At checks bar i, filling in the signal's strategy, symbol and bar. It is
+// false when i is out of range or has too little history, and fails with
+// ErrLookahead when the strategy asked its View for a bar after i.
+func At(s Strategy, symbol string, bars []kline.Bar, i int) (Signal, bool, error) {
+	if i < s.Lookback() || i >= len(bars) {
+		return Signal{}, false, nil
+	}
+	v := NewView(bars, i)
+	sig, ok := s.Check(v)
+	if err := v.Err(); err != nil {
+		return Signal{}, false, fmt.Errorf("%s on %s: %w", s.Name(), symbol, err)
+	}
+	if !ok {
+		return Signal{}, false, nil
+	}
+	sig.Strategy = s.Name()
+	sig.Symbol = symbol
+	sig.Index = i
+	sig.Bar = bars[i]
+	return sig, true, nil
+}
+
+var registry = make(map[string]Strategy)
+
+// Register makes s available to Get. It panics on a duplicate name, which
+// can only be a programming error.
+func Register(s Strategy) {
+	if _, ok := registry[s.Name()]; ok {
+		panic("strategy: duplicate name " + s.Name())
+	}
+	registry[s.Name()] = s
+}
+
+// Get returns the registered strategy called name.
+func Get(name string) (Strategy, error) {
+	s, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	return s, nil
+}
+
+// Names lists the registered strategies.
+func Names() []string {
+	res := make([]string, 0, len(registry))
+	for name := range registry {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
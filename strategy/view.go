@@ -0,0 +1,65 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-backend/kline"
+)
+
+// ErrLookahead is what View.Bars returns when a rule asks for bars after
+// the one it is deciding on. At and ExitAt pass it on, and backtests fail
+// with it instead of trading on the future.
+var ErrLookahead = errors.New("lookahead")
+
+// View is a symbol's bars as known on the bar being decided, the current
+// one. It is all a Strategy or Exit gets to see: the slice behind it may
+// run on past the current bar, as a backtest's does, but Bars never hands
+// out more than was known then.
+type View struct {
+	bars []kline.Bar
+	i    int
+	// err keeps the first refused read, so At reports it even when the
+	// rule drops the error.
+	err *error
+}
+
+// NewView is bars as known on bar i.
+func NewView(bars []kline.Bar, i int) View {
+	return View{bars: bars, i: i, err: new(error)}
+}
+
+// Index is the position of the current bar.
+func (v View) Index() int { return v.i }
+
+// Bar is the current bar.
+func (v View) Bar() kline.Bar { return v.bars[v.i] }
+
+// Bars returns the bars up to and including index asOf, cut off there with
+// the capacity as well. An asOf after the current bar is ErrLookahead.
+func (v View) Bars(asOf int) ([]kline.Bar, error) {
+	if asOf > v.i {
+		err := fmt.Errorf("%w: asked for bar %d on bar %d at %s", ErrLookahead, asOf, v.i,
+			time.UnixMilli(v.bars[v.i].Timestamp).Format("2006-01-02 15:04"))
+		if v.err != nil && *v.err == nil {
+			*v.err = err
+		}
+		return nil, err
+	}
+	n := max(asOf+1, 0)
+	return v.bars[:n:n], nil
+}
+
+// Known is every bar up to the current one, Bars(Index()).
+func (v View) Known() []kline.Bar {
+	return v.bars[: v.i+1 : v.i+1]
+}
+
+// Err is the first read Bars refused, nil if there was none.
+func (v View) Err() error {
+	if v.err == nil {
+		return nil
+	}
+	return *v.err
+}
@@ -0,0 +1,175 @@
+package strategy
+
+import (
+	"errors"
+	"testing"
+
+	"stock-backend/kline"
+)
+
+func testBars(n int) []kline.Bar {
+	bars := make([]kline.Bar, n)
+	for i := range bars {
+		p := 10 + float64(i)
+		bars[i] = kline.Bar{Timestamp: int64(i+1) * dayMillis, Open: p, High: p + 1, Low: p - 1, Close: p, Volume: 1000}
+	}
+	return bars
+}
+
+func TestViewBars(t *testing.T) {
+	bars := testBars(10)
+	tests := []struct {
+		name    string
+		asOf    int
+		want    int
+		wantErr bool
+	}{
+		{"history", 3, 4, false},
+		{"current bar", 5, 6, false},
+		{"before the first bar", -1, 0, false},
+		{"next bar", 6, 0, true},
+		{"last bar", 9, 0, true},
+		{"past the data", 20, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewView(bars, 5)
+			got, err := v.Bars(tt.asOf)
+			if tt.wantErr {
+				if !errors.Is(err, ErrLookahead) {
+					t.Fatalf("Bars(%d) error = %v, want ErrLookahead", tt.asOf, err)
+				}
+				if !errors.Is(v.Err(), ErrLookahead) {
+					t.Errorf("Err() = %v, want ErrLookahead", v.Err())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bars(%d) error = %v", tt.asOf, err)
+			}
+			if len(got) != tt.want || cap(got) != tt.want {
+				t.Errorf("Bars(%d) len %d cap %d, want %d", tt.asOf, len(got), cap(got), tt.want)
+			}
+			if v.Err() != nil {
+				t.Errorf("Err() = %v after an allowed read", v.Err())
+			}
+		})
+	}
+}
+
+func TestViewKnown(t *testing.T) {
+	bars := testBars(10)
+	v := NewView(bars, 4)
+	known := v.Known()
+	if len(known) != 5 || cap(known) != 5 {
+		t.Fatalf("Known() len %d cap %d, want 5", len(known), cap(known))
+	}
+	if v.Bar() != bars[4] || v.Index() != 4 {
+		t.Errorf("current bar = %d %+v, want 4 %+v", v.Index(), v.Bar(), bars[4])
+	}
+	if err := (View{}).Err(); err != nil {
+		t.Errorf("zero View Err() = %v", err)
+	}
+}
+
+// peek reads the bar after the current one through the View.
+type peek struct {
+	// dropErr ignores the error Bars returns.
+	dropErr bool
+}
+
+func (peek) Name() string  { return "peek" }
+func (peek) Lookback() int { return 0 }
+
+func (p peek) Check(v View) (Signal, bool) {
+	next, err := v.Bars(v.Index() + 1)
+	if err != nil && !p.dropErr {
+		return Signal{}, false
+	}
+	if len(next) == 0 {
+		return Signal{}, false
+	}
+	return Signal{Direction: Buy, Price: next[len(next)-1].Close}, true
+}
+
+// lastClose buys every bar at its close, reading only the current bar.
+type lastClose struct{}
+
+func (lastClose) Name() string  { return "last-close" }
+func (lastClose) Lookback() int { return 1 }
+
+func (lastClose) Check(v View) (Signal, bool) {
+	return Signal{Direction: Buy, Price: v.Bar().Close}, true
+}
+
+func TestAtLookahead(t *testing.T) {
+	bars := testBars(10)
+	tests := []struct {
+		name    string
+		s       Strategy
+		i       int
+		wantOK  bool
+		wantErr bool
+	}{
+		{"honest", lastClose{}, 5, true, false},
+		{"too little history", lastClose{}, 0, false, false},
+		{"out of range", lastClose{}, 10, false, false},
+		{"peek", peek{}, 5, false, true},
+		{"peek dropping the error", peek{dropErr: true}, 5, false, true},
+		{"peek on the last bar", peek{}, 9, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, ok, err := At(tt.s, "SH600000", bars, tt.i)
+			if got := errors.Is(err, ErrLookahead); got != tt.wantErr {
+				t.Fatalf("At error = %v, want lookahead %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("At ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (sig.Symbol != "SH600000" || sig.Index != tt.i || sig.Bar != bars[tt.i]) {
+				t.Errorf("At filled in %+v", sig)
+			}
+		})
+	}
+}
+
+func TestScanStopsOnLookahead(t *testing.T) {
+	bars := testBars(10)
+	if _, err := Scan(peek{}, "SH600000", bars); !errors.Is(err, ErrLookahead) {
+		t.Errorf("Scan(peek) error = %v, want ErrLookahead", err)
+	}
+	sigs, err := Scan(lastClose{}, "SH600000", bars)
+	if err != nil || len(sigs) != 9 {
+		t.Errorf("Scan(lastClose) = %d signals, %v; want 9", len(sigs), err)
+	}
+	if _, ok := Latest(peek{dropErr: true}, "SH600000", bars); ok {
+		t.Error("Latest(peek) signalled on a refused read")
+	}
+}
+
+// peekExit sells at the next bar's close.
+type peekExit struct{}
+
+func (peekExit) Name() string  { return "peek" }
+func (peekExit) Lookback() int { return 0 }
+
+func (peekExit) Check(p Position, v View, entry int) (ExitSignal, bool) {
+	next, err := v.Bars(v.Index() + 1)
+	if err != nil {
+		return ExitSignal{}, false
+	}
+	return ExitSignal{Rule: "peek", Phase: AtClose, Price: next[len(next)-1].Close}, true
+}
+
+func TestExitAtLookahead(t *testing.T) {
+	bars := testBars(10)
+	pos := Position{Symbol: "SH600000", EntryTime: bars[2].Timestamp, EntryPrice: bars[2].Close}
+	if _, _, err := ExitAt(peekExit{}, pos, bars, 5); !errors.Is(err, ErrLookahead) {
+		t.Errorf("ExitAt(peek) error = %v, want ErrLookahead", err)
+	}
+	x, ok, err := ExitAt(StopLoss{Pct: 0.5}, pos, bars, 5)
+	if err != nil || ok {
+		t.Errorf("ExitAt(stop) = %+v, %v, %v; want no exit", x, ok, err)
+	}
+}
@@ -0,0 +1,315 @@
+package strategyconf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"stock-backend/kline"
+	"stock-backend/universe"
+)
+
+// Strategy is one screen or strategy as written in a YAML file under
+// strategies/. Thresholds live in Params and are referenced as $name from
+// the universe filters and signal conditions, so tuning a screen is an edit
+// to the file rather than a rebuild.
+type Strategy struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Market      string       `yaml:"market"`
+	Period      kline.Period `yaml:"period"`
+	// Bars is how many bars per symbol the runner loads; it must cover the
+	// longest lookback any condition uses.
+	Bars     int                `yaml:"bars"`
+	Params   map[string]float64 `yaml:"params"`
+	Universe []Filter           `yaml:"universe"`
+	Signal   []Condition        `yaml:"signal"`
+
+	File string `yaml:"-"`
+}
+
+// Filter narrows the universe using the latest <market>_stock_daily row.
+type Filter struct {
+	Field string `yaml:"field"`
+	Op    string `yaml:"op"`
+	Value Value  `yaml:"value"`
+}
+
+// Condition is one test on the latest bar, e.g.
+//
+//	left: close
+//	op: ">"
+//	right: max_high(80)[3]
+//	scale: 0.8
+//
+// Either Right (a metric) or Value (a number or $param) is the right hand
+// side. Scale, a number or $param, multiplies it and defaults to 1.
+//
+// crosses_above and crosses_below hold only on the bar the left side
+// crosses the right one: below (above) it on the previous bar and above
+// (below) it on this one, the way main.go spots an EMA5/EMA20 cross.
+type Condition struct {
+	Left  string `yaml:"left"`
+	Op    string `yaml:"op"`
+	Right string `yaml:"right"`
+	Value Value  `yaml:"value"`
+	Scale Value  `yaml:"scale"`
+
+	left   operand
+	right  *operand
+	values []float64
+	scale  float64
+}
+
+// Value is a number, a $param reference, or a [low, high] pair for the
+// between operator. between is exclusive on both ends, matching checks like
+// downtimes > 5 && downtimes < 20.
+type Value struct {
+	raw []string
+}
+
+func (v *Value) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		v.raw = []string{node.Value}
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: value list must hold scalars", n.Line)
+			}
+			v.raw = append(v.raw, n.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported value", node.Line)
+	}
+	return nil
+}
+
+// IsSet reports whether the value was given in the file.
+func (v Value) IsSet() bool {
+	return len(v.raw) > 0
+}
+
+// Resolve turns the value into numbers, looking $names up in params.
+func (v Value) Resolve(params map[string]float64) ([]float64, error) {
+	res := make([]float64, 0, len(v.raw))
+	for _, s := range v.raw {
+		f, err := resolveNumber(s, params)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+func resolveNumber(s string, params map[string]float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "$") {
+		f, ok := params[s[1:]]
+		if !ok {
+			return 0, fmt.Errorf("unknown param %s", s)
+		}
+		return f, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+var ops = map[string]bool{
+	"<": true, "<=": true, ">": true, ">=": true, "==": true, "!=": true, "between": true,
+	"crosses_above": true, "crosses_below": true,
+}
+
+// Load reads and checks one strategy file.
+func Load(path string) (*Strategy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Strategy
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.File = path
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// LoadDir loads every .yaml/.yml file in dir, sorted by strategy name.
+func LoadDir(dir string) ([]*Strategy, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Strategy
+	names := make(map[string]string)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		s, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := names[s.Name]; ok {
+			return nil, fmt.Errorf("strategy %q defined in both %s and %s", s.Name, prev, s.File)
+		}
+		names[s.Name] = s.File
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (s *Strategy) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Market != "cn" && s.Market != "us" {
+		return fmt.Errorf("market must be cn or us, got %q", s.Market)
+	}
+	if s.Period == "" {
+		s.Period = kline.Day
+	}
+	if _, err := s.Period.Table(s.Market); err != nil {
+		return err
+	}
+	if s.Bars <= 0 {
+		s.Bars = 60
+	}
+	for i, f := range s.Universe {
+		if _, ok := universe.Fields[f.Field]; !ok {
+			return fmt.Errorf("universe[%d]: unknown field %q", i, f.Field)
+		}
+		if strings.HasPrefix(f.Op, "crosses_") {
+			return fmt.Errorf("universe[%d]: %s only works in signal conditions", i, f.Op)
+		}
+		if err := checkOp(f.Op, f.Value, s.Params); err != nil {
+			return fmt.Errorf("universe[%d]: %w", i, err)
+		}
+	}
+	if len(s.Signal) == 0 {
+		return fmt.Errorf("signal needs at least one condition")
+	}
+	for i := range s.Signal {
+		c := &s.Signal[i]
+		c.scale = 1
+		if c.Scale.IsSet() {
+			scale, err := c.Scale.Resolve(s.Params)
+			if err != nil {
+				return fmt.Errorf("signal[%d] scale: %w", i, err)
+			}
+			if len(scale) != 1 {
+				return fmt.Errorf("signal[%d]: scale must be a single value", i)
+			}
+			c.scale = scale[0]
+		}
+		left, err := parseOperand(c.Left, s.Params)
+		if err != nil {
+			return fmt.Errorf("signal[%d] left: %w", i, err)
+		}
+		c.left = left
+		if c.Right != "" {
+			if c.Value.IsSet() || c.Op == "between" {
+				return fmt.Errorf("signal[%d]: use either right or value", i)
+			}
+			right, err := parseOperand(c.Right, s.Params)
+			if err != nil {
+				return fmt.Errorf("signal[%d] right: %w", i, err)
+			}
+			if !ops[c.Op] {
+				return fmt.Errorf("signal[%d]: unknown op %q", i, c.Op)
+			}
+			c.right = &right
+			continue
+		}
+		if err := checkOp(c.Op, c.Value, s.Params); err != nil {
+			return fmt.Errorf("signal[%d]: %w", i, err)
+		}
+		c.values, _ = c.Value.Resolve(s.Params)
+	}
+	return nil
+}
+
+// Evaluate checks every signal condition on bar i. values holds each
+// condition's left hand side keyed by its text, for reporting.
+func (s *Strategy) Evaluate(bars []kline.Bar, i int) (ok bool, values map[string]float64) {
+	return s.evaluate(newSeries(bars), i)
+}
+
+func (s *Strategy) evaluate(ser *series, i int) (ok bool, values map[string]float64) {
+	values = make(map[string]float64, len(s.Signal))
+	ok = true
+	for _, c := range s.Signal {
+		left := ser.value(c.left, i)
+		values[c.Left] = left
+		right := rightSide(ser, c, i)
+		switch c.Op {
+		case "crosses_above":
+			ok = ok && compare("<", ser.value(c.left, i-1), rightSide(ser, c, i-1)) && left > right[0]
+		case "crosses_below":
+			ok = ok && compare(">", ser.value(c.left, i-1), rightSide(ser, c, i-1)) && left < right[0]
+		default:
+			ok = ok && compare(c.Op, left, right)
+		}
+	}
+	return ok, values
+}
+
+// rightSide is c's right hand side at bar i, scaled.
+func rightSide(ser *series, c Condition, i int) []float64 {
+	if c.right != nil {
+		return []float64{ser.value(*c.right, i) * c.scale}
+	}
+	res := make([]float64, len(c.values))
+	for k, v := range c.values {
+		res[k] = v * c.scale
+	}
+	return res
+}
+
+func checkOp(op string, v Value, params map[string]float64) error {
+	if !ops[op] {
+		return fmt.Errorf("unknown op %q", op)
+	}
+	vals, err := v.Resolve(params)
+	if err != nil {
+		return err
+	}
+	want := 1
+	if op == "between" {
+		want = 2
+	}
+	if len(vals) != want {
+		return fmt.Errorf("op %q needs %d value(s), got %d", op, want, len(vals))
+	}
+	return nil
+}
+
+func compare(op string, left float64, right []float64) bool {
+	switch op {
+	case "<":
+		return left < right[0]
+	case "<=":
+		return left <= right[0]
+	case ">":
+		return left > right[0]
+	case ">=":
+		return left >= right[0]
+	case "==":
+		return left == right[0]
+	case "!=":
+		return left != right[0]
+	case "between":
+		return left > right[0] && left < right[1]
+	}
+	return false
+}
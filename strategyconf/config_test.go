@@ -0,0 +1,95 @@
+package strategyconf
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"stock-backend/kline"
+	"stock-backend/strategy"
+)
+
+// walk is a seeded random walk with trending stretches, so the EMAs cross
+// every few dozen bars.
+func walk(seed int64, n int) []kline.Bar {
+	r := rand.New(rand.NewSource(seed))
+	bars := make([]kline.Bar, n)
+	price, drift := 10.0, 0.0
+	for i := range bars {
+		if i%15 == 0 {
+			drift = (r.Float64() - 0.5) * 0.02
+		}
+		open := price
+		price *= 1 + drift + (r.Float64()-0.5)*0.03
+		bars[i] = kline.Bar{
+			Timestamp: int64(i+1) * 15 * 60000,
+			Open:      open,
+			High:      math.Max(open, price) * 1.005,
+			Low:       math.Min(open, price) * 0.995,
+			Close:     price,
+			Volume:    float64(1000 + r.Intn(9000)),
+		}
+	}
+	return bars
+}
+
+func TestCrossOps(t *testing.T) {
+	s := &Strategy{Name: "cross", Market: "cn", Signal: []Condition{{Left: "close", Op: "crosses_above", Value: Value{raw: []string{"10"}}}}}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	below := &Strategy{Name: "cross", Market: "cn", Signal: []Condition{{Left: "close", Op: "crosses_below", Right: "open"}}}
+	if err := below.validate(); err != nil {
+		t.Fatal(err)
+	}
+	closes := []float64{9, 10, 11, 12, 9.5, 10.5}
+	bars := make([]kline.Bar, len(closes))
+	for i, c := range closes {
+		bars[i] = kline.Bar{Open: 10, Close: c}
+	}
+	// 10 不算越过：要前一根在下方、这一根在上方
+	for i, want := range []bool{false, false, false, false, false, true} {
+		if got, _ := s.Evaluate(bars, i); got != want {
+			t.Errorf("crosses_above 10 at %d = %v, want %v", i, got, want)
+		}
+	}
+	for i, want := range []bool{false, false, false, false, true, false} {
+		if got, _ := below.Evaluate(bars, i); got != want {
+			t.Errorf("crosses_below open at %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+// TestEMADownPeriodFile checks the YAML strategy buys on exactly the bars
+// the Go ema-down-period strategy does.
+func TestEMADownPeriodFile(t *testing.T) {
+	conf, err := Load("../strategies/us-ema-down-period.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yaml := conf.AsStrategy()
+	buys := 0
+	for seed := int64(1); seed <= 10; seed++ {
+		bars := walk(seed, 600)
+		for i := range bars {
+			want, ok, err := strategy.At(strategy.EMADownPeriod, "AAPL", bars, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantBuy := ok && want.Direction == strategy.Buy
+			_, got, err := strategy.At(yaml, "AAPL", bars, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != wantBuy {
+				t.Errorf("seed %d bar %d: yaml signal %v, go buy %v", seed, i, got, wantBuy)
+			}
+			if wantBuy {
+				buys++
+			}
+		}
+	}
+	if buys < 5 {
+		t.Errorf("only %d buys to compare", buys)
+	}
+}
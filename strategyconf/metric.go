@@ -0,0 +1,222 @@
+package strategyconf
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"stock-backend/downperiod"
+	"stock-backend/indicator"
+	"stock-backend/kline"
+)
+
+// operand is a metric reference such as close, ma(10), or max_high(5)[1],
+// where the bracket looks that many bars back. Arguments and the offset may
+// be $params.
+type operand struct {
+	name   string
+	args   []int
+	offset int
+	num    float64
+	isNum  bool
+}
+
+var operandRe = regexp.MustCompile(`^([a-z_]+)(?:\(([^)]*)\))?(?:\[([^\]]+)\])?$`)
+
+// metricArgs is the number of arguments each metric takes.
+var metricArgs = map[string]int{
+	"open":           0,
+	"high":           0,
+	"low":            0,
+	"close":          0,
+	"volume":         0,
+	"amount":         0,
+	"turnoverrate":   0,
+	"turnover":       0, // open * volume, the way main.go filters liquidity
+	"change":         0, // close against the previous close
+	"ma":             1,
+	"ema":            1,
+	"max_high":       1, // highest high of the n bars before this one
+	"min_low":        1,
+	"vol_ratio":      1, // volume against the average of the n bars before
+	"gap_open":       2, // open of the latest gap bar between a and b bars ago
+	"down_times":     0, // bars under water in the last finished EMA5/EMA20 down period
+	"down_vol_ratio": 0,
+}
+
+func parseOperand(s string, params map[string]float64) (operand, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return operand{}, fmt.Errorf("empty operand")
+	}
+	if f, err := resolveNumber(s, params); err == nil {
+		return operand{num: f, isNum: true}, nil
+	}
+	m := operandRe.FindStringSubmatch(s)
+	if m == nil {
+		return operand{}, fmt.Errorf("cannot parse %q", s)
+	}
+	o := operand{name: m[1]}
+	want, ok := metricArgs[o.name]
+	if !ok {
+		return operand{}, fmt.Errorf("unknown metric %q", o.name)
+	}
+	if m[2] != "" {
+		for _, a := range strings.Split(m[2], ",") {
+			f, err := resolveNumber(a, params)
+			if err != nil {
+				return operand{}, fmt.Errorf("%s: %w", s, err)
+			}
+			o.args = append(o.args, int(f))
+		}
+	}
+	if len(o.args) != want {
+		return operand{}, fmt.Errorf("%s takes %d argument(s)", o.name, want)
+	}
+	if m[3] != "" {
+		f, err := resolveNumber(m[3], params)
+		if err != nil || f < 0 {
+			return operand{}, fmt.Errorf("%s: bad offset %q", s, m[3])
+		}
+		o.offset = int(f)
+	}
+	return o, nil
+}
+
+// series evaluates metrics over one symbol's bars, caching the derived
+// series so several conditions can share them.
+type series struct {
+	bars  []kline.Bar
+	cache map[string][]float64
+	down  []*downperiod.DownPeriod
+}
+
+func newSeries(bars []kline.Bar) *series {
+	return &series{bars: bars, cache: make(map[string][]float64)}
+}
+
+// value is the operand at bar i, NaN when there is not enough history.
+func (s *series) value(o operand, i int) float64 {
+	if o.isNum {
+		return o.num
+	}
+	i -= o.offset
+	if i < 0 || i >= len(s.bars) {
+		return math.NaN()
+	}
+	b := s.bars[i]
+	switch o.name {
+	case "open":
+		return b.Open
+	case "high":
+		return b.High
+	case "low":
+		return b.Low
+	case "close":
+		return b.Close
+	case "volume":
+		return b.Volume
+	case "amount":
+		return b.Amount
+	case "turnoverrate":
+		return b.TurnoverRate
+	case "turnover":
+		return b.Open * b.Volume
+	case "change":
+		if i == 0 || s.bars[i-1].Close == 0 {
+			return math.NaN()
+		}
+		return (b.Close - s.bars[i-1].Close) / s.bars[i-1].Close
+	case "ma":
+		return s.cached(fmt.Sprintf("ma%d", o.args[0]), func() []float64 {
+			return indicator.MA(kline.Closes(s.bars), o.args[0])
+		})[i]
+	case "ema":
+		return s.cached(fmt.Sprintf("ema%d", o.args[0]), func() []float64 {
+			return indicator.EMA(kline.Closes(s.bars), o.args[0])
+		})[i]
+	case "max_high":
+		return s.maxHigh(i, o.args[0])
+	case "min_low":
+		n := o.args[0]
+		if i < n {
+			return math.NaN()
+		}
+		low := math.Inf(1)
+		for j := i - n; j < i; j++ {
+			low = math.Min(low, s.bars[j].Low)
+		}
+		return low
+	case "vol_ratio":
+		n := o.args[0]
+		if i < n {
+			return math.NaN()
+		}
+		sum := 0.0
+		for j := i - n; j < i; j++ {
+			sum += s.bars[j].Volume
+		}
+		if sum == 0 {
+			return math.NaN()
+		}
+		return b.Volume / (sum / float64(n))
+	case "gap_open":
+		// 与 generate_cn_gaptable.py 一致：开盘价高于前 5 根最高价即为缺口
+		from, to := o.args[0], o.args[1]
+		for j := i - from; j >= i-to && j >= 5; j-- {
+			if s.bars[j].Open > s.maxHigh(j, 5) {
+				return s.bars[j].Open
+			}
+		}
+		return math.NaN()
+	case "down_times", "down_vol_ratio":
+		p := s.downPeriod(i)
+		if p == nil {
+			return math.NaN()
+		}
+		if o.name == "down_times" {
+			return float64(p.Times)
+		}
+		return p.VolRatio
+	}
+	return math.NaN()
+}
+
+func (s *series) maxHigh(i, n int) float64 {
+	if i < n {
+		return math.NaN()
+	}
+	high := math.Inf(-1)
+	for j := i - n; j < i; j++ {
+		high = math.Max(high, s.bars[j].High)
+	}
+	return high
+}
+
+func (s *series) cached(key string, calc func() []float64) []float64 {
+	v, ok := s.cache[key]
+	if !ok {
+		v = calc()
+		s.cache[key] = v
+	}
+	return v
+}
+
+// downPeriod is the last down period finished at or before bar i.
+func (s *series) downPeriod(i int) *downperiod.DownPeriod {
+	if s.down == nil {
+		s.down = make([]*downperiod.DownPeriod, len(s.bars))
+		m := downperiod.New(downperiod.DefaultConfig)
+		var last *downperiod.DownPeriod
+		for j, b := range s.bars {
+			for _, e := range m.Push(b) {
+				if e.Kind == downperiod.CrossUp {
+					last = e.Period
+				}
+			}
+			s.down[j] = last
+		}
+	}
+	return s.down[i]
+}
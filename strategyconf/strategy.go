@@ -0,0 +1,54 @@
+package strategyconf
+
+import (
+	"fmt"
+
+	"stock-backend/strategy"
+)
+
+// WithParams returns a copy of s with p laid over its params, checked the
+// same way a loaded file is. The optimizer uses it to try other values.
+func (s *Strategy) WithParams(p map[string]float64) (*Strategy, error) {
+	c := *s
+	c.Params = make(map[string]float64, len(s.Params))
+	for k, v := range s.Params {
+		c.Params[k] = v
+	}
+	for k, v := range p {
+		if _, ok := s.Params[k]; !ok {
+			return nil, fmt.Errorf("%s: no param %q", s.Name, k)
+		}
+		c.Params[k] = v
+	}
+	c.Signal = append([]Condition(nil), s.Signal...)
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return &c, nil
+}
+
+// AsStrategy adapts s to strategy.Strategy so the backtest engine can run
+// a YAML strategy. Signals buy at the close. Each check sees the last Bars
+// bars up to the current one, the same window strategy-runner loads live,
+// so indicators warm up the same way in both.
+func (s *Strategy) AsStrategy() strategy.Strategy {
+	return adapter{conf: s}
+}
+
+type adapter struct {
+	conf *Strategy
+}
+
+func (a adapter) Name() string { return a.conf.Name }
+
+func (a adapter) Lookback() int { return a.conf.Bars - 1 }
+
+func (a adapter) Check(v strategy.View) (strategy.Signal, bool) {
+	bars, i := v.Known(), v.Index()
+	from := max(0, i+1-a.conf.Bars)
+	ok, values := a.conf.evaluate(newSeries(bars[from:i+1]), i-from)
+	if !ok {
+		return strategy.Signal{}, false
+	}
+	return strategy.Signal{Direction: strategy.Buy, Price: bars[i].Close, Values: values}, true
+}
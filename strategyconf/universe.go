@@ -0,0 +1,79 @@
+package strategyconf
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"stock-backend/universe"
+)
+
+// conditions resolves the universe filters against the params.
+func (s *Strategy) conditions() ([]universe.Condition, error) {
+	conds := make([]universe.Condition, len(s.Universe))
+	for i, f := range s.Universe {
+		vals, err := f.Value.Resolve(s.Params)
+		if err != nil {
+			return nil, fmt.Errorf("universe[%d]: %w", i, err)
+		}
+		conds[i] = universe.Condition{Field: f.Field, Op: f.Op, Values: vals}
+	}
+	return conds, nil
+}
+
+// UniverseQuery builds the SQL selecting the symbols that pass the universe
+// filters on the last trading day before asOf, unix milliseconds, or the
+// latest one when asOf is 0.
+func (s *Strategy) UniverseQuery(asOf int64) (string, []interface{}, error) {
+	conds, err := s.conditions()
+	if err != nil {
+		return "", nil, err
+	}
+	where, args, err := universe.Where(conds)
+	if err != nil {
+		return "", nil, fmt.Errorf("universe: %w", err)
+	}
+	table := s.Market + "_stock_daily"
+	query := "SELECT DISTINCT symbol FROM " + table +
+		" WHERE timestamp = (SELECT max(timestamp) FROM " + table +
+		" WHERE timestamp < if(@as_of > 0, @as_of, toUnixTimestamp(now()) * 1000)) AND " + where + " ORDER BY symbol"
+	return query, append(args, clickhouse.Named("as_of", asOf)), nil
+}
+
+// History loads the universe as it stood on each day in [from, to), for
+// backtests.
+func (s *Strategy) History(ctx context.Context, conn driver.Conn, from, to int64) (*universe.History, error) {
+	conds, err := s.conditions()
+	if err != nil {
+		return nil, err
+	}
+	h, err := universe.Load(ctx, conn, s.Market, conds, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s universe: %w", s.Name, err)
+	}
+	return h, nil
+}
+
+// Symbols runs UniverseQuery.
+func (s *Strategy) Symbols(ctx context.Context, conn driver.Conn, asOf int64) ([]string, error) {
+	query, args, err := s.UniverseQuery(asOf)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s universe: %w", s.Name, err)
+	}
+	defer rows.Close()
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
@@ -0,0 +1,202 @@
+// Package universe answers which symbols were listed and passed a filter on
+// a given day, from the <market>_stock_daily rows of that day, so backtests
+// trade the names that existed then rather than the ones that survived.
+package universe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// Fields maps the names a condition may use to their SQL expression on
+// <market>_stock_daily. Only these ever reach the query text; thresholds are
+// bound as parameters.
+var Fields = map[string]string{
+	"market_capital": "market_capital",
+	"open":           "open",
+	"high":           "high",
+	"low":            "low",
+	"close":          "close",
+	"volume":         "volume",
+	"amount":         "amount",
+	"turnoverrate":   "turnoverrate",
+	"turnover":       "open * volume",
+	"pe":             "pe",
+	"pb":             "pb",
+}
+
+// Condition is one test on a daily row: Field Op Values[0], or for
+// "between" Values[0] < Field < Values[1].
+type Condition struct {
+	Field  string
+	Op     string
+	Values []float64
+}
+
+var sqlOps = map[string]string{">": ">", ">=": ">=", "<": "<", "<=": "<=", "==": "=", "!=": "!="}
+
+// Where turns conds into SQL conditions joined by AND, with their values
+// bound through clickhouse.Named as @cond<i>, or @cond<i>_lo and
+// @cond<i>_hi for between; "1" when there are none.
+func Where(conds []Condition) (string, []interface{}, error) {
+	where := []string{"1"}
+	var args []interface{}
+	for i, c := range conds {
+		expr, ok := Fields[c.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("condition %d: unknown field %q", i, c.Field)
+		}
+		if c.Op == "between" {
+			if len(c.Values) != 2 {
+				return "", nil, fmt.Errorf("condition %d: between needs two values", i)
+			}
+			lo, hi := fmt.Sprintf("cond%d_lo", i), fmt.Sprintf("cond%d_hi", i)
+			where = append(where, expr+" > @"+lo+" AND "+expr+" < @"+hi)
+			args = append(args, clickhouse.Named(lo, c.Values[0]), clickhouse.Named(hi, c.Values[1]))
+			continue
+		}
+		op, ok := sqlOps[c.Op]
+		if !ok {
+			return "", nil, fmt.Errorf("condition %d: unknown op %q", i, c.Op)
+		}
+		if len(c.Values) != 1 {
+			return "", nil, fmt.Errorf("condition %d: %s needs one value", i, c.Op)
+		}
+		name := fmt.Sprintf("cond%d", i)
+		where = append(where, expr+" "+op+" @"+name)
+		args = append(args, clickhouse.Named(name, c.Values[0]))
+	}
+	if len(where) > 1 {
+		where = where[1:]
+	}
+	return strings.Join(where, " AND "), args, nil
+}
+
+// ParseCondition reads a condition written as field<op>value, e.g.
+// market_capital>=1e10.
+func ParseCondition(s string) (Condition, error) {
+	// 先试两个字符的运算符
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		field, value, ok := strings.Cut(s, op)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return Condition{}, fmt.Errorf("condition %q: %w", s, err)
+		}
+		c := Condition{Field: strings.TrimSpace(field), Op: op, Values: []float64{v}}
+		if _, ok := Fields[c.Field]; !ok {
+			return Condition{}, fmt.Errorf("condition %q: unknown field %q", s, c.Field)
+		}
+		return c, nil
+	}
+	return Condition{}, fmt.Errorf("condition %q: want field<op>value", s)
+}
+
+const dayMillis = 24 * 3600 * 1000
+
+// History is the universe day by day.
+type History struct {
+	Market string
+	// days are the daily row timestamps, ascending, and members the sorted
+	// symbols that passed on each.
+	days    []int64
+	members [][]string
+}
+
+// Load reads the members of every trading day in [from, to), unix
+// milliseconds with to 0 meaning the latest day: the symbols with a
+// <market>_stock_daily row that day passing conds as they stood that day.
+func Load(ctx context.Context, conn driver.Conn, market string, conds []Condition, from, to int64) (*History, error) {
+	if market != "cn" && market != "us" {
+		return nil, fmt.Errorf("market must be cn or us, got %q", market)
+	}
+	where, args, err := Where(conds)
+	if err != nil {
+		return nil, err
+	}
+	if to <= 0 {
+		to = 1<<63 - 1
+	}
+	table := market + "_stock_daily"
+	query := `SELECT DISTINCT toInt64(timestamp) AS ts, symbol
+		FROM ` + table + `
+		WHERE timestamp >= @from AND timestamp < @to AND ` + where + `
+		ORDER BY ts, symbol`
+	rows, err := conn.Query(ctx, query, append([]interface{}{clickhouse.Named("from", from), clickhouse.Named("to", to)}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("query %s universe: %w", table, err)
+	}
+	defer rows.Close()
+	h := &History{Market: market}
+	for rows.Next() {
+		var ts int64
+		var symbol string
+		if err := rows.Scan(&ts, &symbol); err != nil {
+			return nil, fmt.Errorf("scan %s universe: %w", table, err)
+		}
+		if n := len(h.days); n == 0 || h.days[n-1] != ts {
+			h.days = append(h.days, ts)
+			h.members = append(h.members, nil)
+		}
+		h.members[len(h.members)-1] = append(h.members[len(h.members)-1], symbol)
+	}
+	return h, rows.Err()
+}
+
+// day is the index of the last day whose row was final as of ts, -1
+// before the first. A daily row is only known once its day has closed, so
+// an intraday ts inside a day falls back to the day before.
+func (h *History) day(ts int64) int {
+	d := sort.Search(len(h.days), func(i int) bool { return h.days[i] > ts }) - 1
+	if d >= 0 && h.days[d] != ts && ts-h.days[d] < dayMillis {
+		d--
+	}
+	return d
+}
+
+// At lists the members as of ts: for a daily bar, its own day; for an
+// intraday bar, the last day before it.
+func (h *History) At(ts int64) []string {
+	d := h.day(ts)
+	if d < 0 {
+		return nil
+	}
+	return h.members[d]
+}
+
+// Contains reports whether symbol was a member as of ts.
+func (h *History) Contains(symbol string, ts int64) bool {
+	members := h.At(ts)
+	i := sort.SearchStrings(members, symbol)
+	return i < len(members) && members[i] == symbol
+}
+
+// Symbols lists every symbol that was a member on any day, sorted; these
+// are the ones a backtest needs bars for.
+func (h *History) Symbols() []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, members := range h.members {
+		for _, symbol := range members {
+			if !seen[symbol] {
+				seen[symbol] = true
+				res = append(res, symbol)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Days are the trading days covered, as daily row timestamps.
+func (h *History) Days() []int64 {
+	return h.days
+}
@@ -0,0 +1,273 @@
+package volprofile
+
+import (
+	"errors"
+	"math"
+
+	"stock-backend/kline"
+)
+
+// Options controls how a profile is bucketed.
+type Options struct {
+	// Buckets is the number of price buckets between the lowest low and the
+	// highest high. Ignored when TickSize is set.
+	Buckets int
+	// TickSize fixes the bucket height instead, e.g. 0.01 for A shares.
+	TickSize float64
+	// ValueArea is the share of volume the value area must hold, 0.7 if unset.
+	ValueArea float64
+	// HighNode and LowNode are the multiples of the average bucket volume a
+	// bucket must reach, or stay under, to be part of a high or low node.
+	// They default to 1.5 and 0.5.
+	HighNode float64
+	LowNode  float64
+}
+
+// Node is a contiguous price range of unusually high or low traded volume.
+type Node struct {
+	Low    float64
+	High   float64
+	Volume float64
+}
+
+// Zone classifies a price by the volume traded around it.
+type Zone int
+
+const (
+	Outside Zone = iota
+	Thin
+	Normal
+	Heavy
+)
+
+func (z Zone) String() string {
+	switch z {
+	case Thin:
+		return "thin"
+	case Normal:
+		return "normal"
+	case Heavy:
+		return "heavy"
+	}
+	return "outside"
+}
+
+// Profile is traded volume by price bucket over a window of bars.
+type Profile struct {
+	Low    float64
+	Step   float64
+	Volume []float64
+	Total  float64
+
+	// POC is the middle of the bucket with the most volume.
+	POC float64
+	// VAH and VAL bound the value area around the POC.
+	VAH float64
+	VAL float64
+
+	HighNodes []Node
+	LowNodes  []Node
+
+	avg     float64
+	options Options
+}
+
+// Build spreads each bar's volume evenly over its low-high range and sums it
+// per bucket. Bars can be daily or intraday; the caller picks the window.
+func Build(bars []kline.Bar, opts Options) (*Profile, error) {
+	if len(bars) == 0 {
+		return nil, errors.New("no bars")
+	}
+	if opts.ValueArea <= 0 || opts.ValueArea > 1 {
+		opts.ValueArea = 0.7
+	}
+	if opts.HighNode <= 0 {
+		opts.HighNode = 1.5
+	}
+	if opts.LowNode <= 0 {
+		opts.LowNode = 0.5
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, b := range bars {
+		low = math.Min(low, b.Low)
+		high = math.Max(high, b.High)
+	}
+	p := &Profile{Low: low, options: opts}
+	buckets := 0
+	switch {
+	case opts.TickSize > 0:
+		p.Step = opts.TickSize
+	case opts.Buckets > 0:
+		buckets = opts.Buckets
+	default:
+		buckets = 50
+	}
+	if buckets > 0 {
+		p.Step = (high - low) / float64(buckets)
+	}
+	if p.Step <= 0 {
+		// 整个窗口只有一个价位
+		p.Step = math.Max(high*0.001, 0.01)
+	}
+	n := int(math.Ceil((high - low) / p.Step))
+	if buckets > 0 && n > buckets {
+		// 浮点误差会让最高价多出一格，归到最后一格
+		n = buckets
+	}
+	if n < 1 {
+		n = 1
+	}
+	p.Volume = make([]float64, n)
+
+	for _, b := range bars {
+		if b.Volume <= 0 {
+			continue
+		}
+		p.Total += b.Volume
+		lo, hi := p.bucket(b.Low), p.bucket(b.High)
+		if lo == hi || b.High <= b.Low {
+			p.Volume[lo] += b.Volume
+			continue
+		}
+		span := b.High - b.Low
+		for i := lo; i <= hi; i++ {
+			bl := math.Max(p.Low+float64(i)*p.Step, b.Low)
+			bh := math.Min(p.Low+float64(i+1)*p.Step, b.High)
+			if bh > bl {
+				p.Volume[i] += b.Volume * (bh - bl) / span
+			}
+		}
+	}
+	if p.Total == 0 {
+		return nil, errors.New("no volume in window")
+	}
+	p.avg = p.Total / float64(n)
+	p.valueArea()
+	p.nodes()
+	return p, nil
+}
+
+func (p *Profile) bucket(price float64) int {
+	i := int(math.Floor((price - p.Low) / p.Step))
+	if i < 0 {
+		return 0
+	}
+	if i >= len(p.Volume) {
+		return len(p.Volume) - 1
+	}
+	return i
+}
+
+func (p *Profile) mid(i int) float64 {
+	return p.Low + (float64(i)+0.5)*p.Step
+}
+
+// valueArea grows outwards from the POC, always taking the heavier
+// neighbour, until the configured share of volume is covered.
+func (p *Profile) valueArea() {
+	poc := 0
+	for i, v := range p.Volume {
+		if v > p.Volume[poc] {
+			poc = i
+		}
+	}
+	p.POC = p.mid(poc)
+
+	lo, hi := poc, poc
+	sum := p.Volume[poc]
+	for sum < p.Total*p.options.ValueArea && (lo > 0 || hi < len(p.Volume)-1) {
+		down, up := -1.0, -1.0
+		if lo > 0 {
+			down = p.Volume[lo-1]
+		}
+		if hi < len(p.Volume)-1 {
+			up = p.Volume[hi+1]
+		}
+		if up >= down {
+			hi++
+			sum += up
+		} else {
+			lo--
+			sum += down
+		}
+	}
+	p.VAL = p.Low + float64(lo)*p.Step
+	p.VAH = p.Low + float64(hi+1)*p.Step
+}
+
+// nodes collects runs of buckets above HighNode or below LowNode times the
+// average bucket volume.
+func (p *Profile) nodes() {
+	p.HighNodes = p.runs(func(v float64) bool { return v >= p.avg*p.options.HighNode })
+	p.LowNodes = p.runs(func(v float64) bool { return v <= p.avg*p.options.LowNode })
+}
+
+func (p *Profile) runs(match func(float64) bool) []Node {
+	var res []Node
+	start := -1
+	vol := 0.0
+	for i := 0; i <= len(p.Volume); i++ {
+		if i < len(p.Volume) && match(p.Volume[i]) {
+			if start < 0 {
+				start = i
+				vol = 0
+			}
+			vol += p.Volume[i]
+			continue
+		}
+		if start >= 0 {
+			res = append(res, Node{
+				Low:    p.Low + float64(start)*p.Step,
+				High:   p.Low + float64(i)*p.Step,
+				Volume: vol,
+			})
+			start = -1
+		}
+	}
+	return res
+}
+
+// At returns the volume traded in the bucket holding price.
+func (p *Profile) At(price float64) float64 {
+	if price < p.Low || price > p.Low+float64(len(p.Volume))*p.Step {
+		return 0
+	}
+	return p.Volume[p.bucket(price)]
+}
+
+// Zone tells whether price sits in a thin, normal or heavy volume area of
+// the profile, or outside the traded range altogether.
+func (p *Profile) Zone(price float64) Zone {
+	if price < p.Low || price > p.Low+float64(len(p.Volume))*p.Step {
+		return Outside
+	}
+	v := p.Volume[p.bucket(price)]
+	switch {
+	case v >= p.avg*p.options.HighNode:
+		return Heavy
+	case v <= p.avg*p.options.LowNode:
+		return Thin
+	}
+	return Normal
+}
+
+// Ahead returns the volume share of the price range a move from one price to
+// another has to travel through. A gap up into a range with a small share is
+// entering thin air; a large share means overhead supply.
+func (p *Profile) Ahead(from, to float64) float64 {
+	if from > to {
+		from, to = to, from
+	}
+	lo, hi := p.bucket(from), p.bucket(to)
+	sum := 0.0
+	for i := lo; i <= hi; i++ {
+		sum += p.Volume[i]
+	}
+	return sum / p.Total
+}
+
+// InValueArea reports whether price lies between VAL and VAH.
+func (p *Profile) InValueArea(price float64) bool {
+	return price >= p.VAL && price <= p.VAH
+}
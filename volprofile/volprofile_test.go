@@ -0,0 +1,129 @@
+package volprofile
+
+import (
+	"math"
+	"testing"
+
+	"stock-backend/kline"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// handBuilt 在 10-20 之间按 1 元一格分 10 格，各格成交量为
+// 10 10 10 10 210 70 10 30 10 10，合计 380。
+func handBuilt(t *testing.T) *Profile {
+	t.Helper()
+	bars := []kline.Bar{
+		{Low: 10, High: 20, Volume: 100},
+		{Low: 14, High: 15, Volume: 200},
+		{Low: 15, High: 16, Volume: 60},
+		{Low: 17, High: 18, Volume: 20},
+	}
+	p, err := Build(bars, Options{Buckets: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{10, 10, 10, 10, 210, 70, 10, 30, 10, 10}
+	if len(p.Volume) != len(want) {
+		t.Fatalf("%d buckets, want %d", len(p.Volume), len(want))
+	}
+	for i, v := range want {
+		if !near(p.Volume[i], v) {
+			t.Fatalf("volume %v, want %v", p.Volume, want)
+		}
+	}
+	return p
+}
+
+func TestValueArea(t *testing.T) {
+	p := handBuilt(t)
+	if !near(p.POC, 14.5) || !near(p.VAL, 14) || !near(p.VAH, 16) {
+		t.Errorf("POC %v VAL %v VAH %v, want 14.5 14 16", p.POC, p.VAL, p.VAH)
+	}
+	if !p.InValueArea(p.POC) {
+		t.Error("POC outside the value area")
+	}
+	in := 0.0
+	for i, v := range p.Volume {
+		if p.InValueArea(p.mid(i)) {
+			in += v
+		}
+	}
+	if in < 0.7*p.Total {
+		t.Errorf("value area holds %v of %v", in, p.Total)
+	}
+	if len(p.HighNodes) != 1 || !near(p.HighNodes[0].Low, 14) || !near(p.HighNodes[0].High, 16) || !near(p.HighNodes[0].Volume, 280) {
+		t.Errorf("high nodes %+v", p.HighNodes)
+	}
+	if len(p.LowNodes) != 3 {
+		t.Errorf("low nodes %+v", p.LowNodes)
+	}
+}
+
+func TestZone(t *testing.T) {
+	p := handBuilt(t)
+	tests := []struct {
+		price float64
+		want  Zone
+	}{
+		{9.5, Outside},
+		{10, Thin},
+		{12.3, Thin},
+		{14.5, Heavy},
+		{15.9, Heavy},
+		{17.5, Normal},
+		{20, Thin},
+		{20.5, Outside},
+	}
+	for _, tt := range tests {
+		if got := p.Zone(tt.price); got != tt.want {
+			t.Errorf("Zone(%v) = %v, want %v", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestAhead(t *testing.T) {
+	p := handBuilt(t)
+	tests := []struct {
+		from, to, want float64
+	}{
+		{14.2, 15.5, 280.0 / 380},
+		{15.5, 14.2, 280.0 / 380},
+		{16.5, 19.9, 60.0 / 380},
+		{10, 20, 1},
+		{12.5, 12.6, 10.0 / 380},
+	}
+	for _, tt := range tests {
+		if got := p.Ahead(tt.from, tt.to); !near(got, tt.want) {
+			t.Errorf("Ahead(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	tests := []struct {
+		low, high float64
+		buckets   int
+	}{
+		{9.87, 12.34, 7},
+		{9.87, 12.34, 57},
+		{3.3, 7.7, 15},
+		{3.3, 7.7, 60},
+		{10, 20, 10},
+	}
+	for _, tt := range tests {
+		bars := []kline.Bar{{Low: tt.low, High: tt.high, Volume: 1000}}
+		p, err := Build(bars, Options{Buckets: tt.buckets})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Volume) != tt.buckets {
+			t.Errorf("%v-%v in %d buckets made %d", tt.low, tt.high, tt.buckets, len(p.Volume))
+		}
+		if p.At(tt.high) == 0 || !near(p.Total, 1000) {
+			t.Errorf("%v-%v: high bucket %v total %v", tt.low, tt.high, p.At(tt.high), p.Total)
+		}
+	}
+}
@@ -3,19 +3,28 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"gopkg.in/gomail.v2"
+
+	"stock-backend/calendar"
+	"stock-backend/dedupe"
+	"stock-backend/kline"
+	"stock-backend/schedule"
+	"stock-backend/screener"
+	"stock-backend/signals"
+	"stock-backend/strategy"
+	"stock-backend/volprofile"
 )
 
 type Market struct {
@@ -145,6 +154,12 @@ type Point struct {
 	ts    uint64
 }
 
+// gapPool is the symbols with a recent gap, loaded once per session.
+type gapPool struct {
+	session time.Time
+	points  map[string]*Point
+}
+
 type DownPeriod struct {
 	ts         int
 	downClimb  int
@@ -158,25 +173,6 @@ type DownPeriod struct {
 	avgVal     float64
 }
 
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -281,7 +277,7 @@ func SendEmail(symbol, context string) {
 	}
 }
 
-func runCNTask(result map[string]int, pool map[string]*Point, cookie string) {
+func runCNTask(screens *screener.Registry, alerts *dedupe.Store, store *signals.Store, pool *gapPool, cookie string) {
 	now := time.Now()
 	unixNano := now.UnixNano()
 	// 将纳秒转换为毫秒
@@ -297,21 +293,10 @@ func runCNTask(result map[string]int, pool map[string]*Point, cookie string) {
 		log.Fatalf("Failed to connect to ClickHouse: %v", err)
 	}
 	defer conn.Close()
-	if len(pool) == 0 {
-		// 将文件内容转换为字符串
-		sqlStatements := fmt.Sprintf(`WITH RankedSymbols AS (
-			SELECT *,
-				ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
-			FROM cn_gap_records
-			WHERE symbol in (SELECT DISTINCT symbol FROM cn_stock_daily where timestamp = (select max(timestamp) from cn_stock_daily)) and timestamp >= toUnixTimestamp(now()) * 1000 - 12* 24 * 3600 * 1000
-			and  timestamp <= toUnixTimestamp(now()) * 1000 - 5* 24 * 3600 * 1000
-		)
-		SELECT symbol, open, close, timestamp
-		FROM RankedSymbols
-
-		WHERE rn = 1;`,
-		)
-		rows, err := conn.Query(context.Background(), sqlStatements)
+	if session := calendar.CN.SessionDate(now); !pool.session.Equal(session) {
+		pool.session = session
+		pool.points = make(map[string]*Point)
+		rows, err := screens.Query(context.Background(), conn, "gap-records", screener.Args{"market": "cn", "from_days": 5, "to_days": 12})
 		if err != nil {
 			fmt.Println("数据库查询出错")
 		}
@@ -330,22 +315,13 @@ func runCNTask(result map[string]int, pool map[string]*Point, cookie string) {
 			temp.open = open
 			temp.close = close
 			temp.ts = ts
-			pool[symbol] = temp
+			pool.points[symbol] = temp
 		}
 	}
 
-	err = os.Remove("running-cn.txt")
-	if err != nil {
-		fmt.Println("删除文件出错")
-	}
-	file, err := os.OpenFile("running-cn.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return
-	}
 	start := time.Now()
-	fmt.Println(len(pool))
-	for symbol, item := range pool {
+	fmt.Println(len(pool.points))
+	for symbol := range pool.points {
 		// 等待定时器触发
 		// <-timer.C
 		// url := "https://stock.xueqiu.com/v5/stock/quote.json?extend=detail&symbol=" + symbol
@@ -380,51 +356,39 @@ func runCNTask(result map[string]int, pool map[string]*Point, cookie string) {
 			return
 		}
 
-		data := response.Data.Item
-		if len(data) == 0 {
+		bars, err := kline.FromItems(response.Data.Column, response.Data.Item)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(bars) == 0 {
 			log.Fatal("No data available")
 		}
 
-		closePrice := make([]float64, 0)
-		for i := 0; i < len(data); i++ {
-			closePrice = append(closePrice, data[i][5].(float64))
-
-			if i == len(data)-1 {
-				avg := calculateMA(closePrice, 10)
-				if data[i-1][5].(float64) < avg[len(avg)-2] {
-					continue
-				}
-				if data[i][4].(float64) < item.open && data[i][5].(float64) > item.open {
-					seconds := item.ts / 1000
-					nanoseconds := (item.ts % 1000) * 1000000
-					t := time.Unix(int64(seconds), int64(nanoseconds))
-					formattedTime := t.Format("2006-01-02 15:04:05")
-
-					str := fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,开盘：%f, 最低：%f, 最高：%f, 现价：%f\n", symbol, item.open, formattedTime, avg[len(avg)-1], data[i][2].(float64), data[i][4].(float64), data[i][3].(float64), data[i][5].(float64))
-					if _, ok := result[symbol]; !ok {
-						result[symbol] = 1
-						// SendEmail(symbol, str)
-					}
-					_, err = file.WriteString(str)
-					if err != nil {
-						fmt.Println("Error writing to file:", err)
-						return
-					}
-				}
+		sig, ok := strategy.Latest(strategy.GapAboveMA10, symbol, bars)
+		if !ok {
+			continue
+		}
+		formattedTime := time.UnixMilli(int64(sig.Values["gap_ts"])).Format("2006-01-02 15:04:05")
+		str := fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,开盘：%f, 最低：%f, 最高：%f, 现价：%f, 量能区：%s, 上方量能占比：%.2f\n", symbol, sig.Values["gap_open"], formattedTime, sig.Values["ma"], sig.Bar.Open, sig.Bar.Low, sig.Bar.High, sig.Bar.Close, volprofile.Zone(sig.Values["zone"]), sig.Values["ahead"])
+		fmt.Print(str)
+		isNew, err := alerts.Allow(context.Background(), sig.Strategy, "cn", symbol, time.Now())
+		if err != nil {
+			fmt.Println("查询提醒记录出错:", err)
+			continue
+		}
+		if isNew {
+			// SendEmail(symbol, str)
+			if err := store.Write(context.Background(), signals.FromSignal(sig, "cn", time.Now())); err != nil {
+				fmt.Println("写入信号出错:", err)
 			}
 		}
 	}
 	elapsed := time.Since(start) // 计算经过的时间
 	fmt.Printf("耗时：%s\n", elapsed)
-	loopLine := "======================================\n"
-	_, err = file.WriteString(loopLine)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
-	}
 }
 
-func runUsTask(result map[string]int, pool map[string]*Point, cookie string) {
+func runUsTask(screens *screener.Registry, alerts *dedupe.Store, store *signals.Store, pool *gapPool, cookie string) {
 	now := time.Now()
 	unixNano := now.UnixNano()
 	// 将纳秒转换为毫秒
@@ -440,21 +404,10 @@ func runUsTask(result map[string]int, pool map[string]*Point, cookie string) {
 		log.Fatalf("Failed to connect to ClickHouse: %v", err)
 	}
 	defer conn.Close()
-	if len(pool) == 0 {
-		// 将文件内容转换为字符串
-		sqlStatements := fmt.Sprintf(`WITH RankedSymbols AS (
-			SELECT *,
-				ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY timestamp DESC) AS rn
-			FROM us_gap_records
-			WHERE symbol in (SELECT DISTINCT symbol FROM us_stock_daily where timestamp = (select max(timestamp) from us_stock_daily) and market_capital > 5045411866) and timestamp >= toUnixTimestamp(now()) * 1000 - 12* 24 * 3600 * 1000
-			and  timestamp <= toUnixTimestamp(now()) * 1000 - 5* 24 * 3600 * 1000
-		)
-		SELECT symbol, open, close, timestamp
-		FROM RankedSymbols
-
-		WHERE rn = 1;`,
-		)
-		rows, err := conn.Query(context.Background(), sqlStatements)
+	if session := calendar.US.SessionDate(now); !pool.session.Equal(session) {
+		pool.session = session
+		pool.points = make(map[string]*Point)
+		rows, err := screens.Query(context.Background(), conn, "gap-records", screener.Args{"market": "us", "from_days": 5, "to_days": 12, "min_market_cap": 5045411866.0})
 		if err != nil {
 			fmt.Println("数据库查询出错")
 		}
@@ -473,21 +426,12 @@ func runUsTask(result map[string]int, pool map[string]*Point, cookie string) {
 			temp.open = open
 			temp.close = close
 			temp.ts = ts
-			pool[symbol] = temp
+			pool.points[symbol] = temp
 		}
 	}
-	fmt.Println(len(pool))
-	err = os.Remove("running-us.txt")
-	if err != nil {
-		fmt.Println("删除文件出错")
-	}
-	file, err := os.OpenFile("running-us.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return
-	}
+	fmt.Println(len(pool.points))
 	start := time.Now()
-	for symbol, item := range pool {
+	for symbol := range pool.points {
 		// 等待定时器触发
 		// <-timer.C
 
@@ -523,73 +467,63 @@ func runUsTask(result map[string]int, pool map[string]*Point, cookie string) {
 			return
 		}
 
-		data := response.Data.Item
-		if len(data) == 0 {
+		bars, err := kline.FromItems(response.Data.Column, response.Data.Item)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(bars) == 0 {
 			log.Fatal("No data available")
 		}
 
-		closePrice := make([]float64, 0)
-		for i := 0; i < len(data); i++ {
-			closePrice = append(closePrice, data[i][5].(float64))
-
-			if i == len(data)-1 {
-				avg := calculateMA(closePrice, 10)
-				if data[i-1][5].(float64) < avg[len(avg)-2] {
-					continue
-				}
-				if data[i][4].(float64) < item.open && data[i][5].(float64) > item.open {
-					seconds := item.ts / 1000
-					nanoseconds := (item.ts % 1000) * 1000000
-					t := time.Unix(int64(seconds), int64(nanoseconds))
-					formattedTime := t.Format("2006-01-02 15:04:05")
-
-					str := fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,开盘：%f, 最低：%f, 最高：%f, 现价：%f\n", symbol, item.open, formattedTime, avg[len(avg)-1], data[i][2].(float64), data[i][4].(float64), data[i][3].(float64), data[i][5].(float64))
-					if _, ok := result[symbol]; !ok {
-						result[symbol] = 1
-						//SendEmail(symbol, str)
-					}
-					_, err = file.WriteString(str)
-					if err != nil {
-						fmt.Println("Error writing to file:", err)
-						return
-					}
-				}
+		sig, ok := strategy.Latest(strategy.GapAboveMA10, symbol, bars)
+		if !ok {
+			continue
+		}
+		formattedTime := time.UnixMilli(int64(sig.Values["gap_ts"])).Format("2006-01-02 15:04:05")
+		str := fmt.Sprintf("%s\n        Gap点:%f(%s），10日平均：%f,开盘：%f, 最低：%f, 最高：%f, 现价：%f, 量能区：%s, 上方量能占比：%.2f\n", symbol, sig.Values["gap_open"], formattedTime, sig.Values["ma"], sig.Bar.Open, sig.Bar.Low, sig.Bar.High, sig.Bar.Close, volprofile.Zone(sig.Values["zone"]), sig.Values["ahead"])
+		fmt.Print(str)
+		isNew, err := alerts.Allow(context.Background(), sig.Strategy, "us", symbol, time.Now())
+		if err != nil {
+			fmt.Println("查询提醒记录出错:", err)
+			continue
+		}
+		if isNew {
+			//SendEmail(symbol, str)
+			if err := store.Write(context.Background(), signals.FromSignal(sig, "us", time.Now())); err != nil {
+				fmt.Println("写入信号出错:", err)
 			}
 		}
 	}
 	elapsed := time.Since(start) // 计算经过的时间
 	fmt.Printf("耗时：%s\n", elapsed)
-	loopLine := "======================================\n"
-	_, err = file.WriteString(loopLine)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
-	}
 }
 func main() {
-	result := make(map[string]int, 0)
-	pool := make(map[string]*Point, 0)
-	// 定义时间段
-	loc, err := time.LoadLocation("Asia/Shanghai")
+	screensDir := flag.String("screens", "../../screens", "directory holding the screen SQL files")
+	flag.Parse()
+	screens, err := screener.Open(*screensDir)
 	if err != nil {
-		fmt.Println("Error loading location:", err)
-		return
+		log.Fatalf("Failed to load screens: %v", err)
 	}
-
-	// Define time periods (Beijing time)
-	morningCnStart := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 9, 30, 0, 0, loc)
-	morningCnEnd := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 11, 30, 0, 0, loc)
-	afternoonCnStart := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 13, 0, 0, 0, loc)
-	afternoonCnEnd := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 15, 0, 0, 0, loc)
-
-	clearCn := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 21, 15, 0, 0, loc)
-	startUs := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 21, 30, 0, 0, loc)
-	endUs := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day()+1, 4, 00, 0, 0, loc)
-	clearUs := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day()+1, 9, 15, 0, 0, loc)
-	// 创建一个 ticker，用于定时检查
-	ticker := time.NewTicker(2 * time.Second) // 每分钟检查一次
-	defer ticker.Stop()
-
+	// 提醒记录存在 ClickHouse 里，重启后同一交易日不会重复提醒
+	options := &clickhouse.Options{
+		Addr: []string{"localhost:19000"},
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		log.Fatalf("Failed to connect to ClickHouse: %v", err)
+	}
+	defer conn.Close()
+	alerts, err := dedupe.Open(context.Background(), conn, dedupe.Options{})
+	if err != nil {
+		log.Fatalf("Failed to open alerts: %v", err)
+	}
+	// 信号表只建一次，每轮扫描都往里写
+	store, err := signals.Open(context.Background(), conn)
+	if err != nil {
+		log.Fatalf("Failed to open signals: %v", err)
+	}
+	cnPool, usPool := &gapPool{}, &gapPool{}
 	urlStr := "http://www.xueqiu.com"
 	// 创建CookieJar来存储Cookies
 	jar, err := cookiejar.New(nil)
@@ -618,23 +552,19 @@ func main() {
 		cookiesString = cookiesString[:len(cookiesString)-2] // 去掉最后的 "; "
 	}
 
-	for {
-		select {
-		case t := <-ticker.C:
-			// 当前时间
-			now := t
-			// 检查是否在定义的时间段内
-			if (now.After(morningCnStart) && now.Before(morningCnEnd)) || (now.After(afternoonCnStart) && now.Before(afternoonCnEnd)) {
-				runCNTask(result, pool, cookiesString)
-			} else if now.After(clearCn) && now.Before(startUs) || (now.After(clearUs) && now.Before(morningCnStart)) {
-				result = make(map[string]int, 0)
-				pool = make(map[string]*Point, 0)
-
-			} else if now.After(startUs) && now.Before(endUs) {
-				runUsTask(result, pool, cookiesString)
-			} else {
-
-			}
-		}
+	// A股和美股各自的交易时段里连着跑，午休、节假日、提前收盘和夏令时都由日历管
+	sched := schedule.New()
+	if err := sched.Every(calendar.CN, "cn-gap", 0, 2*time.Second, func(ctx context.Context, t time.Time) {
+		runCNTask(screens, alerts, store, cnPool, cookiesString)
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := sched.Every(calendar.US, "us-gap", 0, 2*time.Second, func(ctx context.Context, t time.Time) {
+		runUsTask(screens, alerts, store, usPool, cookiesString)
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := sched.Run(context.Background()); err != nil {
+		log.Fatalf("Scheduler stopped: %v", err)
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"stock-backend/benchmark"
 )
 
 type Data struct {
@@ -221,9 +223,23 @@ func main() {
 
 	// 将纳秒转换为毫秒
 	// unixMilli := unixNano / int64(time.Millisecond)
+	// 指数日线用同一个接口拉，放在 index 目录下，由 csv-gen 导入 cn_index_daily 作回测基准
+	paths := make(map[string]string)
+	for _, symbol := range symbols {
+		paths[symbol] = folder_path + "/" + symbol + ".json"
+	}
+	indexFolder := folder_path + "/" + "index"
+	if err := os.MkdirAll(indexFolder, 0755); err != nil {
+		fmt.Println("Error creating directory:", err)
+		return
+	}
+	for _, idx := range benchmark.ForMarket("cn") {
+		symbols = append(symbols, idx.Symbol)
+		paths[idx.Symbol] = indexFolder + "/" + idx.Symbol + ".json"
+	}
 	for _, symbol := range symbols {
 
-		filePath := folder_path + "/" + symbol + ".json"
+		filePath := paths[symbol]
 
 		// 检查文件夹是否已存在
 		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
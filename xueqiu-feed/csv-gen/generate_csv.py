@@ -44,6 +44,48 @@ def generate_stock_csv():
 
 
 
+def generate_sub_csv(sub):
+    # 指数日线和15分钟K线分别在当天目录的 index、15m 子目录下，
+    # 导出到 /app/csv/<sub>，由 import_index.sh、import_15m.sh 导入
+    today = datetime.now().strftime('%Y-%m-%d')
+    folder_path = f'/app/json/{today}/{sub}'
+    if not os.path.exists(folder_path):
+        return
+    os.makedirs('/app/csv/' + sub, exist_ok=True)
+    for name in sorted(os.listdir(folder_path)):
+        if not name.endswith('.json'):
+            continue
+        symbol = name[:-len('.json')]
+        json_data = pd.read_json(os.path.join(folder_path, name))
+        df = pd.DataFrame(json_data['data']['item'], columns=json_data['data']['column'])
+        df['symbol'] = symbol
+        df.to_csv('/app/csv/' + sub + '/' + symbol + '.csv', index=False)
+
+
+
+def generate_names_csv():
+    # 当天 list.json 里的股票名称导出到 /app/csv/names，由 import_names.sh 导入 <market>_stock_names，
+    # 回测靠名称里的 ST 找出当天是风险警示股、按 5% 算涨跌停
+    today = datetime.now().strftime('%Y-%m-%d')
+    file_path = f'/app/json/{today}/list.json'
+    if not os.path.exists(file_path):
+        return
+    with open(file_path, 'r') as file:
+        data = json.load(file)
+    items = data['data']['list']
+    df = pd.DataFrame({
+        'date': today,
+        'symbol': [item['symbol'] for item in items],
+        'name': [item['name'] for item in items],
+    })
+    os.makedirs('/app/csv/names', exist_ok=True)
+    df.to_csv('/app/csv/names/' + today + '.csv', index=False)
+
+
+
 generate_stock_csv()
+generate_names_csv()
+generate_sub_csv('index')
+generate_sub_csv('15m')
     # 从 JSON 文件加载数据到 DataFrame
 print("???")
\ No newline at end of file
@@ -0,0 +1,25 @@
+#!/bin/bash
+# 每天的导入入口：个股日线、指数日线、15分钟K线、股票名称依次导入；用法: ./import.sh cn|us
+# csv-gen 把脚本连同 csv 一起放进 csv 卷，在 clickhouse 容器里跑：
+#   docker exec some-clickhouse-server bash /var/lib/csv/import.sh cn
+# 哪个子目录当天没有 csv 就跳过那一步
+
+market=${1:-cn}
+dir=$(cd "$(dirname "$0")" && pwd)
+has_csv() {
+	ls "$dir/$1"/*.csv >/dev/null 2>&1
+}
+
+if has_csv csv; then
+	(cd "$dir/csv" && bash "$dir/import_${market}.sh")
+fi
+cd "$dir"
+if has_csv index; then
+	bash ./import_index.sh "$market"
+fi
+if has_csv 15m; then
+	bash ./import_15m.sh "$market"
+fi
+if has_csv names; then
+	bash ./import_names.sh "$market"
+fi
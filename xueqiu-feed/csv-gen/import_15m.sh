@@ -0,0 +1,9 @@
+#!/bin/bash
+# 15分钟K线导入 <market>_stock_15m，表结构和个股日线相同；用法: ./import_15m.sh cn|us
+# kline-15m 默认只取当天的K线，每天导一次不会重复；回补历史用 -days 在第一次导入前跑
+
+market=${1:-cn}
+clickhouse-client -q "CREATE TABLE IF NOT EXISTS ${market}_stock_15m AS ${market}_stock_daily"
+for file in 15m/*.csv; do
+		clickhouse-client -q "insert into ${market}_stock_15m format CSV" --input_format_allow_errors_ratio=0 < "$file"
+done
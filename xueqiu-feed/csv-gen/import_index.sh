@@ -0,0 +1,8 @@
+#!/bin/bash
+# 指数日线导入 <market>_index_daily，表结构和个股日线相同；用法: ./import_index.sh cn|us
+
+market=${1:-cn}
+clickhouse-client -q "CREATE TABLE IF NOT EXISTS ${market}_index_daily AS ${market}_stock_daily"
+for file in index/*.csv; do
+		clickhouse-client -q "insert into ${market}_index_daily format CSV" --input_format_allow_errors_ratio=0 < "$file"
+done
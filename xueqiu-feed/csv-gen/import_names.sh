@@ -0,0 +1,9 @@
+#!/bin/bash
+# 每天的股票名称导入 <market>_stock_names；用法: ./import_names.sh cn|us
+# 回测按名称里的 ST 判断风险警示股的涨跌停幅度；只有开始导入那天起的名称，更早的日子都当作不是 ST
+
+market=${1:-cn}
+clickhouse-client -q "CREATE TABLE IF NOT EXISTS ${market}_stock_names (date Date, symbol String, name String) ENGINE = ReplacingMergeTree ORDER BY (symbol, date)"
+for file in names/*.csv; do
+		clickhouse-client -q "insert into ${market}_stock_names format CSVWithNames" --input_format_allow_errors_ratio=0 < "$file"
+done
@@ -7,4 +7,7 @@ rm /app/csv/csv/*+*.csv
 docker run -d -p 18123:8123 -p 19000:9000 -v  D:\\data_volume\\clickhouse:/var/lib/clickhouse/ -v D:\\data_volume\\json\\cn\\daily\\2024-08-08\\csv:/var/lib/csv_data --name some-clickhouse-server --ulimit nofile=262144:262144 clickhouse/clickhouse-server
 
 
-docker run -d -p 18123:8123 -p 19000:9000 -v  csv:/var/lib/csv -v clickhouse:/var/lib/clickhouse --name some-clickhouse-server --ulimit nofile=262144:262144 clickhouse/clickhouse-server
\ No newline at end of file
+docker run -d -p 18123:8123 -p 19000:9000 -v  csv:/var/lib/csv -v clickhouse:/var/lib/clickhouse --name some-clickhouse-server --ulimit nofile=262144:262144 clickhouse/clickhouse-server
+
+# csv-gen 跑完后在 clickhouse 容器里导入当天的 csv（个股、指数、15分钟K线、股票名称），美股换成 us
+docker exec some-clickhouse-server bash /var/lib/csv/import.sh cn
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,13 +12,21 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"gopkg.in/gomail.v2"
+
+	"stock-backend/calendar"
+	"stock-backend/dedupe"
+	"stock-backend/kline"
+	"stock-backend/schedule"
+	"stock-backend/scoring"
+	"stock-backend/screener"
+	"stock-backend/signals"
+	"stock-backend/strategy"
 )
 
 type Market struct {
@@ -131,6 +140,20 @@ type Response struct {
 	ErrorDescription string `json:"error_description"`
 }
 
+// ScreenerResponse is a page of xueqiu's screener list; only it carries
+// main_net_inflows, quote.json does not.
+type ScreenerResponse struct {
+	Data struct {
+		Count int `json:"count"`
+		List  []struct {
+			Symbol         string  `json:"symbol"`
+			MainNetInflows float64 `json:"main_net_inflows"`
+		} `json:"list"`
+	} `json:"data"`
+	ErrorCode        int    `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+}
+
 type KLine struct {
 	Timestamp string
 	Open      float64
@@ -162,25 +185,6 @@ type DownPeriod struct {
 	avgVal     float64
 }
 
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -267,11 +271,53 @@ func updateCookies(url string, jar *cookiejar.Jar) error {
 	return nil
 }
 
+// mainNetInflows pages through the A-share screener list, from both ends
+// like cn-daily does, until every wanted symbol has its main net inflow.
+func mainNetInflows(cookie string, want map[string]*scoring.Candidate) (map[string]float64, error) {
+	res := make(map[string]float64, len(want))
+	client := http.Client{}
+	for _, order := range []string{"asc", "desc"} {
+		for page := 1; page <= 40 && len(res) < len(want); page++ {
+			url := "https://stock.xueqiu.com/v5/stock/screener/quote/list.json?size=100&order=" + order + "&order_by=symbol&market=US&type=sh_sz&page=" + strconv.Itoa(page)
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Cookie", cookie)
+			req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
+			resp, err := client.Do(req)
+			if err != nil {
+				return res, fmt.Errorf("screener page %d: %w", page, err)
+			}
+			var response ScreenerResponse
+			err = json.NewDecoder(resp.Body).Decode(&response)
+			resp.Body.Close()
+			if err != nil {
+				return res, fmt.Errorf("screener page %d: %w", page, err)
+			}
+			if len(response.Data.List) == 0 {
+				break
+			}
+			for _, item := range response.Data.List {
+				if _, ok := want[item.Symbol]; ok {
+					res[item.Symbol] = item.MainNetInflows
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
 func main() {
-	now := time.Now()
-	unixNano := now.UnixNano()
-	// 将纳秒转换为毫秒
-	unixMilli := unixNano / int64(time.Millisecond)
+	screensDir := flag.String("screens", "../../screens", "directory holding the screen SQL files")
+	weightsFile := flag.String("weights", "", "YAML file with scoring weights, empty for the defaults")
+	flag.Parse()
+	weights := scoring.Default
+	if *weightsFile != "" {
+		var err error
+		weights, err = scoring.Load(*weightsFile)
+		if err != nil {
+			log.Fatalf("Failed to load weights: %v", err)
+		}
+	}
 	urlStr := "http://www.xueqiu.com"
 	fmt.Println(urlStr)
 	// 创建CookieJar来存储Cookies
@@ -312,31 +358,40 @@ func main() {
 	}
 	defer conn.Close()
 
-	// 读取SQL脚本文件内容
-	sqlFile, err := ioutil.ReadFile("./script.sql")
-	// sqlFile, err := ioutil.ReadFile("./script_30_days_gap_exists.sql")
+	// 另一个选择是 recent-gaps，即原来的 script_30_days_gap_exists.sql
+	screens, err := screener.Open(*screensDir)
 	if err != nil {
-		log.Fatalf("Failed to read SQL script file: %v", err)
+		log.Fatalf("Failed to load screens: %v", err)
 	}
-
-	// 将文件内容转换为字符串
-	sqlStatements := string(sqlFile)
-	err = os.Remove("running.txt")
+	store, err := signals.Open(context.Background(), conn)
 	if err != nil {
-		fmt.Println("删除文件出错")
+		log.Fatalf("Failed to open signals: %v", err)
 	}
-	for {
-		file, err := os.OpenFile("running.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Println("Error opening file:", err)
+	alerts, err := dedupe.Open(context.Background(), conn, dedupe.Options{})
+	if err != nil {
+		log.Fatalf("Failed to open alerts: %v", err)
+	}
+	// 每轮都会重新扫描最近几根日线，只记录最新一根上的信号，同一交易日只记一次
+	record := func(latest bool, r signals.Record) {
+		if !latest {
 			return
 		}
-		logfile, err := os.OpenFile("log.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		isNew, err := alerts.Allow(context.Background(), r.Strategy, r.Market, r.Symbol, r.DetectedAt)
 		if err != nil {
-			fmt.Println("Error opening file:", err)
+			fmt.Println("查询提醒记录出错:", err)
 			return
 		}
-		rows, err := conn.Query(context.Background(), sqlStatements)
+		if !isNew {
+			return
+		}
+		if err := store.Write(context.Background(), r); err != nil {
+			fmt.Println("写入信号出错:", err)
+		}
+	}
+	scan := func(ctx context.Context, t time.Time) {
+		// K线的 begin 取本轮的触发时间，而不是进程启动的时间
+		unixMilli := t.UnixMilli()
+		rows, err := screens.Query(context.Background(), conn, "latest-symbols", screener.Args{"market": "cn"})
 		if err != nil {
 			log.Fatalf("Failed to execute query: %v", err)
 		}
@@ -345,26 +400,9 @@ func main() {
 		index := 0
 		start := time.Now() // 记录开始时间
 
-		nextRun := time.Date(start.Year(), start.Month(), start.Day(), 9, 30, 5, 0, start.Location())
-
-		// 如果当前时间已经过了今天9点30分，则将下次运行时间设定为明天的9点30分
-		if start.After(nextRun) {
-			nextRun = nextRun.Add(24 * time.Hour)
-		}
-
-		// 计算下次运行时间与当前时间的间隔
-		duration := nextRun.Sub(start)
-
-		// 创建定时器，在间隔时间后执行任务
-		timer := time.NewTimer(duration)
-		defer timer.Stop()
-
-		fmt.Printf("下次运行时间：%s\n", nextRun)
-
-		// 等待定时器触发
-		// <-timer.C
-		fmt.Println("开始运行\n")
-		result := make([]string, 0)
+		fmt.Println("开始运行")
+		// 本轮触发的股票，留着K线用来打分
+		cands := make(map[string]*scoring.Candidate)
 		for rows.Next() {
 			index++
 			var (
@@ -431,6 +469,12 @@ func main() {
 			// 	}
 			// }
 
+			bars, err := kline.FromItems(response.Data.Column, data)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+
 			max := 0.0
 			if len(data) <= 5 {
 				continue
@@ -469,7 +513,32 @@ func main() {
 						date := t.Format("2006-01-02 15:04:05")
 
 						logStr += fmt.Sprintf("%s,%f,%f,%s\n", symbol, percentOpen, percentClose, date)
-						result = append(result, symbol)
+						record(i == len(data)-1, signals.Record{
+							Strategy:   "daily-gap",
+							Symbol:     symbol,
+							Market:     "cn",
+							BarTime:    ums,
+							DetectedAt: time.Now(),
+							Price:      close,
+							Direction:  strategy.Buy,
+							Payload: map[string]any{
+								"gap_open":      data[i][2].(float64),
+								"prev_high":     max,
+								"percent_open":  percentOpen,
+								"percent_close": percentClose,
+							},
+						})
+						cands[symbol] = &scoring.Candidate{
+							Symbol:   symbol,
+							Strategy: "daily-gap",
+							Bars:     bars,
+							Values: map[string]float64{
+								"gap_open":  data[i][2].(float64),
+								"gap_ts":    float64(ums),
+								"prev_high": max,
+							},
+							Periods: scoring.DownPeriods(bars),
+						}
 						prevPopIndex = i
 						prevPopGap = data[i][2].(float64)
 					} else if prevPopIndex != 0 && i-prevPopIndex < 10 {
@@ -485,6 +554,19 @@ func main() {
 							// 使用time.Format格式化时间为人类可读的格式
 							date := t.Format("2006-01-02 15:04:05")
 							logStr += fmt.Sprintf("touch %s\n", date)
+							record(i == len(data)-1, signals.Record{
+								Strategy:   "daily-gap-touch",
+								Symbol:     symbol,
+								Market:     "cn",
+								BarTime:    ums,
+								DetectedAt: time.Now(),
+								Price:      data[i][5].(float64),
+								Direction:  strategy.Buy,
+								Payload: map[string]any{
+									"gap_open": prevPopGap,
+									"gap_ts":   data[prevPopIndex][0].(float64),
+								},
+							})
 						}
 					}
 				}
@@ -504,26 +586,19 @@ func main() {
 				prevClose = data[i][5].(float64)
 			}
 
-			_, err = logfile.WriteString(logStr)
-			if err != nil {
-				fmt.Println("Error writing to file:", err)
-				return
-			}
-			//if start < end {
-			//	slope := linearRegression(x[start:end+1], y[start:end+1])
-			//	slope2 := linearRegression(x[end+1:], y[end+1:])
-			//	fmt.Println("http://xueqiu.com/s/" + symbol)
-
-			//	fmt.Printf("%.5f, %.5f\n", slope, slope2)
-			//}
+			fmt.Print(logStr)
 
 			// 处理每一行的数据
 			//if response.Data.Quote.Current > max_high_60_days_ago {
 			//}
 		}
-		str := ""
-		res := make([]Quote, 0)
-		for _, item := range result {
+		list := make([]scoring.Candidate, 0, len(cands))
+		// 主力净流入只有选股列表里有，查不全就少一个因子照样排
+		inflows, err := mainNetInflows(cookie, cands)
+		if err != nil {
+			fmt.Println("获取主力净流入失败:", err)
+		}
+		for item, cand := range cands {
 			url := "https://stock.xueqiu.com/v5/stock/quote.json?extend=detail&symbol=" + item
 			// url := "https://stock.xueqiu.com/v5/stock/chart/kline.json?symbol=" + symbol + "&begin=" + strconv.FormatInt(unixMilli, 10) + "&period=day&type=before&count=-60&indicator=kline"
 			// fmt.Println(url)
@@ -558,39 +633,38 @@ func main() {
 				return
 			}
 
-			res = append(res, response.Data.Quote)
-		}
-		sort.Slice(res, func(i, j int) bool {
-			return res[i].MarketCapital > res[j].MarketCapital
-		})
-		for _, item := range res {
-			str += item.Symbol + "   " + item.Name + "  " + fmt.Sprintf("%f", item.MarketCapital) + "\n"
+			q := response.Data.Quote
+			cand.Quote = scoring.Quote{
+				Name:          q.Name,
+				MarketCapital: q.MarketCapital,
+				TurnoverRate:  q.TurnoverRate,
+				VolumeRatio:   q.VolumeRatio,
+				NetInflow:     inflows[item],
+			}
+			list = append(list, *cand)
 		}
-		_, err = file.WriteString(str)
+		ranked, err := scoring.Rank(list, weights)
 		if err != nil {
-			fmt.Println("Error writing to file:", err)
-			return
+			log.Fatalf("Failed to rank: %v", err)
 		}
+		fmt.Print(scoring.Format(ranked))
 		elapsed := time.Since(start) // 计算经过的时间
 		fmt.Printf("耗时：%s\n", elapsed)
-		loopLine := "======================================\n"
-		_, err = file.WriteString(loopLine)
-		if err != nil {
-			fmt.Println("Error writing to file:", err)
-			return
-		}
 		fmt.Println(index)
-		time.Sleep(1 * time.Minute)
-		file.Close()
-		err = os.Remove("running.txt")
-		if err != nil {
-			fmt.Println("删除文件出错")
-		}
 		//fmt.Printf("Column 1: %s, Column 2: %d\n", symbol, max_high_60_days_ago /* ... */)
 		//fmt.Printf("Quote Information:\n")
 		//fmt.Printf("Symbol: %s\n", response.Data.Quote.Symbol)
 		//fmt.Printf("Current: %.2f\n", response.Data.Quote.Current)
 	}
+	// A股交易时段里开盘后5秒起每分钟扫一轮，节假日和午休不跑
+	sched := schedule.New()
+	sched.Logf = func(format string, args ...any) { fmt.Printf(format, args...) }
+	if err := sched.Every(calendar.CN, "cn-daily", 5*time.Second, time.Minute, scan); err != nil {
+		log.Fatal(err)
+	}
+	if err := sched.Run(context.Background()); err != nil {
+		log.Fatalf("Scheduler stopped: %v", err)
+	}
 }
 
 func SendEmail(symbol, context string) {
@@ -0,0 +1,190 @@
+// kline-15m fetches 15-minute bars from xueqiu for a symbol list and saves
+// them as <out>/<date>/15m/<symbol>.json, next to the daily feed's files.
+// csv-gen exports them to csv/15m and import_15m.sh loads them into
+// <market>_stock_15m, the table the intraday backtests read.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-backend/calendar"
+)
+
+type DailyDataResponse struct {
+	Data             DailyData `json:"data"`
+	ErrorCode        int       `json:"error_code"`
+	ErrorDescription string    `json:"error_description"`
+}
+
+type DailyData struct {
+	Symbol string          `json:"symbol"`
+	Column []string        `json:"column"`
+	Item   [][]interface{} `json:"item"`
+}
+
+// pageSize is how many bars one kline request asks for.
+const pageSize = 1000
+
+func readSymbols(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if s := strings.TrimSpace(sc.Text()); s != "" && !strings.HasPrefix(s, "#") {
+			res = append(res, s)
+		}
+	}
+	return res, sc.Err()
+}
+
+// xueqiuCookie visits the xueqiu home page for a fresh set of cookies, the
+// way daily-check does.
+func xueqiuCookie() (string, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return "", err
+	}
+	home := "https://xueqiu.com/"
+	resp, err := (&http.Client{Jar: jar}).Get(home)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	u, _ := url.Parse(home)
+	var parts []string
+	for _, c := range jar.Cookies(u) {
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// fetch pages back from now until it has every bar from the start of from,
+// and returns them oldest first.
+func fetch(symbol, cookie string, from time.Time) (*DailyDataResponse, error) {
+	var res *DailyDataResponse
+	begin := time.Now().UnixMilli()
+	for {
+		u := "https://stock.xueqiu.com/v5/stock/chart/kline.json?symbol=" + symbol + "&begin=" + strconv.FormatInt(begin, 10) + "&period=15m&type=before&count=-" + strconv.Itoa(pageSize) + "&indicator=kline,pe,pb,ps,pcf,market_capital,agt,ggt,balance"
+		req, _ := http.NewRequest("GET", u, nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", cookie)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var page DailyDataResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		if page.ErrorCode != 0 {
+			return nil, fmt.Errorf("xueqiu %d: %s", page.ErrorCode, page.ErrorDescription)
+		}
+		items := page.Data.Item
+		if res == nil {
+			res = &page
+			res.Data.Item = nil
+		}
+		// 从后往前翻页，每页都接在已取到的数据前面
+		keep := items[:0:0]
+		for _, item := range items {
+			if ts, ok := item[0].(float64); ok && int64(ts) >= from.UnixMilli() {
+				keep = append(keep, item)
+			}
+		}
+		res.Data.Item = append(keep, res.Data.Item...)
+		if len(items) < pageSize || len(keep) < len(items) {
+			return res, nil
+		}
+		first, _ := items[0][0].(float64)
+		begin = int64(first) - 1
+	}
+}
+
+func main() {
+	market := flag.String("market", "cn", "market of the symbols: cn or us")
+	symbolsFile := flag.String("symbols", "../csv-gen/symbols.txt", "file with one symbol per line")
+	out := flag.String("out", "D:\\data_volume\\json\\cn\\daily", "folder the daily feed writes to; bars go to <date>/15m under it")
+	days := flag.Int("days", 1, "trading days of bars to fetch, ending today")
+	flag.Parse()
+
+	cal, err := calendar.Get(*market)
+	if err != nil {
+		log.Fatalf("Failed to get calendar: %v", err)
+	}
+	if *days < 1 {
+		log.Fatalf("-days must be at least 1, got %d", *days)
+	}
+	symbols, err := readSymbols(*symbolsFile)
+	if err != nil {
+		log.Fatalf("Failed to read symbols: %v", err)
+	}
+	cookie, err := xueqiuCookie()
+	if err != nil {
+		log.Fatalf("Failed to get xueqiu cookies: %v", err)
+	}
+
+	// 收盘后 SessionDate 已是下一个交易日，从最近开过盘的那天起往前数 days 个交易日
+	now := time.Now()
+	from := cal.SessionDate(now)
+	n := 1
+	if now.Before(cal.At(from, cal.Sessions[0].Open)) {
+		n = 0
+	}
+	for ; n < *days; n++ {
+		from = from.AddDate(0, 0, -1)
+		for !cal.IsTradingDay(from) {
+			from = from.AddDate(0, 0, -1)
+		}
+	}
+
+	folder := filepath.Join(*out, now.In(cal.Location).Format("2006-01-02"), "15m")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", folder, err)
+	}
+	for _, symbol := range symbols {
+		filePath := filepath.Join(folder, symbol+".json")
+		if _, err := os.Stat(filePath); err == nil {
+			fmt.Println("文件已存在", filePath)
+			continue
+		}
+		res, err := fetch(symbol, cookie, from)
+		if err != nil {
+			fmt.Println("获取15分钟K线失败:", symbol, err)
+			continue
+		}
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal %s: %v", symbol, err)
+		}
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", filePath, err)
+		}
+		fmt.Printf("%s: %d 根K线\n", symbol, len(res.Data.Item))
+	}
+}
@@ -3,19 +3,28 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"stock-backend/calendar"
+	"stock-backend/dedupe"
+	"stock-backend/kline"
+	"stock-backend/schedule"
+	"stock-backend/screener"
+	"stock-backend/signals"
+	"stock-backend/strategy"
+	"stock-backend/volprofile"
 )
 
 type Market struct {
@@ -160,25 +169,6 @@ type DownPeriod struct {
 	avgVal     float64
 }
 
-// linearRegression computes the slope of the linear regression line for the given data points
-func linearRegression(x, y []float64) float64 {
-	if len(x) != len(y) {
-		panic("x and y must have the same length")
-	}
-	n := float64(len(x))
-	var sumX, sumY, sumXY, sumXX float64
-	for i := 0; i < len(x); i++ {
-		sumX += x[i]
-		sumY += y[i]
-		sumXY += x[i] * y[i]
-		sumXX += x[i] * x[i]
-	}
-
-	// Calculating the slope (m)
-	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
-	return slope
-}
-
 func calculateMA(prices []float64, period int) []float64 {
 	var ma []float64
 	for i := 0; i <= len(prices)-period; i++ {
@@ -266,10 +256,8 @@ func updateCookies(url string, jar *cookiejar.Jar) error {
 }
 
 func main() {
-	now := time.Now()
-	unixNano := now.UnixNano()
-	// 将纳秒转换为毫秒
-	unixMilli := unixNano / int64(time.Millisecond)
+	screensDir := flag.String("screens", "../../screens", "directory holding the screen SQL files")
+	flag.Parse()
 	urlStr := "http://www.xueqiu.com"
 	fmt.Println(urlStr)
 	// 创建CookieJar来存储Cookies
@@ -310,31 +298,28 @@ func main() {
 	}
 	defer conn.Close()
 
-	// 读取SQL脚本文件内容
-	sqlFile, err := ioutil.ReadFile("./script.sql")
-	// sqlFile, err := ioutil.ReadFile("./script_30_days_gap_exists.sql")
+	// 另一个选择是 recent-gaps，即原来的 script_30_days_gap_exists.sql
+	screens, err := screener.Open(*screensDir)
 	if err != nil {
-		log.Fatalf("Failed to read SQL script file: %v", err)
+		log.Fatalf("Failed to load screens: %v", err)
 	}
-
-	// 将文件内容转换为字符串
-	sqlStatements := string(sqlFile)
-	err = os.Remove("running.txt")
+	store, err := signals.Open(context.Background(), conn)
 	if err != nil {
-		fmt.Println("删除文件出错")
+		log.Fatalf("Failed to open signals: %v", err)
 	}
-	result := make([]string, 0)
-	resMap := make(map[string]int, 0)
-	res := make([]Quote, 0)
-	resQuote := make(map[string]int, 0)
-	for {
-		file, err := os.OpenFile("running.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			fmt.Println("Error opening file:", err)
-			return
-		}
-
-		rows, err := conn.Query(context.Background(), sqlStatements)
+	// 提醒记录存在 ClickHouse 里，重启后同一交易日已报过的不再重复
+	alerts, err := dedupe.Open(context.Background(), conn, dedupe.Options{})
+	if err != nil {
+		log.Fatalf("Failed to open alerts: %v", err)
+	}
+	scan := func(ctx context.Context, t time.Time) {
+		// K线的 begin 取本轮的触发时间，而不是进程启动的时间
+		unixMilli := t.UnixMilli()
+		// 每轮重新收集，不带上一轮的结果
+		res := make([]Quote, 0)
+		// 本轮新报出的股票
+		result := make([]string, 0)
+		rows, err := screens.Query(context.Background(), conn, "gap-records", screener.Args{"market": "us", "from_days": 3, "to_days": 10, "latest_only": 0})
 		if err != nil {
 			log.Fatalf("Failed to execute query: %v", err)
 		}
@@ -343,25 +328,7 @@ func main() {
 		index := 0
 		start := time.Now() // 记录开始时间
 
-		nextRun := time.Date(start.Year(), start.Month(), start.Day(), 9, 30, 5, 0, start.Location())
-
-		// 如果当前时间已经过了今天9点30分，则将下次运行时间设定为明天的9点30分
-		if start.After(nextRun) {
-			nextRun = nextRun.Add(24 * time.Hour)
-		}
-
-		// 计算下次运行时间与当前时间的间隔
-		duration := nextRun.Sub(start)
-
-		// 创建定时器，在间隔时间后执行任务
-		timer := time.NewTimer(duration)
-		defer timer.Stop()
-
-		fmt.Printf("下次运行时间：%s\n", nextRun)
-
-		// 等待定时器触发
-		// <-timer.C
-		fmt.Println("开始运行\n")
+		fmt.Println("开始运行")
 
 		for rows.Next() {
 			index++
@@ -369,19 +336,25 @@ func main() {
 				symbol string
 				open   float64
 				close  float64
+				ts     uint64
 				// ... 定义其他列的类型
 			)
 
-			err := rows.Scan(&symbol, &open, &close /* ... */)
-			if _, ok := resMap[symbol]; ok {
-				continue
-			}
+			err := rows.Scan(&symbol, &open, &close, &ts /* ... */)
 			if err != nil {
 				log.Fatalf("Failed to scan row: %v", err)
 			}
+			seen, err := alerts.Seen(context.Background(), strategy.USGapReclaim.Name(), "us", symbol, time.Now())
+			if err != nil {
+				fmt.Println("查询提醒记录出错:", err)
+				continue
+			}
+			if seen {
+				continue
+			}
 
 			// url := "https://stock.xueqiu.com/v5/stock/quote.json?extend=detail&symbol=" + symbol
-			url := "https://stock.xueqiu.com/v5/stock/chart/kline.json?symbol=" + symbol + "&begin=" + strconv.FormatInt(unixMilli, 10) + "&period=day&type=before&count=-1&indicator=kline"
+			url := "https://stock.xueqiu.com/v5/stock/chart/kline.json?symbol=" + symbol + "&begin=" + strconv.FormatInt(unixMilli, 10) + "&period=day&type=before&count=-20&indicator=kline"
 			fmt.Println(url)
 			req, _ := http.NewRequest("GET", url, nil)
 			req.Header.Set("Content-Type", "application/json")
@@ -413,8 +386,12 @@ func main() {
 				return
 			}
 
-			data := response.Data.Item
-			if len(data) == 0 {
+			bars, err := kline.FromItems(response.Data.Column, response.Data.Item)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if len(bars) == 0 {
 				log.Fatal("No data available")
 			}
 
@@ -433,22 +410,20 @@ func main() {
 			// 	}
 			// }
 
-			if data[0][2].(float64) < open && data[0][5].(float64) > open {
-				result = append(result, symbol)
-				resMap[symbol] = 1
-				str := fmt.Sprintf("%s,%f,%f,%f\n", symbol, open, data[0][5].(float64), data[0][1].(float64)/1000)
-				_, err = file.WriteString(str)
+			if sig, ok := strategy.Latest(strategy.USGapReclaim, symbol, bars); ok {
+				isNew, err := alerts.Allow(context.Background(), sig.Strategy, "us", symbol, time.Now())
 				if err != nil {
-					fmt.Println("Error writing to file:", err)
-					return
+					fmt.Println("查询提醒记录出错:", err)
+					continue
+				}
+				if !isNew {
+					continue
+				}
+				result = append(result, symbol)
+				fmt.Printf("%s,%f,%f,%f,%s,%.2f\n", symbol, sig.Values["gap_open"], sig.Bar.Close, sig.Bar.Volume/1000, volprofile.Zone(sig.Values["zone"]), sig.Values["ahead"])
+				if err := store.Write(context.Background(), signals.FromSignal(sig, "us", time.Now())); err != nil {
+					fmt.Println("写入信号出错:", err)
 				}
-				//if start < end {
-				//	slope := linearRegression(x[start:end+1], y[start:end+1])
-				//	slope2 := linearRegression(x[end+1:], y[end+1:])
-				//	fmt.Println("http://xueqiu.com/s/" + symbol)
-
-				//	fmt.Printf("%.5f, %.5f\n", slope, slope2)
-				//}
 
 				// 处理每一行的数据
 				//if response.Data.Quote.Current > max_high_60_days_ago {
@@ -463,11 +438,6 @@ func main() {
 		str := ""
 
 		for _, item := range result {
-			if _, ok := resQuote[item]; ok {
-				continue
-			} else {
-				resQuote[item] = 1
-			}
 			url := "https://stock.xueqiu.com/v5/stock/quote.json?extend=detail&symbol=" + item
 			// url := "https://stock.xueqiu.com/v5/stock/chart/kline.json?symbol=" + symbol + "&begin=" + strconv.FormatInt(unixMilli, 10) + "&period=day&type=before&count=-60&indicator=kline"
 			// fmt.Println(url)
@@ -510,20 +480,18 @@ func main() {
 		for _, item := range res {
 			str += item.Symbol + "   " + item.Name + "  " + fmt.Sprintf("%f", item.MarketCapital) + "\n"
 		}
-		_, err = file.WriteString(str)
-		if err != nil {
-			fmt.Println("Error writing to file:", err)
-			return
-		}
+		fmt.Print(str)
 		elapsed := time.Since(start) // 计算经过的时间
 		fmt.Printf("耗时：%s\n", elapsed)
-		loopLine := "======================================\n"
-		_, err = file.WriteString(loopLine)
-		if err != nil {
-			fmt.Println("Error writing to file:", err)
-			return
-		}
 		fmt.Println(index)
-		time.Sleep(1 * time.Minute)
+	}
+	// 美股交易时段里开盘后5秒起每分钟扫一轮，夏令时、节假日和提前收盘由日历管
+	sched := schedule.New()
+	sched.Logf = func(format string, args ...any) { fmt.Printf(format, args...) }
+	if err := sched.Every(calendar.US, "us-gap-reclaim", 5*time.Second, time.Minute, scan); err != nil {
+		log.Fatal(err)
+	}
+	if err := sched.Run(context.Background()); err != nil {
+		log.Fatalf("Scheduler stopped: %v", err)
 	}
 }